@@ -0,0 +1,34 @@
+// Command ruuvi decodes, encodes, scans and converts ruuvitag data.
+//
+// Usage:
+//
+//	ruuvi decode [-json] [payload ...]
+//	ruuvi encode [-format 5] [-temperature 24.3] [-humidity 53.49] ...
+//	ruuvi scan [-mac CB:B8:33:4C:88:4F] [-format text|json|jsonl|csv|influx]
+//	ruuvi convert [-from jsonl|csv] [-to jsonl|csv|influx] [input file]
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/cli"
+)
+
+func main() {
+	// disable default log output, some noise is coming from gatt library
+	log.SetOutput(ioutil.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	os.Exit(cli.Run(ctx, cli.Env{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}, os.Args[1:]))
+}
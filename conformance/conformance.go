@@ -0,0 +1,437 @@
+// Package conformance checks decoders and encoders of ruuvi data formats against test vectors.
+//
+// Vectors are JSON files, each containing an array of vectors of one data format:
+//
+//	[
+//		{
+//			"name": "valid",
+//			"raw": "0512FC5394C37C0004FFFC040CAC364200CDCBB8334C884F",
+//			"dataFormat": 5,
+//			"encode": true,
+//			"fields": {
+//				"temperature": 24.3,
+//				"humidity": 53.49,
+//				...
+//				"mac": "CB:B8:33:4C:88:4F"
+//			}
+//		}
+//	]
+//
+// raw is the hex encoded data starting with the data format byte, without the company ID.
+// Every field listed in FieldNames must have an expectation: a number (or MAC address string),
+// "invalid" if the tag reported the field as invalid, or "unsupported" if the data format does not have it.
+// Vectors with "error": true must be rejected by decoders, and have no fields.
+// Vectors with "encode": true must be reproduced exactly by encoders from the valid fields.
+//
+// The vectors of this package are in its testdata directory, and can be run against
+// other implementations with RunDecoder and RunEncoder.
+package conformance
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// Status tells what is expected from a field
+type Status int
+
+const (
+	// Valid fields are expected to decode to the given value
+	Valid Status = iota
+	// Invalid fields are expected to return an error wrapping ruuvi.ErrInvalidValue
+	Invalid
+	// Unsupported fields are expected to return an error wrapping ruuvi.ErrUnsupportedField
+	Unsupported
+)
+
+// Expected is the expectation of a single field
+type Expected struct {
+	Status Status
+	// Value is the expected value of a valid field, other than the MAC address
+	Value float64
+	// MAC is the expected value of a valid MAC address
+	MAC ruuvi.MAC
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (e *Expected) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		switch s {
+		case "invalid":
+			*e = Expected{Status: Invalid}
+		case "unsupported":
+			*e = Expected{Status: Unsupported}
+		default:
+			mac, err := ruuvi.ParseMAC(s)
+			if err != nil {
+				return fmt.Errorf("Expected a number, MAC address, \"invalid\" or \"unsupported\", got %q", s)
+			}
+			*e = Expected{MAC: mac}
+		}
+		return nil
+	}
+	var v float64
+	if err := json.Unmarshal(b, &v); err != nil {
+		return fmt.Errorf("Expected a number, MAC address, \"invalid\" or \"unsupported\", got %s", b)
+	}
+	*e = Expected{Value: v}
+	return nil
+}
+
+// Vector is a single test vector
+type Vector struct {
+	Name string `json:"name"`
+	// Raw is hex encoded data starting with the data format byte, without the company ID
+	Raw        string              `json:"raw"`
+	DataFormat int8                `json:"dataFormat"`
+	Fields     map[string]Expected `json:"fields"`
+	// Encode tells that encoders must reproduce Raw exactly from the valid fields
+	Encode bool `json:"encode"`
+	// Error tells that decoders must reject Raw
+	Error bool `json:"error"`
+
+	// File is the name of the file the vector was loaded from
+	File string `json:"-"`
+}
+
+// Bytes returns the decoded Raw data
+func (v Vector) Bytes() []byte {
+	b, _ := hex.DecodeString(v.Raw)
+	return b
+}
+
+// field describes how a field is read from AdvertisementData and Measurements
+type field struct {
+	name  string
+	flag  ruuvi.Field
+	data  func(d ruuvi.AdvertisementData) (float64, error)
+	value func(m *ruuvi.Measurements) float64
+	set   func(m *ruuvi.Measurements, v float64)
+}
+
+func intField(f func() (int, error)) (float64, error) {
+	v, err := f()
+	return float64(v), err
+}
+
+// fields lists every field, keyed by the names also used by MarshalJSON. The MAC address is handled separately.
+var fields = []field{
+	{"temperature", ruuvi.FieldTemperature,
+		func(d ruuvi.AdvertisementData) (float64, error) { return d.Temperature() },
+		func(m *ruuvi.Measurements) float64 { return m.Temperature },
+		func(m *ruuvi.Measurements, v float64) { m.Temperature = v }},
+	{"humidity", ruuvi.FieldHumidity,
+		func(d ruuvi.AdvertisementData) (float64, error) { return d.Humidity() },
+		func(m *ruuvi.Measurements) float64 { return m.Humidity },
+		func(m *ruuvi.Measurements, v float64) { m.Humidity = v }},
+	{"pressure", ruuvi.FieldPressure,
+		func(d ruuvi.AdvertisementData) (float64, error) { return intField(d.Pressure) },
+		func(m *ruuvi.Measurements) float64 { return float64(m.Pressure) },
+		func(m *ruuvi.Measurements, v float64) { m.Pressure = int(v) }},
+	{"accel-x", ruuvi.FieldAccelerationX,
+		func(d ruuvi.AdvertisementData) (float64, error) { return d.AccelerationX() },
+		func(m *ruuvi.Measurements) float64 { return m.AccelerationX },
+		func(m *ruuvi.Measurements, v float64) { m.AccelerationX = v }},
+	{"accel-y", ruuvi.FieldAccelerationY,
+		func(d ruuvi.AdvertisementData) (float64, error) { return d.AccelerationY() },
+		func(m *ruuvi.Measurements) float64 { return m.AccelerationY },
+		func(m *ruuvi.Measurements, v float64) { m.AccelerationY = v }},
+	{"accel-z", ruuvi.FieldAccelerationZ,
+		func(d ruuvi.AdvertisementData) (float64, error) { return d.AccelerationZ() },
+		func(m *ruuvi.Measurements) float64 { return m.AccelerationZ },
+		func(m *ruuvi.Measurements, v float64) { m.AccelerationZ = v }},
+	{"voltage", ruuvi.FieldBatteryVoltage,
+		func(d ruuvi.AdvertisementData) (float64, error) { return d.BatteryVoltage() },
+		func(m *ruuvi.Measurements) float64 { return m.BatteryVoltage },
+		func(m *ruuvi.Measurements, v float64) { m.BatteryVoltage = v }},
+	{"tx-power", ruuvi.FieldTransmissionPower,
+		func(d ruuvi.AdvertisementData) (float64, error) { return d.TransmissionPower() },
+		func(m *ruuvi.Measurements) float64 { return m.TransmissionPower },
+		func(m *ruuvi.Measurements, v float64) { m.TransmissionPower = v }},
+	{"movement-count", ruuvi.FieldMovementCounter,
+		func(d ruuvi.AdvertisementData) (float64, error) { return intField(d.MovementCounter) },
+		func(m *ruuvi.Measurements) float64 { return float64(m.MovementCounter) },
+		func(m *ruuvi.Measurements, v float64) { m.MovementCounter = int(v) }},
+	{"meas-seq", ruuvi.FieldMeasurementSequenceNumber,
+		func(d ruuvi.AdvertisementData) (float64, error) { return intField(d.MeasurementSequenceNumber) },
+		func(m *ruuvi.Measurements) float64 { return float64(m.MeasurementSequenceNumber) },
+		func(m *ruuvi.Measurements, v float64) { m.MeasurementSequenceNumber = int(v) }},
+}
+
+// macField is the name of the MAC address field
+const macField = "mac"
+
+// FieldNames returns the names of all fields a vector must have expectations for
+func FieldNames() []string {
+	names := make([]string, 0, len(fields)+1)
+	for _, f := range fields {
+		names = append(names, f.name)
+	}
+	return append(names, macField)
+}
+
+// LoadVectors loads vectors from all .json files in dir, sorted by file name
+func LoadVectors(dir string) ([]Vector, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var vectors []Vector
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var vs []Vector
+		if err := json.Unmarshal(b, &vs); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for i := range vs {
+			vs[i].File = filepath.Base(file)
+			if err := vs[i].check(); err != nil {
+				return nil, fmt.Errorf("%s: vector %q: %w", file, vs[i].Name, err)
+			}
+		}
+		vectors = append(vectors, vs...)
+	}
+	if len(vectors) == 0 {
+		return nil, fmt.Errorf("No vectors found in %s", dir)
+	}
+	return vectors, nil
+}
+
+// check returns an error if the vector is malformed
+func (v Vector) check() error {
+	if v.Name == "" {
+		return errors.New("Vector has no name")
+	}
+	if _, err := hex.DecodeString(v.Raw); err != nil {
+		return fmt.Errorf("Invalid raw data: %w", err)
+	}
+	if v.Error {
+		if len(v.Fields) != 0 || v.Encode {
+			return errors.New("Error vectors cannot have fields or be encoded")
+		}
+		return nil
+	}
+	for _, name := range FieldNames() {
+		if _, ok := v.Fields[name]; !ok {
+			return fmt.Errorf("No expectation for field %q", name)
+		}
+	}
+	if len(v.Fields) != len(fields)+1 {
+		return fmt.Errorf("Unknown fields, expected only %v", FieldNames())
+	}
+	return nil
+}
+
+// tolerance allows for floating point rounding differences in decoded values
+const tolerance = 1e-9
+
+func equal(expected, got float64) bool {
+	return math.Abs(expected-got) <= tolerance*math.Max(1, math.Abs(expected))
+}
+
+// Decoder decodes data starting with the data format byte, without the company ID
+type Decoder func(raw []byte) (ruuvi.AdvertisementData, error)
+
+// RunDecoder runs each vector of given data formats as a subtest checking decode.
+// With no formats given, all vectors are run.
+func RunDecoder(t *testing.T, vectors []Vector, decode Decoder, formats ...int8) {
+	for _, v := range vectors {
+		v := v
+		if !includes(formats, v.DataFormat) {
+			continue
+		}
+		t.Run(v.File+"/"+v.Name, func(t *testing.T) {
+			d, err := decode(v.Bytes())
+			if v.Error {
+				if err == nil {
+					t.Fatal("Expected data to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("Decoding failed:", err)
+			}
+			if d.DataFormat() != v.DataFormat {
+				t.Errorf("DataFormat() = %d, expected %d", d.DataFormat(), v.DataFormat)
+			}
+			for _, f := range fields {
+				got, err := f.data(d)
+				checkField(t, f.name, v.Fields[f.name], err, func(e Expected) bool { return equal(e.Value, got) }, got)
+			}
+			mac, err := d.MACAddress()
+			checkField(t, macField, v.Fields[macField], err, func(e Expected) bool { return e.MAC == mac }, mac)
+			if c, ok := ruuvi.CapabilitiesOf(d); ok {
+				checkCapabilities(t, v, c)
+			}
+		})
+	}
+}
+
+// checkCapabilities checks that exactly the fields not expected to be unsupported are reported as supported,
+// and that valid values are within the reported range
+func checkCapabilities(t *testing.T, v Vector, c ruuvi.Capabilities) {
+	t.Helper()
+	for _, f := range fields {
+		checkCapability(t, f.name, v.Fields[f.name], c, f.flag)
+	}
+	checkCapability(t, macField, v.Fields[macField], c, ruuvi.FieldMACAddress)
+}
+
+func checkCapability(t *testing.T, name string, e Expected, c ruuvi.Capabilities, flag ruuvi.Field) {
+	t.Helper()
+	info, supported := c.Info(flag)
+	if supported == (e.Status == Unsupported) {
+		t.Errorf("%s: capabilities report supported %v", name, supported)
+		return
+	}
+	if e.Status == Valid && flag != ruuvi.FieldMACAddress && (e.Value < info.Min || e.Value > info.Max) {
+		t.Errorf("%s: %v is outside reported range [%v, %v]", name, e.Value, info.Min, info.Max)
+	}
+}
+
+func checkField(t *testing.T, name string, e Expected, err error, matches func(Expected) bool, got interface{}) {
+	t.Helper()
+	switch e.Status {
+	case Valid:
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		} else if !matches(e) {
+			t.Errorf("%s: got %v, expected %v", name, got, expectedValue(name, e))
+		}
+	case Invalid:
+		if !errors.Is(err, ruuvi.ErrInvalidValue) {
+			t.Errorf("%s: expected invalid value error, got %v (%v)", name, err, got)
+		}
+	case Unsupported:
+		if !errors.Is(err, ruuvi.ErrUnsupportedField) {
+			t.Errorf("%s: expected unsupported field error, got %v (%v)", name, err, got)
+		}
+	}
+}
+
+func expectedValue(name string, e Expected) interface{} {
+	if name == macField {
+		return e.MAC
+	}
+	return e.Value
+}
+
+// MeasurementsDecoder decodes data starting with the data format byte, without the company ID, into a value.
+// Only validity of fields can be checked, since Measurements does not tell invalid and unsupported apart.
+type MeasurementsDecoder func(raw []byte) (ruuvi.Measurements, error)
+
+// RunMeasurementsDecoder runs each vector of given data formats as a subtest checking decode.
+// With no formats given, all vectors are run.
+func RunMeasurementsDecoder(t *testing.T, vectors []Vector, decode MeasurementsDecoder, formats ...int8) {
+	for _, v := range vectors {
+		v := v
+		if !includes(formats, v.DataFormat) {
+			continue
+		}
+		t.Run(v.File+"/"+v.Name, func(t *testing.T) {
+			m, err := decode(v.Bytes())
+			if v.Error {
+				if err == nil {
+					t.Fatal("Expected data to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("Decoding failed:", err)
+			}
+			if m.DataFormat != v.DataFormat {
+				t.Errorf("DataFormat = %d, expected %d", m.DataFormat, v.DataFormat)
+			}
+			for _, f := range fields {
+				e := v.Fields[f.name]
+				valid := m.Valid.Has(f.flag)
+				switch {
+				case valid != (e.Status == Valid):
+					t.Errorf("%s: valid is %v, expected %v", f.name, valid, e.Status == Valid)
+				case valid && !equal(e.Value, f.value(&m)):
+					t.Errorf("%s: got %v, expected %v", f.name, f.value(&m), e.Value)
+				}
+			}
+			e := v.Fields[macField]
+			valid := m.Valid.Has(ruuvi.FieldMACAddress)
+			switch {
+			case valid != (e.Status == Valid):
+				t.Errorf("%s: valid is %v, expected %v", macField, valid, e.Status == Valid)
+			case valid && e.MAC != m.MACAddress:
+				t.Errorf("%s: got %v, expected %v", macField, m.MACAddress, e.MAC)
+			}
+		})
+	}
+}
+
+// Measurements returns the valid fields of the vector as Measurements
+func (v Vector) Measurements() ruuvi.Measurements {
+	m := ruuvi.Measurements{DataFormat: v.DataFormat}
+	for _, f := range fields {
+		if e := v.Fields[f.name]; e.Status == Valid {
+			f.set(&m, e.Value)
+			m.Set(f.flag)
+		}
+	}
+	if e := v.Fields[macField]; e.Status == Valid {
+		m.MACAddress = e.MAC
+		m.Set(ruuvi.FieldMACAddress)
+	}
+	return m
+}
+
+// Encoder encodes measurements into data starting with the data format byte, without the company ID
+type Encoder func(m ruuvi.Measurements) ([]byte, error)
+
+// RunEncoder runs each vector of given data formats marked for encoding as a subtest checking encode.
+// With no formats given, all vectors are run.
+func RunEncoder(t *testing.T, vectors []Vector, encode Encoder, formats ...int8) {
+	for _, v := range vectors {
+		v := v
+		if !v.Encode || !includes(formats, v.DataFormat) {
+			continue
+		}
+		t.Run(v.File+"/"+v.Name, func(t *testing.T) {
+			b, err := encode(v.Measurements())
+			if err != nil {
+				t.Fatal("Encoding failed:", err)
+			}
+			if got := hex.EncodeToString(b); !equalHex(got, v.Raw) {
+				t.Errorf("Encoded %s, expected %s", got, v.Raw)
+			}
+		})
+	}
+}
+
+func equalHex(a, b string) bool {
+	x, _ := hex.DecodeString(a)
+	y, _ := hex.DecodeString(b)
+	return string(x) == string(y)
+}
+
+func includes(formats []int8, f int8) bool {
+	if len(formats) == 0 {
+		return true
+	}
+	for _, g := range formats {
+		if f == g {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package conformance
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/rawv1"
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/rawv2"
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+func loadVectors(t *testing.T) []Vector {
+	t.Helper()
+	vectors, err := LoadVectors("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vectors
+}
+
+// withCompanyID prefixes raw with the Ruuvi Innovations Ltd company ID, as found in manufacturer data
+func withCompanyID(raw []byte) []byte {
+	return append([]byte{0x99, 0x04}, raw...)
+}
+
+func TestProcessAdvertisement(t *testing.T) {
+	RunDecoder(t, loadVectors(t), func(raw []byte) (ruuvi.AdvertisementData, error) {
+		return ruuvi.ProcessAdvertisement(withCompanyID(raw))
+	})
+}
+
+// TestFormatDecoders runs the vectors against the decoder of every data format registered in ruuvi.DefaultFormats,
+// so every registered format must have vectors
+func TestFormatDecoders(t *testing.T) {
+	vectors := loadVectors(t)
+	for _, f := range ruuvi.DefaultFormats.Formats() {
+		f := f
+		format := int8(f.DataFormat)
+		if !hasVectors(vectors, format) {
+			t.Errorf("No vectors for registered %v", f)
+			continue
+		}
+		decode, _ := ruuvi.DefaultFormats.Lookup(f.CompanyID, f.DataFormat)
+		t.Run(strconv.Itoa(int(f.DataFormat)), func(t *testing.T) {
+			RunDecoder(t, vectors, Decoder(decode), format)
+		})
+	}
+}
+
+func hasVectors(vectors []Vector, format int8) bool {
+	for _, v := range vectors {
+		if v.DataFormat == format {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDecode(t *testing.T) {
+	RunMeasurementsDecoder(t, loadVectors(t), func(raw []byte) (ruuvi.Measurements, error) {
+		var d ruuvi.Decoded
+		err := ruuvi.Decode(withCompanyID(raw), &d)
+		return d.Measurements, err
+	})
+}
+
+func TestEncode(t *testing.T) {
+	RunEncoder(t, loadVectors(t), func(m ruuvi.Measurements) ([]byte, error) {
+		b, err := ruuvi.Encode(m)
+		if err != nil {
+			return nil, err
+		}
+		return b[2:], nil
+	})
+}
+
+func TestFormatEncoders(t *testing.T) {
+	vectors := loadVectors(t)
+	t.Run("RAWv1", func(t *testing.T) {
+		RunEncoder(t, vectors, rawv1.Encode, 3)
+	})
+	t.Run("RAWv2", func(t *testing.T) {
+		RunEncoder(t, vectors, rawv2.Encode, 5)
+	})
+}
+
+func TestLoadVectorsErrors(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		err     string
+	}{
+		"missing field": {
+			content: `[{"name": "a", "raw": "05", "dataFormat": 5, "fields": {"temperature": 1}}]`,
+			err:     `No expectation for field "humidity"`,
+		},
+		"unknown field": {
+			content: `[{"name": "a", "raw": "03", "dataFormat": 3, "fields": {` +
+				`"temperature": 1, "humidity": 1, "pressure": 1, "accel-x": 1, "accel-y": 1, "accel-z": 1,` +
+				`"voltage": 1, "tx-power": 1, "movement-count": 1, "meas-seq": 1, "mac": "unsupported", "co2": 1}}]`,
+			err: "Unknown fields",
+		},
+		"bad expectation": {
+			content: `[{"name": "a", "raw": "05", "dataFormat": 5, "fields": {"temperature": "hot"}}]`,
+			err:     `got "hot"`,
+		},
+		"bad hex": {
+			content: `[{"name": "a", "raw": "0G", "dataFormat": 5, "error": true}]`,
+			err:     "Invalid raw data",
+		},
+		"error with fields": {
+			content: `[{"name": "a", "raw": "05", "dataFormat": 5, "error": true, "fields": {"temperature": 1}}]`,
+			err:     "Error vectors cannot have fields",
+		},
+		"no name": {
+			content: `[{"raw": "05", "dataFormat": 5, "error": true}]`,
+			err:     "Vector has no name",
+		},
+		"no vectors": {
+			content: `[]`,
+			err:     "No vectors found",
+		},
+	}
+
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "conformance")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			if err := ioutil.WriteFile(filepath.Join(dir, "vectors.json"), []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = LoadVectors(dir)
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Error %q does not contain %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+// Package csvio writes ruuvi readings as CSV (or TSV) and reads them back.
+//
+// Every reading is written as one row with a stable column order covering every field
+// of every supported data format. Cells are left empty when the data format does not
+// support the field, or when the tag reported the field as invalid.
+package csvio
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// TemperatureUnit selects unit used for temperature column
+type TemperatureUnit int
+
+const (
+	Celsius TemperatureUnit = iota
+	Fahrenheit
+	Kelvin
+)
+
+// PressureUnit selects unit used for pressure column
+type PressureUnit int
+
+const (
+	Pascal PressureUnit = iota
+	Hectopascal
+)
+
+// Options controls how CSV is written and read
+type Options struct {
+	// Comma is the field delimiter, defaults to ','. Use '\t' for TSV.
+	Comma rune
+
+	// NoHeader disables writing the header row, or when reading, tells that input has no header row
+	NoHeader bool
+
+	// Temperature selects the unit of the temperature column
+	Temperature TemperatureUnit
+
+	// Pressure selects the unit of the pressure column
+	Pressure PressureUnit
+
+	// TagInfo adds name, location and labels columns with tag metadata, see ruuvi.Reading.Tag.
+	// Labels are written as semicolon separated key=value pairs, sorted by key.
+	// When reading input with a header, this is detected from the header.
+	TagInfo bool
+}
+
+// TSV returns Options for tab separated values with default units
+func TSV() Options {
+	return Options{Comma: '\t'}
+}
+
+func (o Options) comma() rune {
+	if o.Comma == 0 {
+		return ','
+	}
+	return o.Comma
+}
+
+// column indices, in the order they are written.
+// Columns of measurement fields are in the order of ruuvi.Fields(), see fieldColumns.
+const (
+	colTimestamp = iota
+	colMAC
+	colRSSI
+	colDataFormat
+	colTemperature
+	colHumidity
+	colPressure
+	colAccelerationX
+	colAccelerationY
+	colAccelerationZ
+	colBatteryVoltage
+	colTxPower
+	colMovementCounter
+	colMeasurementSequence
+	colTagMAC
+	colRaw
+	numColumns
+
+	// optional tag metadata columns
+	colName = iota - 1
+	colLocation
+	colLabels
+	numColumnsWithTagInfo
+)
+
+// fieldColumn is the column of a measurement field
+type fieldColumn struct {
+	field ruuvi.Field
+	col   int
+}
+
+// fieldColumns are the columns of measurement fields, one per field in the order of ruuvi.Fields() starting from colTemperature
+var fieldColumns = func() []fieldColumn {
+	fields := ruuvi.Fields()
+	columns := make([]fieldColumn, len(fields))
+	for i, f := range fields {
+		columns[i] = fieldColumn{field: f, col: colTemperature + i}
+	}
+	return columns
+}()
+
+// convert converts value v of field f from the unit in ruuvi.Measurements to the unit of its column
+func (o Options) convert(f ruuvi.Field, v float64) float64 {
+	switch f {
+	case ruuvi.FieldTemperature:
+		return celsiusTo(v, o.Temperature)
+	case ruuvi.FieldPressure:
+		return pascalTo(int(v), o.Pressure)
+	}
+	return v
+}
+
+// convertBack converts value v of field f from the unit of its column to the unit in ruuvi.Measurements
+func (o Options) convertBack(f ruuvi.Field, v float64) float64 {
+	switch f {
+	case ruuvi.FieldTemperature:
+		return toCelsius(v, o.Temperature)
+	case ruuvi.FieldPressure:
+		return toPascal(v, o.Pressure)
+	}
+	return v
+}
+
+// unit returns the unit of the column of field f
+func (o Options) unit(f ruuvi.Field) string {
+	switch f {
+	case ruuvi.FieldTemperature:
+		return temperatureUnits[o.Temperature]
+	case ruuvi.FieldPressure:
+		return pressureUnits[o.Pressure]
+	}
+	return f.Unit()
+}
+
+// columnName returns the name of the column of field f: its label in snake case, with its unit as suffix
+func (o Options) columnName(f ruuvi.Field) string {
+	if f == ruuvi.FieldMACAddress {
+		// apart from the mac column, which holds the BLE address
+		return "tag_mac"
+	}
+	name := strings.ReplaceAll(strings.ToLower(f.Label()), " ", "_")
+	switch u := o.unit(f); u {
+	case "":
+		return name
+	case "%":
+		return name + "_percent"
+	default:
+		return name + "_" + strings.ToLower(strings.TrimPrefix(u, "°"))
+	}
+}
+
+// Header returns the header row used with given options.
+// Names of columns with a unit contain the unit as suffix.
+func Header(opts Options) []string {
+	h := make([]string, opts.columns())
+	h[colTimestamp] = "timestamp"
+	h[colMAC] = "mac"
+	h[colRSSI] = "rssi_dbm"
+	h[colDataFormat] = "data_format"
+	for _, c := range fieldColumns {
+		h[c.col] = opts.columnName(c.field)
+	}
+	h[colRaw] = "raw"
+	if opts.TagInfo {
+		h[colName] = "name"
+		h[colLocation] = "location"
+		h[colLabels] = "labels"
+	}
+	return h
+}
+
+func (o Options) columns() int {
+	if o.TagInfo {
+		return numColumnsWithTagInfo
+	}
+	return numColumns
+}
+
+var temperatureUnits = map[TemperatureUnit]string{
+	Celsius:    "°C",
+	Fahrenheit: "°F",
+	Kelvin:     "K",
+}
+
+var pressureUnits = map[PressureUnit]string{
+	Pascal:      "Pa",
+	Hectopascal: "hPa",
+}
+
+// unitsFromHeader checks that header matches the expected columns and returns the units and columns it uses
+func unitsFromHeader(header []string, opts Options) (Options, error) {
+	switch len(header) {
+	case numColumns:
+		opts.TagInfo = false
+	case numColumnsWithTagInfo:
+		opts.TagInfo = true
+	default:
+		return opts, fmt.Errorf("Header has %d columns, expected %d or %d", len(header), numColumns, numColumnsWithTagInfo)
+	}
+	for _, u := range []TemperatureUnit{Celsius, Fahrenheit, Kelvin} {
+		o := Options{Temperature: u}
+		if strings.EqualFold(header[colTemperature], o.columnName(ruuvi.FieldTemperature)) {
+			opts.Temperature = u
+		}
+	}
+	for _, u := range []PressureUnit{Pascal, Hectopascal} {
+		o := Options{Pressure: u}
+		if strings.EqualFold(header[colPressure], o.columnName(ruuvi.FieldPressure)) {
+			opts.Pressure = u
+		}
+	}
+	expected := Header(opts)
+	for i := range expected {
+		if !strings.EqualFold(header[i], expected[i]) {
+			return opts, fmt.Errorf("Unexpected column %q, expected %q", header[i], expected[i])
+		}
+	}
+	return opts, nil
+}
+
+func celsiusTo(c float64, u TemperatureUnit) float64 {
+	switch u {
+	case Fahrenheit:
+		return c*9.0/5.0 + 32.0
+	case Kelvin:
+		return c + 273.15
+	default:
+		return c
+	}
+}
+
+func toCelsius(t float64, u TemperatureUnit) float64 {
+	switch u {
+	case Fahrenheit:
+		return (t - 32.0) * 5.0 / 9.0
+	case Kelvin:
+		return t - 273.15
+	default:
+		return t
+	}
+}
+
+func pascalTo(p int, u PressureUnit) float64 {
+	switch u {
+	case Hectopascal:
+		return float64(p) / 100.0
+	default:
+		return float64(p)
+	}
+}
+
+func toPascal(p float64, u PressureUnit) float64 {
+	switch u {
+	case Hectopascal:
+		return p * 100.0
+	default:
+		return p
+	}
+}
@@ -0,0 +1,159 @@
+package csvio
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/fixture"
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+var float64FuzzyCompOpt = cmp.Comparer(func(x, y float64) bool {
+	delta := math.Abs(x - y)
+	mean := math.Abs(x+y) / 2.0
+	if mean == 0 {
+		return true
+	}
+	return (delta / mean) < 0.00001
+})
+
+var timestamp = time.Date(2021, 3, 31, 9, 31, 31, 500000000, time.UTC)
+
+func testReadings(t *testing.T) []ruuvi.Reading {
+	rawv2 := fixture.Process(t, fixture.RAWv2)
+	rawv2Invalid := fixture.Process(t, fixture.RAWv2Invalid)
+	rawv1 := fixture.Process(t, fixture.RAWv1)
+	return []ruuvi.Reading{
+		{Timestamp: timestamp, MAC: "CB:B8:33:4C:88:4F", RSSI: -53, Data: rawv2},
+		{Timestamp: timestamp.Add(time.Second), MAC: "CB:B8:33:4C:88:4F", RSSI: -54, Data: rawv2Invalid},
+		{Timestamp: timestamp.Add(2 * time.Second), MAC: "D1:2A:3B:4C:5D:6E", RSSI: -70, Data: rawv1},
+	}
+}
+
+func TestWriteDefaultOptions(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, Options{})
+	for _, r := range testReadings(t) {
+		if err := w.Write(r); err != nil {
+			t.Fatal("Write() returned error:", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal("Flush() returned error:", err)
+	}
+
+	expected := strings.Join([]string{
+		"timestamp,mac,rssi_dbm,data_format,temperature_c,humidity_percent,pressure_pa,acceleration_x_g,acceleration_y_g,acceleration_z_g,battery_voltage_v,tx_power_dbm,movement_counter,measurement_sequence_number,tag_mac,raw",
+		"2021-03-31T09:31:31.5Z,CB:B8:33:4C:88:4F,-53,5,24.3,53.49,100044,0.004,-0.004,1.036,2.977,4,66,205,CB:B8:33:4C:88:4F,0512fc5394c37c0004fffc040cac364200cdcbb8334c884f",
+		"2021-03-31T09:31:32.5Z,CB:B8:33:4C:88:4F,-54,5,,,,,,,,,,,,058000ffffffff800080008000ffffffffffffffffffffff",
+		"2021-03-31T09:31:33.5Z,D1:2A:3B:4C:5D:6E,-70,3,26.3,20.5,102766,-1,-1.726,0.714,2.899,,,,,03291a1ece1efc18f94202ca0b53",
+		"",
+	}, "\n")
+	if diff := cmp.Diff(expected, buf.String()); diff != "" {
+		t.Fatal("Unexpected output (-want +got):\n", diff)
+	}
+}
+
+func TestWriteTSVWithUnitsNoHeader(t *testing.T) {
+	var buf bytes.Buffer
+	opts := TSV()
+	opts.NoHeader = true
+	opts.Temperature = Fahrenheit
+	opts.Pressure = Hectopascal
+
+	// the MAC is written in canonical form
+	r := testReadings(t)[0]
+	r.MAC = "cb-b8-33-4c-88-4f"
+
+	w := NewWriter(&buf, opts)
+	if err := w.Write(r); err != nil {
+		t.Fatal("Write() returned error:", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal("Flush() returned error:", err)
+	}
+
+	expected := "2021-03-31T09:31:31.5Z\tCB:B8:33:4C:88:4F\t-53\t5\t75.74\t53.49\t1000.44\t0.004\t-0.004\t1.036\t2.977\t4\t66\t205\tCB:B8:33:4C:88:4F\t0512fc5394c37c0004fffc040cac364200cdcbb8334c884f\n"
+	if diff := cmp.Diff(expected, buf.String()); diff != "" {
+		t.Fatal("Unexpected output (-want +got):\n", diff)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, opts := range []Options{
+		{},
+		{Comma: ';', Temperature: Kelvin, Pressure: Hectopascal},
+		{Comma: '\t', Temperature: Fahrenheit},
+		{TagInfo: true},
+	} {
+		readings := testReadings(t)
+		tag := &ruuvi.TagInfo{Name: "Freezer 2", Location: "Kitchen, left", Labels: map[string]string{"floor": "1", "zone": "b"}}
+		readings[0].Tag = tag
+
+		var buf bytes.Buffer
+		ch := make(chan ruuvi.Reading, len(readings))
+		for _, r := range readings {
+			ch <- r
+		}
+		close(ch)
+		if err := NewWriter(&buf, opts).WriteAll(ch); err != nil {
+			t.Fatal("WriteAll() returned error:", err)
+		}
+
+		// units are taken from the header, so reader only needs to know the delimiter
+		records, err := NewReader(&buf, Options{Comma: opts.Comma}).ReadAll()
+		if err != nil {
+			t.Fatal("ReadAll() returned error:", err)
+		}
+		if len(records) != len(readings) {
+			t.Fatalf("Expected %d records, got %d", len(readings), len(records))
+		}
+
+		expected := Record{
+			Timestamp:    timestamp,
+			MAC:          "CB:B8:33:4C:88:4F",
+			RSSI:         -53,
+			Measurements: ruuvi.MeasurementsOf(readings[0].Data),
+			Raw:          readings[0].Data.RawData(),
+		}
+		if opts.TagInfo {
+			expected.Tag = tag
+		}
+		if diff := cmp.Diff(expected, records[0], float64FuzzyCompOpt); diff != "" {
+			t.Fatal("Unexpected record (-want +got):\n", diff)
+		}
+
+		invalid := records[1]
+		if invalid.Measurements.Valid != 0 || invalid.Measurements.DataFormat != 5 || invalid.Tag != nil {
+			t.Fatal("Invalid values should be read back as empty")
+		}
+
+		rawv1 := records[2]
+		if diff := cmp.Diff(ruuvi.MeasurementsOf(readings[2].Data), rawv1.Measurements, float64FuzzyCompOpt); diff != "" {
+			t.Fatal("Unexpected RAWv1 record (-want +got):\n", diff)
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	header := strings.Join(Header(Options{}), ",")
+	for name, input := range map[string]string{
+		"wrong column":   strings.Replace(header, "tag_mac", "tag", 1) + "\n",
+		"too few fields": header + "\n2021-03-31T09:31:31Z,AA:BB:CC:DD:EE:FF,-50\n",
+		"bad number":     header + "\n2021-03-31T09:31:31Z,AA:BB:CC:DD:EE:FF,-50,5,hot,,,,,,,,,,,\n",
+		"bad timestamp":  header + "\nyesterday,AA:BB:CC:DD:EE:FF,-50,5,,,,,,,,,,,,\n",
+		"bad raw":        header + "\n2021-03-31T09:31:31Z,AA:BB:CC:DD:EE:FF,-50,5,,,,,,,,,,,,xyz\n",
+		"bad label":      strings.Join(Header(Options{TagInfo: true}), ",") + "\n2021-03-31T09:31:31Z,AA:BB:CC:DD:EE:FF,-50,5,,,,,,,,,,,,,Freezer,,floor\n",
+	} {
+		_, err := NewReader(strings.NewReader(input), Options{}).ReadAll()
+		if err == nil || err == io.EOF {
+			t.Errorf("%s: expected error, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package csvio
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// Record is a typed measurement read back from CSV
+type Record struct {
+	Timestamp time.Time
+	MAC       string
+	RSSI      int
+
+	// Measurements holds the values of the measurement field columns, with the fields of non-empty cells marked valid.
+	// Temperature is always in degrees Celsius and pressure in Pa regardless of units used in the CSV.
+	Measurements ruuvi.Measurements
+
+	Raw []byte
+
+	// Tag is nil unless the CSV has tag metadata columns with a non-empty value
+	Tag *ruuvi.TagInfo
+}
+
+// Reader reads Records from CSV written by Writer
+type Reader struct {
+	r          *csv.Reader
+	opts       Options
+	headerRead bool
+	line       int
+}
+
+// NewReader returns a Reader reading from r.
+// If the input has a header, units are taken from it, otherwise units given in Options are assumed.
+func NewReader(r io.Reader, opts Options) *Reader {
+	cr := csv.NewReader(r)
+	cr.Comma = opts.comma()
+	// number of fields is checked against the header
+	cr.FieldsPerRecord = 0
+	cr.ReuseRecord = true
+	return &Reader{r: cr, opts: opts, headerRead: opts.NoHeader}
+}
+
+// Read reads the next Record. io.EOF is returned when there are no more records.
+func (r *Reader) Read() (Record, error) {
+	if !r.headerRead {
+		header, err := r.r.Read()
+		if err != nil {
+			return Record{}, err
+		}
+		r.line++
+		opts, err := unitsFromHeader(header, r.opts)
+		if err != nil {
+			return Record{}, err
+		}
+		r.opts = opts
+		r.headerRead = true
+	}
+
+	row, err := r.r.Read()
+	if err != nil {
+		return Record{}, err
+	}
+	r.line++
+	if len(row) != r.opts.columns() {
+		return Record{}, fmt.Errorf("Line %d: expected %d fields, got %d", r.line, r.opts.columns(), len(row))
+	}
+
+	rec, err := r.parse(row)
+	if err != nil {
+		return Record{}, fmt.Errorf("Line %d: %w", r.line, err)
+	}
+	return rec, nil
+}
+
+// ReadAll reads all remaining Records
+func (r *Reader) ReadAll() ([]Record, error) {
+	var records []Record
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, rec)
+	}
+}
+
+func (r *Reader) parse(row []string) (Record, error) {
+	var (
+		rec Record
+		err error
+	)
+
+	if s := row[colTimestamp]; s != "" {
+		if rec.Timestamp, err = time.Parse(time.RFC3339Nano, s); err != nil {
+			return rec, fmt.Errorf("Invalid timestamp: %w", err)
+		}
+	}
+	rec.MAC = row[colMAC]
+	if s := row[colRSSI]; s != "" {
+		if rec.RSSI, err = strconv.Atoi(s); err != nil {
+			return rec, fmt.Errorf("Invalid RSSI: %w", err)
+		}
+	}
+	if s := row[colDataFormat]; s != "" {
+		f, err := strconv.ParseInt(s, 10, 8)
+		if err != nil {
+			return rec, fmt.Errorf("Invalid data format: %w", err)
+		}
+		rec.Measurements.DataFormat = int8(f)
+	}
+
+	for _, c := range fieldColumns {
+		s := row[c.col]
+		if s == "" {
+			continue
+		}
+		if c.field == ruuvi.FieldMACAddress {
+			// canonicalize, in case the file was written with lower case or unpadded addresses
+			mac, err := ruuvi.ParseMAC(s)
+			if err != nil {
+				return rec, fmt.Errorf("Invalid %s: %w", r.opts.columnName(c.field), err)
+			}
+			rec.Measurements.MACAddress = mac
+			rec.Measurements.Set(c.field)
+			continue
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return rec, fmt.Errorf("Invalid %s: %w", r.opts.columnName(c.field), err)
+		}
+		rec.Measurements.SetValue(c.field, r.opts.convertBack(c.field, v))
+	}
+	if s := row[colRaw]; s != "" {
+		if rec.Raw, err = hex.DecodeString(strings.TrimPrefix(s, "0x")); err != nil {
+			return rec, fmt.Errorf("Invalid raw data: %w", err)
+		}
+	}
+
+	if r.opts.TagInfo && (row[colName] != "" || row[colLocation] != "" || row[colLabels] != "") {
+		rec.Tag = &ruuvi.TagInfo{Name: row[colName], Location: row[colLocation]}
+		if rec.Tag.Labels, err = parseLabels(row[colLabels]); err != nil {
+			return rec, err
+		}
+	}
+
+	return rec, nil
+}
+
+func parseLabels(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ";") {
+		i := strings.IndexByte(pair, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("Invalid label %q, expected key=value", pair)
+		}
+		labels[pair[:i]] = pair[i+1:]
+	}
+	return labels, nil
+}
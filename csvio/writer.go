@@ -0,0 +1,111 @@
+package csvio
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// Writer writes readings as CSV rows.
+// Header row is written before the first reading unless disabled in Options.
+type Writer struct {
+	w             *csv.Writer
+	opts          Options
+	headerWritten bool
+}
+
+// NewWriter returns a Writer writing to w
+func NewWriter(w io.Writer, opts Options) *Writer {
+	cw := csv.NewWriter(w)
+	cw.Comma = opts.comma()
+	return &Writer{w: cw, opts: opts, headerWritten: opts.NoHeader}
+}
+
+// Write writes a single reading. Output is buffered, call Flush to make sure it is written.
+func (w *Writer) Write(r ruuvi.Reading) error {
+	if !w.headerWritten {
+		if err := w.w.Write(Header(w.opts)); err != nil {
+			return err
+		}
+		w.headerWritten = true
+	}
+	return w.w.Write(w.row(r))
+}
+
+// WriteAll writes all readings received from the channel until it is closed, then flushes
+func (w *Writer) WriteAll(readings <-chan ruuvi.Reading) error {
+	for r := range readings {
+		if err := w.Write(r); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// Flush writes any buffered data to the underlying io.Writer
+func (w *Writer) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *Writer) row(r ruuvi.Reading) []string {
+	row := make([]string, w.opts.columns())
+
+	if !r.Timestamp.IsZero() {
+		row[colTimestamp] = r.Timestamp.UTC().Format(time.RFC3339Nano)
+	}
+	row[colMAC] = r.Address()
+	row[colRSSI] = strconv.Itoa(r.RSSI)
+
+	if w.opts.TagInfo && r.Tag != nil {
+		row[colName] = r.Tag.Name
+		row[colLocation] = r.Tag.Location
+		row[colLabels] = formatLabels(r.Tag.Labels)
+	}
+
+	d := r.Data
+	if d == nil {
+		return row
+	}
+
+	m := ruuvi.MeasurementsOf(d)
+	row[colDataFormat] = strconv.Itoa(int(m.DataFormat))
+	for _, c := range fieldColumns {
+		if !m.Valid.Has(c.field) {
+			continue
+		}
+		if c.field == ruuvi.FieldMACAddress {
+			row[c.col] = m.MACAddress.String()
+		} else {
+			row[c.col] = formatFloat(w.opts.convert(c.field, m.Value(c.field)))
+		}
+	}
+	row[colRaw] = hex.EncodeToString(d.RawData())
+
+	return row
+}
+
+// formatFloat rounds away floating point noise from unit conversions
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(math.Round(f*1e6)/1e6, 'f', -1, 64)
+}
+
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + labels[k]
+	}
+	return strings.Join(pairs, ";")
+}
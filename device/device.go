@@ -0,0 +1,176 @@
+// Package device identifies tags by reading the standard Device Information Service over GATT,
+// and keeps what is known of each tag in an Inventory.
+//
+// Behaviour depends on the firmware: RuuviTag firmware 3.x broadcasts RAWv2 data and serves its logged
+// history and configuration over the Nordic UART Service, while firmware 2.x does neither.
+//
+// Described here: https://www.bluetooth.com/specifications/specs/device-information-service-1-1/
+package device
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// UUIDs of the Device Information Service and the characteristics read from it
+const (
+	ServiceUUID          = "0000180a-0000-1000-8000-00805f9b34fb"
+	ModelNumberUUID      = "00002a24-0000-1000-8000-00805f9b34fb"
+	SerialNumberUUID     = "00002a25-0000-1000-8000-00805f9b34fb"
+	FirmwareRevisionUUID = "00002a26-0000-1000-8000-00805f9b34fb"
+	HardwareRevisionUUID = "00002a27-0000-1000-8000-00805f9b34fb"
+	SoftwareRevisionUUID = "00002a28-0000-1000-8000-00805f9b34fb"
+	ManufacturerNameUUID = "00002a29-0000-1000-8000-00805f9b34fb"
+)
+
+// ErrNotFound is wrapped by errors of a Reader for characteristics the device does not have,
+// and by the error of Read if the device has none of them
+var ErrNotFound = errors.New("Characteristic not found")
+
+// Reader reads characteristics of the Device Information Service of a connected device
+type Reader interface {
+	// ReadCharacteristic returns the value of characteristic of service, both UUIDs in the form of ServiceUUID.
+	// An error wrapping ErrNotFound is returned if the device does not have the characteristic.
+	ReadCharacteristic(ctx context.Context, service, characteristic string) ([]byte, error)
+}
+
+// Info holds the values of the Device Information Service, each empty if the device does not have it.
+// RuuviTag firmware 3.x reports e.g. manufacturer "Ruuvi Innovations Ltd", model "RuuviTag"
+// and firmware revision "Ruuvi FW v3.31.1+default".
+type Info struct {
+	Manufacturer     string `json:"manufacturer,omitempty"`
+	Model            string `json:"model,omitempty"`
+	Serial           string `json:"serial,omitempty"`
+	HardwareRevision string `json:"hardwareRevision,omitempty"`
+	FirmwareRevision string `json:"firmwareRevision,omitempty"`
+	SoftwareRevision string `json:"softwareRevision,omitempty"`
+}
+
+// characteristics lists the characteristics Read reads, in the order of their UUIDs
+var characteristics = []struct {
+	name  string
+	uuid  string
+	field func(*Info) *string
+}{
+	{"model number", ModelNumberUUID, func(i *Info) *string { return &i.Model }},
+	{"serial number", SerialNumberUUID, func(i *Info) *string { return &i.Serial }},
+	{"firmware revision", FirmwareRevisionUUID, func(i *Info) *string { return &i.FirmwareRevision }},
+	{"hardware revision", HardwareRevisionUUID, func(i *Info) *string { return &i.HardwareRevision }},
+	{"software revision", SoftwareRevisionUUID, func(i *Info) *string { return &i.SoftwareRevision }},
+	{"manufacturer name", ManufacturerNameUUID, func(i *Info) *string { return &i.Manufacturer }},
+}
+
+// Read reads the Device Information Service through r.
+// Characteristics the device does not have are left empty, but an error wrapping ErrNotFound is returned
+// if it has none of them.
+func Read(ctx context.Context, r Reader) (Info, error) {
+	var info Info
+	found := false
+	for _, c := range characteristics {
+		b, err := r.ReadCharacteristic(ctx, ServiceUUID, c.uuid)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return Info{}, fmt.Errorf("Failed to read %s: %w", c.name, err)
+		}
+		*c.field(&info) = parseString(b)
+		found = true
+	}
+	if !found {
+		return Info{}, fmt.Errorf("Device Information Service not found: %w", ErrNotFound)
+	}
+	return info, nil
+}
+
+// parseString decodes the value of a string characteristic, which some devices pad with zero bytes or spaces
+func parseString(b []byte) string {
+	s := strings.ToValidUTF8(string(b), string(unicode.ReplacementChar))
+	return strings.TrimRightFunc(s, func(r rune) bool { return r == 0 || unicode.IsSpace(r) })
+}
+
+// Version is a firmware version, e.g. 3.31.1+default
+type Version struct {
+	Major, Minor, Patch int
+	// Suffix is the rest of the version, e.g. "+default" or "-rc1"
+	Suffix string
+}
+
+// versionPattern matches a version with or without a "v" in front, e.g. "v3.31.1+default" or "2.5.9"
+var versionPattern = regexp.MustCompile(`(?:^|[^0-9.])v?([0-9]+)\.([0-9]+)(?:\.([0-9]+))?([-+][0-9A-Za-z.+-]*)?`)
+
+// ParseVersion finds the version in a firmware revision, e.g. "Ruuvi FW v3.31.1+default".
+// The patch version may be left out, e.g. "1.2", and is then zero.
+func ParseVersion(s string) (Version, bool) {
+	m := versionPattern.FindStringSubmatch(s)
+	if m == nil {
+		return Version{}, false
+	}
+	var v Version
+	var err error
+	if v.Major, err = strconv.Atoi(m[1]); err != nil {
+		return Version{}, false
+	}
+	if v.Minor, err = strconv.Atoi(m[2]); err != nil {
+		return Version{}, false
+	}
+	if m[3] != "" {
+		if v.Patch, err = strconv.Atoi(m[3]); err != nil {
+			return Version{}, false
+		}
+	}
+	v.Suffix = m[4]
+	return v, true
+}
+
+// String returns v in the form "3.31.1+default"
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d%s", v.Major, v.Minor, v.Patch, v.Suffix)
+}
+
+// AtLeast reports whether v is the given version or later, ignoring the suffix
+func (v Version) AtLeast(major, minor, patch int) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+	if v.Minor != minor {
+		return v.Minor > minor
+	}
+	return v.Patch >= patch
+}
+
+// Firmware returns the version in the firmware revision, or false if there is none
+func (i Info) Firmware() (Version, bool) {
+	return ParseVersion(i.FirmwareRevision)
+}
+
+// IsRuuviTag reports whether the device is a RuuviTag
+func (i Info) IsRuuviTag() bool {
+	return strings.HasPrefix(i.Manufacturer, "Ruuvi") && strings.HasPrefix(i.Model, "RuuviTag")
+}
+
+// SupportsHistory reports whether the device is a RuuviTag with firmware 3.x or later,
+// which logs history and serves it and its configuration over the Nordic UART Service
+func (i Info) SupportsHistory() bool {
+	return i.firmware3()
+}
+
+// DataFormat returns the data format the device broadcasts by default: RAWv2 for RuuviTag firmware 3.x and later,
+// and 0 if unknown. Earlier firmware broadcasts RAWv1 or URL formats depending on its mode.
+func (i Info) DataFormat() int8 {
+	if i.firmware3() {
+		return 5
+	}
+	return 0
+}
+
+// firmware3 reports whether the device is a RuuviTag with firmware 3.x or later
+func (i Info) firmware3() bool {
+	v, ok := i.Firmware()
+	return ok && i.IsRuuviTag() && v.AtLeast(3, 0, 0)
+}
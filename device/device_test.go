@@ -0,0 +1,218 @@
+package device
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// fakeDevice serves characteristic values of the Device Information Service
+type fakeDevice struct {
+	values map[string][]byte
+	err    error
+}
+
+func (f *fakeDevice) ReadCharacteristic(ctx context.Context, service, characteristic string) ([]byte, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if service != ServiceUUID {
+		return nil, fmt.Errorf("service %s: %w", service, ErrNotFound)
+	}
+	v, ok := f.values[characteristic]
+	if !ok {
+		return nil, fmt.Errorf("characteristic %s: %w", characteristic, ErrNotFound)
+	}
+	return v, nil
+}
+
+// ruuviTag has the values of RuuviTag firmware 3.x
+func ruuviTag() *fakeDevice {
+	return &fakeDevice{values: map[string][]byte{
+		ManufacturerNameUUID: []byte("Ruuvi Innovations Ltd"),
+		ModelNumberUUID:      []byte("RuuviTag"),
+		SerialNumberUUID:     []byte("C4E6E2C2F0A9D3B1"),
+		HardwareRevisionUUID: []byte("Check PCB\x00\x00"),
+		FirmwareRevisionUUID: []byte("Ruuvi FW v3.31.1+default\x00"),
+		SoftwareRevisionUUID: []byte("  "),
+	}}
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		device  *fakeDevice
+		want    Info
+		history bool
+		format  int8
+	}{
+		{
+			name:   "firmware 3",
+			device: ruuviTag(),
+			want: Info{
+				Manufacturer:     "Ruuvi Innovations Ltd",
+				Model:            "RuuviTag",
+				Serial:           "C4E6E2C2F0A9D3B1",
+				HardwareRevision: "Check PCB",
+				FirmwareRevision: "Ruuvi FW v3.31.1+default",
+			},
+			history: true,
+			format:  5,
+		},
+		{
+			name: "firmware 2",
+			device: &fakeDevice{values: map[string][]byte{
+				ManufacturerNameUUID: []byte("Ruuvi Innovations Ltd"),
+				ModelNumberUUID:      []byte("RuuviTag"),
+				FirmwareRevisionUUID: []byte("2.5.9"),
+			}},
+			want: Info{Manufacturer: "Ruuvi Innovations Ltd", Model: "RuuviTag", FirmwareRevision: "2.5.9"},
+		},
+		{
+			name: "other device",
+			device: &fakeDevice{values: map[string][]byte{
+				ManufacturerNameUUID: []byte("Nordic Semiconductor"),
+				FirmwareRevisionUUID: []byte("v3.1.0"),
+			}},
+			want: Info{Manufacturer: "Nordic Semiconductor", FirmwareRevision: "v3.1.0"},
+		},
+		{
+			name:   "invalid UTF-8",
+			device: &fakeDevice{values: map[string][]byte{ModelNumberUUID: {'R', 0xFF, 'T'}}},
+			want:   Info{Model: "R�T"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read(context.Background(), tt.device)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Read() mismatch (-want +got):\n%s", diff)
+			}
+			if h := got.SupportsHistory(); h != tt.history {
+				t.Errorf("SupportsHistory() = %v, want %v", h, tt.history)
+			}
+			if f := got.DataFormat(); f != tt.format {
+				t.Errorf("DataFormat() = %d, want %d", f, tt.format)
+			}
+		})
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	if _, err := Read(context.Background(), &fakeDevice{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read() of device without service, error = %v, want ErrNotFound", err)
+	}
+
+	failure := errors.New("disconnected")
+	_, err := Read(context.Background(), &fakeDevice{err: failure})
+	if !errors.Is(err, failure) || errors.Is(err, ErrNotFound) {
+		t.Errorf("Read() error = %v, want %v", err, failure)
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Version
+		ok   bool
+	}{
+		{"Ruuvi FW v3.31.1+default", Version{3, 31, 1, "+default"}, true},
+		{"v3.29.3-rc1", Version{3, 29, 3, "-rc1"}, true},
+		{"2.5.9", Version{2, 5, 9, ""}, true},
+		{"FW 1.2", Version{1, 2, 0, ""}, true},
+		{"Ruuvi FW", Version{}, false},
+		{"", Version{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseVersion(tt.s)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("ParseVersion(%q) = %v, %v, want %v, %v", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	v := Version{3, 31, 1, "+default"}
+	if s := v.String(); s != "3.31.1+default" {
+		t.Errorf("String() = %q", s)
+	}
+	for _, tt := range []struct {
+		major, minor, patch int
+		want                bool
+	}{
+		{3, 31, 1, true},
+		{3, 31, 2, false},
+		{3, 30, 9, true},
+		{3, 32, 0, false},
+		{2, 99, 99, true},
+		{4, 0, 0, false},
+	} {
+		if got := v.AtLeast(tt.major, tt.minor, tt.patch); got != tt.want {
+			t.Errorf("AtLeast(%d, %d, %d) = %v, want %v", tt.major, tt.minor, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestInventory(t *testing.T) {
+	inv, err := NewInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	inv.now = func() time.Time { return now }
+
+	mac1, _ := ruuvi.ParseMAC("CB:B8:33:4C:88:4F")
+	mac2, _ := ruuvi.ParseMAC("C5:1A:2B:3C:4D:5E")
+
+	d, err := inv.Identify(context.Background(), mac1, ruuviTag())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.MAC != mac1 || d.Model != "RuuviTag" || !d.Updated.Equal(now) {
+		t.Errorf("Identify() = %+v", d)
+	}
+	if _, err := inv.Identify(context.Background(), mac2, &fakeDevice{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Identify() error = %v, want ErrNotFound", err)
+	}
+	if _, ok := inv.Lookup(mac2); ok {
+		t.Error("device which could not be identified is in inventory")
+	}
+	inv.Put(Device{MAC: mac2, Info: Info{Model: "RuuviTag"}, Updated: now})
+
+	got, ok := inv.Lookup(mac1)
+	if !ok || got != d {
+		t.Errorf("Lookup() = %+v, %v, want %+v", got, ok, d)
+	}
+
+	var buf bytes.Buffer
+	if _, err := inv.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"firmwareRevision": "Ruuvi FW v3.31.1+default"`) {
+		t.Errorf("WriteTo() wrote\n%s", buf.String())
+	}
+	parsed, err := ParseInventory(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Device{{MAC: mac2, Info: Info{Model: "RuuviTag"}, Updated: now}, d}
+	if diff := cmp.Diff(want, parsed.Devices()); diff != "" {
+		t.Errorf("Devices() mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := NewInventory(d, d); err == nil {
+		t.Error("NewInventory() accepted duplicate devices")
+	}
+	if _, err := ParseInventory(strings.NewReader(`{"devices": [{"mac": "CB:B8:33:4C:88:4F", "colour": "white"}]}`)); err == nil {
+		t.Error("ParseInventory() accepted unknown field")
+	}
+}
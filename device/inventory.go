@@ -0,0 +1,134 @@
+package device
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// Device is what is known of a device
+type Device struct {
+	// MAC address of the device, e.g. "CB:B8:33:4C:88:4F"
+	MAC ruuvi.MAC `json:"mac"`
+	Info
+	// Updated is the time Info was read
+	Updated time.Time `json:"updated"`
+}
+
+// Inventory holds the devices which have been identified, by MAC address.
+// It is stored as JSON in the same layout as registry configs:
+//
+//	{
+//		"devices": [
+//			{
+//				"mac": "CB:B8:33:4C:88:4F",
+//				"manufacturer": "Ruuvi Innovations Ltd",
+//				"model": "RuuviTag",
+//				"firmwareRevision": "Ruuvi FW v3.31.1+default",
+//				"updated": "2021-06-01T12:00:00Z"
+//			}
+//		]
+//	}
+//
+// Inventory is safe for concurrent use.
+type Inventory struct {
+	mu      sync.Mutex
+	devices map[ruuvi.MAC]Device
+
+	// now returns the time identified devices are updated at
+	now func() time.Time
+}
+
+type inventory struct {
+	Devices []Device `json:"devices"`
+}
+
+// NewInventory returns an Inventory containing given devices
+func NewInventory(devices ...Device) (*Inventory, error) {
+	inv := &Inventory{devices: make(map[ruuvi.MAC]Device, len(devices)), now: time.Now}
+	for _, d := range devices {
+		if _, exists := inv.devices[d.MAC]; exists {
+			return nil, fmt.Errorf("Device %s is listed more than once", d.MAC)
+		}
+		inv.devices[d.MAC] = d
+	}
+	return inv, nil
+}
+
+// ParseInventory reads an inventory written by WriteTo from r
+func ParseInventory(r io.Reader) (*Inventory, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var c inventory
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("Invalid inventory: %w", err)
+	}
+	return NewInventory(c.Devices...)
+}
+
+// LoadInventory reads an inventory from the file at path
+func LoadInventory(path string) (*Inventory, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseInventory(f)
+}
+
+// WriteTo writes the inventory to w as indented JSON, devices sorted by MAC
+func (inv *Inventory) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(inventory{Devices: inv.Devices()}, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+// Identify reads the Device Information Service of the device with given MAC address through r,
+// and stores the result in the inventory
+func (inv *Inventory) Identify(ctx context.Context, mac ruuvi.MAC, r Reader) (Device, error) {
+	info, err := Read(ctx, r)
+	if err != nil {
+		return Device{}, fmt.Errorf("Failed to identify %s: %w", mac, err)
+	}
+	d := Device{MAC: mac, Info: info, Updated: inv.now()}
+	inv.Put(d)
+	return d, nil
+}
+
+// Put adds d to the inventory, replacing the device with the same MAC address
+func (inv *Inventory) Put(d Device) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.devices[d.MAC] = d
+}
+
+// Lookup returns the device with given MAC address
+func (inv *Inventory) Lookup(mac ruuvi.MAC) (Device, bool) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	d, ok := inv.devices[mac]
+	return d, ok
+}
+
+// Devices returns all devices in the inventory, sorted by MAC
+func (inv *Inventory) Devices() []Device {
+	inv.mu.Lock()
+	devices := make([]Device, 0, len(inv.devices))
+	for _, d := range inv.devices {
+		devices = append(devices, d)
+	}
+	inv.mu.Unlock()
+	sort.Slice(devices, func(i, j int) bool { return bytes.Compare(devices[i].MAC[:], devices[j].MAC[:]) < 0 })
+	return devices
+}
@@ -0,0 +1,102 @@
+package dfu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// MaxNameLength is the maximum length of the name the bootloader advertises with
+const MaxNameLength = 20
+
+// ErrButtonless is wrapped by errors returned when the application rejects a buttonless DFU request
+var ErrButtonless = errors.New("Buttonless DFU request rejected")
+
+const (
+	buttonlessEnterBootloader byte = 0x01
+	buttonlessSetName         byte = 0x02
+	buttonlessResponse        byte = 0x20
+	buttonlessSuccess         byte = 0x01
+)
+
+var buttonlessResults = map[byte]string{
+	0x02: "opcode not supported",
+	0x04: "operation failed",
+	0x05: "invalid advertisement name",
+	0x06: "busy",
+	0x07: "not bonded",
+}
+
+// Buttonless sends requests to the buttonless DFU characteristic of an application, see ButtonlessUUID,
+// and receives the answers, with indications enabled
+type Buttonless interface {
+	// Send writes b to the characteristic
+	Send(ctx context.Context, b []byte) error
+
+	// Receive returns the next indication, waiting until one arrives or ctx is done.
+	// io.EOF is returned when the connection has been closed.
+	Receive(ctx context.Context) ([]byte, error)
+}
+
+// EnterBootloader restarts the device into its bootloader through the buttonless DFU service of its application.
+// If name is not empty, the bootloader advertises with it, so that the device can be told apart from others in DFU mode.
+// The device then disconnects, and the bootloader advertises with the address BootloaderAddress returns.
+func EnterBootloader(ctx context.Context, b Buttonless, name string) error {
+	if name != "" {
+		if len(name) > MaxNameLength {
+			return fmt.Errorf("Bootloader name %q is longer than %d bytes", name, MaxNameLength)
+		}
+		req := append([]byte{buttonlessSetName, byte(len(name))}, name...)
+		if err := buttonlessRequest(ctx, b, req); err != nil {
+			return err
+		}
+	}
+	err := buttonlessRequest(ctx, b, []byte{buttonlessEnterBootloader})
+	if errors.Is(err, io.EOF) {
+		// the device may restart before the indication has been received
+		return nil
+	}
+	return err
+}
+
+// buttonlessRequest sends req and waits for a successful response
+func buttonlessRequest(ctx context.Context, b Buttonless, req []byte) error {
+	if err := b.Send(ctx, req); err != nil {
+		return fmt.Errorf("Failed to send buttonless DFU request: %w", err)
+	}
+	rctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	for {
+		resp, err := b.Receive(rctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if rctx.Err() != nil {
+				return ErrTimeout
+			}
+			return err
+		}
+		if len(resp) < 3 || resp[0] != buttonlessResponse || resp[1] != req[0] {
+			continue
+		}
+		if resp[2] == buttonlessSuccess {
+			return nil
+		}
+		reason, ok := buttonlessResults[resp[2]]
+		if !ok {
+			reason = fmt.Sprintf("result 0x%02X", resp[2])
+		}
+		return fmt.Errorf("%w: %s", ErrButtonless, reason)
+	}
+}
+
+// BootloaderAddress returns the address the bootloader of a device without bonds advertises with:
+// the address of the application with one added to its last byte, which wraps around without carrying
+func BootloaderAddress(mac ruuvi.MAC) ruuvi.MAC {
+	mac[len(mac)-1]++
+	return mac
+}
@@ -0,0 +1,318 @@
+package dfu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+)
+
+const (
+	// DefaultPacketSize is the size of packets by default, the most that fits the default ATT MTU of 23
+	DefaultPacketSize = 20
+	// DefaultPRN is the number of packets between packet receipt notifications by default
+	DefaultPRN = 12
+	// DefaultTimeout is how long Client waits for an answer by default
+	DefaultTimeout = 10 * time.Second
+	// DefaultRetries is how many times Client sends an object again after a checksum mismatch by default
+	DefaultRetries = 3
+)
+
+// Progress reports how much of the firmware of an image the bootloader has received
+type Progress struct {
+	// Image is the type of the image, e.g. ImageApplication
+	Image string
+	// Sent is the number of bytes the bootloader has confirmed with a checksum
+	Sent int
+	// Total is the size of the firmware
+	Total int
+}
+
+// Client sends firmware to a bootloader over a Secure DFU connection
+type Client struct {
+	t Transport
+
+	// PacketSize is the size of the packets written to the packet characteristic, DefaultPacketSize by default.
+	// It can be raised to the ATT MTU minus 3 if a larger MTU has been negotiated.
+	PacketSize int
+	// PRN is the number of packets between packet receipt notifications, DefaultPRN by default, 0 to disable them
+	PRN int
+	// Timeout is how long to wait for an answer to a request, DefaultTimeout by default
+	Timeout time.Duration
+	// Retries is how many times to send an object again after a checksum mismatch, DefaultRetries by default
+	Retries int
+
+	// Progress is called, if set, whenever the bootloader confirms more of the firmware
+	Progress func(Progress)
+}
+
+// NewClient returns a Client using connection t
+func NewClient(t Transport) *Client {
+	return &Client{t: t, PacketSize: DefaultPacketSize, PRN: DefaultPRN, Timeout: DefaultTimeout, Retries: DefaultRetries}
+}
+
+// object is the init packet or firmware of an image, being sent
+type object struct {
+	typ   ObjectType
+	image string
+	data  []byte
+
+	// offset is the number of bytes of data sent, and crc their CRC32
+	offset int
+	crc    uint32
+	// packets is the number of packets sent since the object was selected or created, for PRN
+	packets int
+}
+
+// seek sets the offset of the object after it has been selected or created
+func (o *object) seek(offset int) {
+	o.offset = offset
+	o.crc = crc32.ChecksumIEEE(o.data[:offset])
+	o.packets = 0
+}
+
+// Send sends img to the bootloader, resuming an earlier transfer of the same image if the bootloader has part of it.
+// The bootloader validates the image and restarts after it has been sent: into the application if img is one,
+// otherwise into the bootloader again, to receive the next image of the package over a new connection.
+//
+// If the transfer is interrupted, e.g. by a lost connection, Send can be called again with a new connection to resume it.
+func (c *Client) Send(ctx context.Context, img Image) error {
+	prn := c.PRN
+	if prn < 0 {
+		prn = 0
+	}
+	if _, err := c.request(ctx, setPRNRequest(prn), OpSetPRN); err != nil {
+		return err
+	}
+	if err := c.sendInit(ctx, img); err != nil {
+		return fmt.Errorf("Failed to send init packet of %s: %w", img.Type, err)
+	}
+	if err := c.sendFirmware(ctx, img); err != nil {
+		return fmt.Errorf("Failed to send %s: %w", img.Type, err)
+	}
+	return nil
+}
+
+// sendInit sends the init packet of img as a command object.
+// Executing the same init packet again is harmless: the bootloader keeps the firmware it has received of the image.
+func (c *Client) sendInit(ctx context.Context, img Image) error {
+	o := &object{typ: ObjectCommand, image: img.Type, data: img.Init}
+	info, err := c.selectObject(ctx, o.typ)
+	if err != nil {
+		return err
+	}
+	if len(o.data) > info.MaxSize {
+		return fmt.Errorf("Init packet of %d bytes is larger than the maximum %d", len(o.data), info.MaxSize)
+	}
+	if c.resumable(o, info) {
+		o.seek(info.Offset)
+		if err := c.resume(ctx, o, len(o.data)); !errors.Is(err, ErrChecksum) {
+			return err
+		}
+	}
+	return c.sendObject(ctx, o, 0, len(o.data))
+}
+
+// sendFirmware sends the firmware of img as data objects
+func (c *Client) sendFirmware(ctx context.Context, img Image) error {
+	o := &object{typ: ObjectData, image: img.Type, data: img.Firmware}
+	info, err := c.selectObject(ctx, o.typ)
+	if err != nil {
+		return err
+	}
+	if info.MaxSize <= 0 {
+		return fmt.Errorf("Invalid maximum object size %d", info.MaxSize)
+	}
+
+	total := len(o.data)
+	offset := 0
+	if info.Offset > 0 {
+		// the objects before the one the transfer stopped in have been executed
+		start := (info.Offset - 1) / info.MaxSize * info.MaxSize
+		if start >= total {
+			return fmt.Errorf("DFU target has %d bytes of firmware, more than the %d of the image", info.Offset, total)
+		}
+		end := min(start+info.MaxSize, total)
+		offset = start
+		if c.resumable(o, info) {
+			o.seek(info.Offset)
+			err := c.resume(ctx, o, end)
+			if err == nil {
+				offset = end
+			} else if !errors.Is(err, ErrChecksum) {
+				return err
+			}
+		}
+		c.report(o, offset)
+	}
+
+	for offset < total {
+		end := min(offset+info.MaxSize, total)
+		if err := c.sendObject(ctx, o, offset, end); err != nil {
+			return err
+		}
+		offset = end
+		c.report(o, offset)
+	}
+	return nil
+}
+
+// resumable reports whether the data the bootloader has of the selected object is the beginning of o
+func (c *Client) resumable(o *object, info objectInfo) bool {
+	return info.Offset > 0 && info.Offset <= len(o.data) && info.CRC == crc32.ChecksumIEEE(o.data[:info.Offset])
+}
+
+// resume sends the rest of the selected object up to end, verifies and executes it.
+// ErrChecksum is returned if the object must be sent again.
+func (c *Client) resume(ctx context.Context, o *object, end int) error {
+	complete := o.offset == end
+	if err := c.write(ctx, o, end); err != nil {
+		return err
+	}
+	if err := c.verify(ctx, o); err != nil {
+		return err
+	}
+	err := c.execute(ctx)
+	var re *ResponseError
+	if complete && errors.As(err, &re) && re.Result == ResultOperationNotPermitted {
+		// the object was executed before the transfer was interrupted
+		return nil
+	}
+	return err
+}
+
+// sendObject creates an object of o from start to end, sends, verifies and executes it,
+// sending it again up to Retries times if the checksum does not match
+func (c *Client) sendObject(ctx context.Context, o *object, start, end int) error {
+	for attempt := 0; ; attempt++ {
+		if _, err := c.request(ctx, createRequest(o.typ, end-start), OpCreate); err != nil {
+			return err
+		}
+		o.seek(start)
+		err := c.write(ctx, o, end)
+		if err == nil {
+			err = c.verify(ctx, o)
+		}
+		if errors.Is(err, ErrChecksum) && attempt < c.Retries {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		return c.execute(ctx)
+	}
+}
+
+// write sends the data of o up to end in packets, checking the packet receipt notifications of data objects
+func (c *Client) write(ctx context.Context, o *object, end int) error {
+	size := c.PacketSize
+	if size <= 0 {
+		size = DefaultPacketSize
+	}
+	for o.offset < end {
+		p := o.data[o.offset:min(o.offset+size, end)]
+		if err := c.t.WritePacket(ctx, p); err != nil {
+			return fmt.Errorf("Failed to write packet: %w", err)
+		}
+		o.offset += len(p)
+		o.crc = crc32.Update(o.crc, crc32.IEEETable, p)
+		o.packets++
+
+		if o.typ == ObjectData && c.PRN > 0 && o.packets%c.PRN == 0 {
+			b, err := c.response(ctx, OpCalculateChecksum)
+			if err != nil {
+				return err
+			}
+			if err := c.check(o, b); err != nil {
+				return err
+			}
+			c.report(o, o.offset)
+		}
+	}
+	return nil
+}
+
+// verify checks that the bootloader has received the data of o up to its offset
+func (c *Client) verify(ctx context.Context, o *object) error {
+	b, err := c.request(ctx, []byte{byte(OpCalculateChecksum)}, OpCalculateChecksum)
+	if err != nil {
+		return err
+	}
+	return c.check(o, b)
+}
+
+// check compares the payload b of a checksum response with the data sent of o
+func (c *Client) check(o *object, b []byte) error {
+	cs, err := parseChecksum(b)
+	if err != nil {
+		return err
+	}
+	if cs.Offset != o.offset || cs.CRC != o.crc {
+		return fmt.Errorf("%w: DFU target has %d bytes with CRC32 %08X, sent %d bytes with CRC32 %08X",
+			ErrChecksum, cs.Offset, cs.CRC, o.offset, o.crc)
+	}
+	return nil
+}
+
+func (c *Client) selectObject(ctx context.Context, t ObjectType) (objectInfo, error) {
+	b, err := c.request(ctx, selectRequest(t), OpSelect)
+	if err != nil {
+		return objectInfo{}, err
+	}
+	return parseObjectInfo(b)
+}
+
+func (c *Client) execute(ctx context.Context) error {
+	_, err := c.request(ctx, []byte{byte(OpExecute)}, OpExecute)
+	return err
+}
+
+// report calls Progress with the number of bytes of firmware confirmed
+func (c *Client) report(o *object, sent int) {
+	if c.Progress != nil && o.typ == ObjectData {
+		c.Progress(Progress{Image: o.image, Sent: sent, Total: len(o.data)})
+	}
+}
+
+// request writes req to the control point and returns the payload of the successful response
+func (c *Client) request(ctx context.Context, req []byte, op Opcode) ([]byte, error) {
+	if err := c.t.WriteControl(ctx, req); err != nil {
+		return nil, fmt.Errorf("Failed to send %v: %w", op, err)
+	}
+	return c.response(ctx, op)
+}
+
+// response returns the payload of the next response to op, skipping other notifications
+func (c *Client) response(ctx context.Context, op Opcode) ([]byte, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	rctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		b, err := c.t.ReceiveControl(rctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if rctx.Err() != nil {
+				return nil, ErrTimeout
+			}
+			return nil, err
+		}
+		if len(b) < 2 || Opcode(b[0]) != OpResponse || Opcode(b[1]) != op {
+			continue
+		}
+		return parseResponse(b, op)
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
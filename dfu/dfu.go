@@ -0,0 +1,280 @@
+// Package dfu updates the firmware of RuuviTags, and other devices with a Nordic Secure DFU bootloader, over BLE.
+//
+// The device is first restarted into its bootloader, either by holding button B of a RuuviTag while pressing R,
+// or through the buttonless DFU service if the application has one, see EnterBootloader.
+// The bootloader then receives the images of a firmware package, see Package, through two characteristics:
+// requests are written to the control point, which answers with notifications, and the init packet and firmware
+// are written to the packet characteristic in objects of at most the size the bootloader allows.
+// Each object is verified with a CRC32 of everything sent so far before it is executed.
+//
+//	select:    06 <type>                 60 06 01 <max size> <offset> <crc>
+//	create:    01 <type> <size>          60 01 01
+//	set PRN:   02 <packets>              60 02 01
+//	checksum:  03                        60 03 01 <offset> <crc>
+//	execute:   04                        60 04 01
+//
+// Values are little endian 32 bit integers, except for the 16 bit PRN. With packet receipt notifications (PRN)
+// enabled, the bootloader also sends a checksum after every given number of packets, so that errors are detected early.
+// Selecting an object returns how much of it the bootloader already has, which Client uses to resume interrupted transfers.
+//
+// Described here: https://infocenter.nordicsemi.com/topic/sdk_nrf5_v17.1.0/lib_dfu_transport_ble.html
+package dfu
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// UUIDs of the Secure DFU service and its characteristics
+const (
+	ServiceUUID = "0000fe59-0000-1000-8000-00805f9b34fb"
+	// ControlPointUUID is the characteristic requests are written to and answered from
+	ControlPointUUID = "8ec90001-f315-4f60-9fb8-838830daea50"
+	// PacketUUID is the characteristic the init packet and firmware are written to
+	PacketUUID = "8ec90002-f315-4f60-9fb8-838830daea50"
+	// ButtonlessUUID is the characteristic of the buttonless DFU service of applications, for devices without bonds
+	ButtonlessUUID = "8ec90003-f315-4f60-9fb8-838830daea50"
+)
+
+// Transport writes requests and data to the Secure DFU service of a bootloader and receives the answers,
+// with notifications of the control point enabled
+type Transport interface {
+	// WriteControl writes b to the control point characteristic, with response
+	WriteControl(ctx context.Context, b []byte) error
+
+	// WritePacket writes b to the packet characteristic, without response
+	WritePacket(ctx context.Context, b []byte) error
+
+	// ReceiveControl returns the next notification of the control point characteristic, waiting until one arrives or ctx is done.
+	// Notifications must be queued between calls, so that none are lost while the caller processes the previous one.
+	// io.EOF is returned when the connection has been closed.
+	ReceiveControl(ctx context.Context) ([]byte, error)
+}
+
+// Opcode is the type of a control point request
+type Opcode byte
+
+const (
+	OpCreate            Opcode = 0x01
+	OpSetPRN            Opcode = 0x02
+	OpCalculateChecksum Opcode = 0x03
+	OpExecute           Opcode = 0x04
+	OpSelect            Opcode = 0x06
+	OpResponse          Opcode = 0x60
+)
+
+var opcodeNames = map[Opcode]string{
+	OpCreate:            "create",
+	OpSetPRN:            "set-prn",
+	OpCalculateChecksum: "calculate-checksum",
+	OpExecute:           "execute",
+	OpSelect:            "select",
+	OpResponse:          "response",
+}
+
+// String returns the name of o, or its value in hex if it is not documented
+func (o Opcode) String() string {
+	if name, ok := opcodeNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("Opcode(0x%02X)", byte(o))
+}
+
+// ObjectType is the type of an object
+type ObjectType byte
+
+const (
+	// ObjectCommand holds the init packet
+	ObjectCommand ObjectType = 0x01
+	// ObjectData holds part of the firmware
+	ObjectData ObjectType = 0x02
+)
+
+// String returns the name of t
+func (t ObjectType) String() string {
+	switch t {
+	case ObjectCommand:
+		return "command"
+	case ObjectData:
+		return "data"
+	}
+	return fmt.Sprintf("ObjectType(0x%02X)", byte(t))
+}
+
+// Result is the result code of a response
+type Result byte
+
+const (
+	ResultInvalid               Result = 0x00
+	ResultSuccess               Result = 0x01
+	ResultOpNotSupported        Result = 0x02
+	ResultInvalidParameter      Result = 0x03
+	ResultInsufficientResources Result = 0x04
+	ResultInvalidObject         Result = 0x05
+	ResultUnsupportedType       Result = 0x07
+	ResultOperationNotPermitted Result = 0x08
+	ResultOperationFailed       Result = 0x0A
+	// ResultExtendedError is followed by an ExtendedError
+	ResultExtendedError Result = 0x0B
+)
+
+var resultNames = map[Result]string{
+	ResultInvalid:               "invalid opcode",
+	ResultSuccess:               "success",
+	ResultOpNotSupported:        "opcode not supported",
+	ResultInvalidParameter:      "invalid parameter",
+	ResultInsufficientResources: "insufficient resources",
+	ResultInvalidObject:         "invalid object",
+	ResultUnsupportedType:       "unsupported type",
+	ResultOperationNotPermitted: "operation not permitted",
+	ResultOperationFailed:       "operation failed",
+	ResultExtendedError:         "extended error",
+}
+
+// String returns the description of r, or its value in hex if it is not documented
+func (r Result) String() string {
+	if name, ok := resultNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("Result(0x%02X)", byte(r))
+}
+
+// ExtendedError tells why the bootloader rejected a request, mostly the init packet
+type ExtendedError byte
+
+const (
+	ExtNoError            ExtendedError = 0x00
+	ExtInvalidErrorCode   ExtendedError = 0x01
+	ExtWrongCommandFormat ExtendedError = 0x02
+	ExtUnknownCommand     ExtendedError = 0x03
+	ExtInitCommandInvalid ExtendedError = 0x04
+	ExtFWVersionFailure   ExtendedError = 0x05
+	ExtHWVersionFailure   ExtendedError = 0x06
+	ExtSDVersionFailure   ExtendedError = 0x07
+	ExtSignatureMissing   ExtendedError = 0x08
+	ExtWrongHashType      ExtendedError = 0x09
+	ExtHashFailed         ExtendedError = 0x0A
+	ExtWrongSignatureType ExtendedError = 0x0B
+	ExtVerificationFailed ExtendedError = 0x0C
+	ExtInsufficientSpace  ExtendedError = 0x0D
+)
+
+var extendedErrorNames = map[ExtendedError]string{
+	ExtNoError:            "no error",
+	ExtInvalidErrorCode:   "invalid error code",
+	ExtWrongCommandFormat: "wrong command format",
+	ExtUnknownCommand:     "unknown command",
+	ExtInitCommandInvalid: "init command invalid",
+	ExtFWVersionFailure:   "firmware version too low",
+	ExtHWVersionFailure:   "hardware version mismatch",
+	ExtSDVersionFailure:   "SoftDevice version mismatch",
+	ExtSignatureMissing:   "signature missing",
+	ExtWrongHashType:      "wrong hash type",
+	ExtHashFailed:         "hash failed",
+	ExtWrongSignatureType: "wrong signature type",
+	ExtVerificationFailed: "verification failed",
+	ExtInsufficientSpace:  "insufficient space",
+}
+
+// String returns the description of e, or its value in hex if it is not documented
+func (e ExtendedError) String() string {
+	if name, ok := extendedErrorNames[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("ExtendedError(0x%02X)", byte(e))
+}
+
+var (
+	// ErrTimeout is returned when the bootloader does not answer in time
+	ErrTimeout = errors.New("Timed out waiting for answer from DFU target")
+
+	// ErrChecksum is returned when the offset or CRC32 reported by the bootloader does not match the data sent,
+	// and retrying the object did not help
+	ErrChecksum = errors.New("Checksum mismatch")
+)
+
+// ResponseError is returned when the bootloader answers a request with an error
+type ResponseError struct {
+	Op     Opcode
+	Result Result
+	// Extended is set if Result is ResultExtendedError
+	Extended ExtendedError
+}
+
+func (e *ResponseError) Error() string {
+	if e.Result == ResultExtendedError {
+		return fmt.Sprintf("DFU target rejected %v: %v", e.Op, e.Extended)
+	}
+	return fmt.Sprintf("DFU target rejected %v: %v", e.Op, e.Result)
+}
+
+// objectInfo is the answer to a select request
+type objectInfo struct {
+	MaxSize int
+	Offset  int
+	CRC     uint32
+}
+
+// checksum is the answer to a checksum request, and a packet receipt notification
+type checksum struct {
+	Offset int
+	CRC    uint32
+}
+
+func selectRequest(t ObjectType) []byte {
+	return []byte{byte(OpSelect), byte(t)}
+}
+
+func createRequest(t ObjectType, size int) []byte {
+	b := []byte{byte(OpCreate), byte(t), 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(b[2:], uint32(size))
+	return b
+}
+
+func setPRNRequest(packets int) []byte {
+	b := []byte{byte(OpSetPRN), 0, 0}
+	binary.LittleEndian.PutUint16(b[1:], uint16(packets))
+	return b
+}
+
+// parseResponse checks that b is a successful response to op and returns its payload
+func parseResponse(b []byte, op Opcode) ([]byte, error) {
+	if len(b) < 3 || Opcode(b[0]) != OpResponse || Opcode(b[1]) != op {
+		return nil, fmt.Errorf("Invalid response to %v: %X", op, b)
+	}
+	switch r := Result(b[2]); r {
+	case ResultSuccess:
+		return b[3:], nil
+	case ResultExtendedError:
+		e := &ResponseError{Op: op, Result: r}
+		if len(b) > 3 {
+			e.Extended = ExtendedError(b[3])
+		}
+		return nil, e
+	default:
+		return nil, &ResponseError{Op: op, Result: r}
+	}
+}
+
+func parseObjectInfo(b []byte) (objectInfo, error) {
+	if len(b) < 12 {
+		return objectInfo{}, fmt.Errorf("Invalid response to %v: %X", OpSelect, b)
+	}
+	return objectInfo{
+		MaxSize: int(binary.LittleEndian.Uint32(b[0:])),
+		Offset:  int(binary.LittleEndian.Uint32(b[4:])),
+		CRC:     binary.LittleEndian.Uint32(b[8:]),
+	}, nil
+}
+
+func parseChecksum(b []byte) (checksum, error) {
+	if len(b) < 8 {
+		return checksum{}, fmt.Errorf("Invalid response to %v: %X", OpCalculateChecksum, b)
+	}
+	return checksum{
+		Offset: int(binary.LittleEndian.Uint32(b[0:])),
+		CRC:    binary.LittleEndian.Uint32(b[4:]),
+	}, nil
+}
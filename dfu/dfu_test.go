@@ -0,0 +1,563 @@
+package dfu
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+var errDisconnected = errors.New("disconnected")
+
+// fakeTarget is a Secure DFU bootloader. Its init packets are "init" followed by the size and CRC32 of the firmware,
+// which is validated when the last data object is executed.
+type fakeTarget struct {
+	maxCommand, maxData int
+
+	prn     int
+	packets int
+	current ObjectType
+
+	command  []byte
+	executed []byte // init packet executed
+
+	firmware    []byte
+	done        int // bytes of firmware executed
+	objectStart int
+	objectSize  int
+
+	// activated is the firmware which passed validation
+	activated []byte
+
+	// dataPackets counts the data packets received, corrupt lists the ones to corrupt,
+	// and the connection is lost when writing packet number disconnectAt
+	dataPackets  int
+	corrupt      map[int]bool
+	disconnectAt int
+	silent       bool
+
+	notifications chan []byte
+}
+
+func newFakeTarget() *fakeTarget {
+	return &fakeTarget{maxCommand: 256, maxData: 256, notifications: make(chan []byte, 64)}
+}
+
+func (f *fakeTarget) respond(op Opcode, r Result, payload ...uint32) {
+	b := []byte{byte(OpResponse), byte(op), byte(r)}
+	for _, v := range payload {
+		b = appendUint32(b, v)
+	}
+	f.notifications <- b
+}
+
+func (f *fakeTarget) WriteControl(ctx context.Context, b []byte) error {
+	if f.silent {
+		return nil
+	}
+	// stray notification, which the client must skip
+	f.notifications <- []byte{0x60}
+
+	switch op := Opcode(b[0]); op {
+	case OpSetPRN:
+		f.prn = int(binary.LittleEndian.Uint16(b[1:]))
+		f.packets = 0
+		f.respond(op, ResultSuccess)
+	case OpSelect:
+		f.current = ObjectType(b[1])
+		f.packets = 0
+		switch f.current {
+		case ObjectCommand:
+			f.respond(op, ResultSuccess, uint32(f.maxCommand), uint32(len(f.command)), crc32.ChecksumIEEE(f.command))
+		case ObjectData:
+			f.respond(op, ResultSuccess, uint32(f.maxData), uint32(len(f.firmware)), crc32.ChecksumIEEE(f.firmware))
+		default:
+			f.respond(op, ResultUnsupportedType)
+		}
+	case OpCreate:
+		size := int(binary.LittleEndian.Uint32(b[2:]))
+		switch ObjectType(b[1]) {
+		case ObjectCommand:
+			if size > f.maxCommand {
+				f.respond(op, ResultInsufficientResources)
+				return nil
+			}
+			f.command = []byte{}
+		case ObjectData:
+			if f.executed == nil {
+				f.respond(op, ResultOperationNotPermitted)
+				return nil
+			}
+			if size > f.maxData {
+				f.respond(op, ResultInsufficientResources)
+				return nil
+			}
+			// data which has not been executed is discarded
+			f.firmware = f.firmware[:f.done]
+			f.objectStart, f.objectSize = f.done, size
+		}
+		f.current = ObjectType(b[1])
+		f.packets = 0
+		f.respond(op, ResultSuccess)
+	case OpCalculateChecksum:
+		data := f.command
+		if f.current == ObjectData {
+			data = f.firmware
+		}
+		f.respond(op, ResultSuccess, uint32(len(data)), crc32.ChecksumIEEE(data))
+	case OpExecute:
+		if f.current == ObjectCommand {
+			f.executeCommand()
+		} else {
+			f.executeData()
+		}
+	default:
+		f.respond(op, ResultOpNotSupported)
+	}
+	return nil
+}
+
+func (f *fakeTarget) executeCommand() {
+	if len(f.command) != 12 || string(f.command[:4]) != "init" {
+		f.notifications <- []byte{byte(OpResponse), byte(OpExecute), byte(ResultExtendedError), byte(ExtInitCommandInvalid)}
+		return
+	}
+	if !bytes.Equal(f.command, f.executed) {
+		// a new image, the firmware received so far is discarded
+		f.executed = append([]byte(nil), f.command...)
+		f.firmware, f.done = nil, 0
+	}
+	f.respond(OpExecute, ResultSuccess)
+}
+
+func (f *fakeTarget) executeData() {
+	if len(f.firmware) == f.done || len(f.firmware)-f.objectStart != f.objectSize {
+		f.respond(OpExecute, ResultOperationNotPermitted)
+		return
+	}
+	f.done = len(f.firmware)
+	if f.done == int(binary.LittleEndian.Uint32(f.executed[4:])) {
+		if crc32.ChecksumIEEE(f.firmware) != binary.LittleEndian.Uint32(f.executed[8:]) {
+			f.notifications <- []byte{byte(OpResponse), byte(OpExecute), byte(ResultExtendedError), byte(ExtHashFailed)}
+			return
+		}
+		f.activated = append([]byte(nil), f.firmware...)
+	}
+	f.respond(OpExecute, ResultSuccess)
+}
+
+func (f *fakeTarget) WritePacket(ctx context.Context, b []byte) error {
+	if f.current == ObjectCommand {
+		f.command = append(f.command, b...)
+		return nil
+	}
+	f.dataPackets++
+	if f.dataPackets == f.disconnectAt {
+		return errDisconnected
+	}
+	if f.corrupt[f.dataPackets] {
+		b = append([]byte{b[0] ^ 0xFF}, b[1:]...)
+	}
+	f.firmware = append(f.firmware, b...)
+	f.packets++
+	if f.prn > 0 && f.packets%f.prn == 0 {
+		f.respond(OpCalculateChecksum, ResultSuccess, uint32(len(f.firmware)), crc32.ChecksumIEEE(f.firmware))
+	}
+	return nil
+}
+
+func (f *fakeTarget) ReceiveControl(ctx context.Context) ([]byte, error) {
+	select {
+	case b := <-f.notifications:
+		return b, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var a [4]byte
+	binary.LittleEndian.PutUint32(a[:], v)
+	return append(b, a[:]...)
+}
+
+func testImage(size int) Image {
+	fw := make([]byte, size)
+	for i := range fw {
+		fw[i] = byte(i*7 + i/256)
+	}
+	init := []byte("init")
+	init = appendUint32(init, uint32(size))
+	init = appendUint32(init, crc32.ChecksumIEEE(fw))
+	return Image{Type: ImageApplication, Init: init, Firmware: fw}
+}
+
+func TestMessages(t *testing.T) {
+	for _, tt := range []struct {
+		got, want []byte
+	}{
+		{selectRequest(ObjectData), []byte{0x06, 0x02}},
+		{createRequest(ObjectCommand, 141), []byte{0x01, 0x01, 0x8D, 0x00, 0x00, 0x00}},
+		{createRequest(ObjectData, 4096), []byte{0x01, 0x02, 0x00, 0x10, 0x00, 0x00}},
+		{setPRNRequest(12), []byte{0x02, 0x0C, 0x00}},
+	} {
+		if !bytes.Equal(tt.got, tt.want) {
+			t.Errorf("request = %X, want %X", tt.got, tt.want)
+		}
+	}
+
+	b, err := parseResponse([]byte{0x60, 0x06, 0x01, 0x00, 0x10, 0, 0, 0x20, 0, 0, 0, 0x78, 0x56, 0x34, 0x12}, OpSelect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := parseObjectInfo(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (objectInfo{MaxSize: 4096, Offset: 32, CRC: 0x12345678}); info != want {
+		t.Errorf("parseObjectInfo() = %+v, want %+v", info, want)
+	}
+
+	_, err = parseResponse([]byte{0x60, 0x04, 0x0B, 0x05}, OpExecute)
+	want := &ResponseError{Op: OpExecute, Result: ResultExtendedError, Extended: ExtFWVersionFailure}
+	if diff := cmp.Diff(want, err); diff != "" {
+		t.Errorf("parseResponse() error mismatch (-want +got):\n%s", diff)
+	}
+	if s := err.Error(); s != "DFU target rejected execute: firmware version too low" {
+		t.Errorf("Error() = %q", s)
+	}
+	for _, b := range [][]byte{{0x60, 0x04}, {0x60, 0x03, 0x01}, {0x10, 0x04, 0x01}} {
+		if _, err := parseResponse(b, OpExecute); err == nil {
+			t.Errorf("parseResponse(%X) accepted invalid response", b)
+		}
+	}
+
+	for _, tt := range []struct {
+		s    interface{ String() string }
+		want string
+	}{
+		{OpCalculateChecksum, "calculate-checksum"},
+		{Opcode(0x7F), "Opcode(0x7F)"},
+		{ObjectCommand, "command"},
+		{ResultInsufficientResources, "insufficient resources"},
+		{Result(0x42), "Result(0x42)"},
+		{ExtendedError(0x42), "ExtendedError(0x42)"},
+	} {
+		if got := tt.s.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int
+		packetSize int
+		prn        int
+	}{
+		{"default", 1000, DefaultPacketSize, DefaultPRN},
+		{"whole objects", 1024, DefaultPacketSize, 4},
+		{"PRN disabled", 700, DefaultPacketSize, 0},
+		{"large packets", 999, 244, 1},
+		{"single packet", 5, DefaultPacketSize, DefaultPRN},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeTarget()
+			img := testImage(tt.size)
+			c := NewClient(f)
+			c.PacketSize, c.PRN = tt.packetSize, tt.prn
+			var progress []Progress
+			c.Progress = func(p Progress) { progress = append(progress, p) }
+
+			if err := c.Send(context.Background(), img); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(f.activated, img.Firmware) {
+				t.Errorf("target activated %d bytes, want the %d of the image", len(f.activated), len(img.Firmware))
+			}
+			if len(progress) == 0 || progress[len(progress)-1] != (Progress{Image: ImageApplication, Sent: tt.size, Total: tt.size}) {
+				t.Fatalf("progress = %+v", progress)
+			}
+			for i := 1; i < len(progress); i++ {
+				if progress[i].Sent < progress[i-1].Sent {
+					t.Errorf("progress went backwards: %+v", progress)
+				}
+			}
+		})
+	}
+}
+
+func TestSendCorrupted(t *testing.T) {
+	for _, prn := range []int{0, 3} {
+		f := newFakeTarget()
+		f.corrupt = map[int]bool{2: true, 20: true}
+		img := testImage(1000)
+		c := NewClient(f)
+		c.PRN = prn
+		if err := c.Send(context.Background(), img); err != nil {
+			t.Fatalf("PRN %d: %v", prn, err)
+		}
+		if !bytes.Equal(f.activated, img.Firmware) {
+			t.Errorf("PRN %d: target did not activate the image", prn)
+		}
+	}
+
+	f := newFakeTarget()
+	f.corrupt = map[int]bool{1: true}
+	c := NewClient(f)
+	c.Retries = 0
+	if err := c.Send(context.Background(), testImage(1000)); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Send() error = %v, want ErrChecksum", err)
+	}
+}
+
+func TestSendResume(t *testing.T) {
+	img := testImage(1000)
+	tests := []struct {
+		name         string
+		disconnectAt int
+		prn          int
+	}{
+		// objects are 256 bytes, 13 packets of 20 bytes with the last one shortened
+		{"within object", 20, DefaultPRN},
+		{"within object without PRN", 20, 0},
+		{"after executed object", 14, DefaultPRN},
+		{"in last object", 50, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeTarget()
+			f.disconnectAt = tt.disconnectAt
+			c := NewClient(f)
+			c.PRN = tt.prn
+			if err := c.Send(context.Background(), img); !errors.Is(err, errDisconnected) {
+				t.Fatalf("Send() error = %v, want %v", err, errDisconnected)
+			}
+			sent := f.dataPackets - 1
+
+			var progress []Progress
+			c = NewClient(f)
+			c.PRN = tt.prn
+			c.Progress = func(p Progress) { progress = append(progress, p) }
+			if err := c.Send(context.Background(), img); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(f.activated, img.Firmware) {
+				t.Fatal("target did not activate the image")
+			}
+			// 51 packets are needed in total, everything sent before the disconnection is kept
+			if resent := f.dataPackets - tt.disconnectAt; resent != 51-sent {
+				t.Errorf("sent %d packets after resuming, want %d", resent, 51-sent)
+			}
+			if len(progress) == 0 || progress[0].Sent == 0 {
+				t.Errorf("progress = %+v, want resumed transfer", progress)
+			}
+		})
+	}
+
+	// resuming with a different image starts over
+	f := newFakeTarget()
+	f.disconnectAt = 20
+	if err := NewClient(f).Send(context.Background(), img); !errors.Is(err, errDisconnected) {
+		t.Fatalf("Send() error = %v, want %v", err, errDisconnected)
+	}
+	other := testImage(600)
+	if err := NewClient(f).Send(context.Background(), other); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(f.activated, other.Firmware) {
+		t.Error("target did not activate the other image")
+	}
+}
+
+func TestSendRejected(t *testing.T) {
+	f := newFakeTarget()
+	img := testImage(100)
+	img.Init = []byte("invalid init")
+	err := NewClient(f).Send(context.Background(), img)
+	var re *ResponseError
+	if !errors.As(err, &re) || re.Op != OpExecute || re.Extended != ExtInitCommandInvalid {
+		t.Errorf("Send() error = %v, want rejected init packet", err)
+	}
+
+	f = newFakeTarget()
+	img = testImage(100)
+	img.Firmware[0]++
+	err = NewClient(f).Send(context.Background(), img)
+	if !errors.As(err, &re) || re.Extended != ExtHashFailed {
+		t.Errorf("Send() error = %v, want failed validation", err)
+	}
+
+	f = newFakeTarget()
+	f.maxCommand = 8
+	if err := NewClient(f).Send(context.Background(), testImage(100)); err == nil {
+		t.Error("Send() sent init packet larger than maximum")
+	}
+}
+
+func TestSendTimeout(t *testing.T) {
+	f := newFakeTarget()
+	f.silent = true
+	c := NewClient(f)
+	c.Timeout = 10 * time.Millisecond
+	if err := c.Send(context.Background(), testImage(100)); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Send() error = %v, want ErrTimeout", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.Send(ctx, testImage(100)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Send() error = %v, want context.Canceled", err)
+	}
+}
+
+func makeZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(fw, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParsePackage(t *testing.T) {
+	b := makeZip(t, map[string]string{
+		"manifest.json": `{"manifest": {
+			"application": {"bin_file": "app.bin", "dat_file": "app.dat"},
+			"softdevice_bootloader": {"bin_file": "sd_bl.bin", "dat_file": "sd_bl.dat", "info_read_only_metadata": {"bl_size": 24576}},
+			"dfu_version": 0.5
+		}}`,
+		"app.bin":   "application",
+		"app.dat":   "app init",
+		"sd_bl.bin": "softdevice and bootloader",
+		"sd_bl.dat": "sd_bl init",
+	})
+	p, err := ParsePackage(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Package{Images: []Image{
+		{Type: ImageSoftDeviceBootloader, Init: []byte("sd_bl init"), Firmware: []byte("softdevice and bootloader")},
+		{Type: ImageApplication, Init: []byte("app init"), Firmware: []byte("application")},
+	}}
+	if diff := cmp.Diff(want, p); diff != "" {
+		t.Errorf("ParsePackage() mismatch (-want +got):\n%s", diff)
+	}
+
+	for name, files := range map[string]map[string]string{
+		"no manifest":    {"app.bin": "application"},
+		"invalid json":   {"manifest.json": `{"manifest": `},
+		"no images":      {"manifest.json": `{"manifest": {"dfu_version": 0.5}}`},
+		"no init packet": {"manifest.json": `{"manifest": {"application": {"bin_file": "app.bin"}}}`, "app.bin": "application"},
+		"missing file":   {"manifest.json": `{"manifest": {"application": {"bin_file": "app.bin", "dat_file": "app.dat"}}}`, "app.bin": "application"},
+		"empty file": {
+			"manifest.json": `{"manifest": {"application": {"bin_file": "app.bin", "dat_file": "app.dat"}}}`,
+			"app.bin":       "",
+			"app.dat":       "init",
+		},
+	} {
+		b := makeZip(t, files)
+		if _, err := ParsePackage(bytes.NewReader(b), int64(len(b))); err == nil {
+			t.Errorf("%s: ParsePackage() accepted invalid package", name)
+		}
+	}
+	if _, err := ParsePackage(bytes.NewReader([]byte("not a zip")), 9); err == nil {
+		t.Error("ParsePackage() accepted invalid zip")
+	}
+}
+
+// fakeApplication answers buttonless DFU requests
+type fakeApplication struct {
+	name       string
+	result     byte
+	disconnect bool
+
+	indications chan []byte
+}
+
+func (f *fakeApplication) Send(ctx context.Context, b []byte) error {
+	switch b[0] {
+	case 0x02:
+		f.name = string(b[2 : 2+b[1]])
+	case 0x01:
+		if f.disconnect {
+			close(f.indications)
+			return nil
+		}
+	}
+	f.indications <- []byte{0x20, b[0], f.result}
+	return nil
+}
+
+func (f *fakeApplication) Receive(ctx context.Context) ([]byte, error) {
+	select {
+	case b, ok := <-f.indications:
+		if !ok {
+			return nil, io.EOF
+		}
+		return b, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestEnterBootloader(t *testing.T) {
+	f := &fakeApplication{result: 0x01, indications: make(chan []byte, 4)}
+	if err := EnterBootloader(context.Background(), f, "RuuviBoot"); err != nil {
+		t.Fatal(err)
+	}
+	if f.name != "RuuviBoot" {
+		t.Errorf("bootloader name = %q", f.name)
+	}
+
+	f = &fakeApplication{result: 0x01, disconnect: true, indications: make(chan []byte, 4)}
+	if err := EnterBootloader(context.Background(), f, ""); err != nil {
+		t.Errorf("EnterBootloader() with device restarting before indication, error = %v", err)
+	}
+
+	f = &fakeApplication{result: 0x06, indications: make(chan []byte, 4)}
+	err := EnterBootloader(context.Background(), f, "")
+	if !errors.Is(err, ErrButtonless) || err.Error() != "Buttonless DFU request rejected: busy" {
+		t.Errorf("EnterBootloader() error = %v, want rejection", err)
+	}
+
+	if err := EnterBootloader(context.Background(), f, "a name which is far too long"); err == nil {
+		t.Error("EnterBootloader() accepted too long name")
+	}
+}
+
+func TestBootloaderAddress(t *testing.T) {
+	for _, tt := range []struct {
+		mac, want string
+	}{
+		{"CB:B8:33:4C:88:4F", "CB:B8:33:4C:88:50"},
+		{"CB:B8:33:4C:88:FF", "CB:B8:33:4C:88:00"},
+		{"FF:FF:FF:FF:FF:FF", "FF:FF:FF:FF:FF:00"},
+	} {
+		mac, _ := ruuvi.ParseMAC(tt.mac)
+		if got := BootloaderAddress(mac).String(); got != tt.want {
+			t.Errorf("BootloaderAddress(%s) = %s, want %s", tt.mac, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package dfu
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Types of images in a firmware package
+const (
+	ImageSoftDeviceBootloader = "softdevice_bootloader"
+	ImageSoftDevice           = "softdevice"
+	ImageBootloader           = "bootloader"
+	ImageApplication          = "application"
+)
+
+// imageTypes lists the types of images in the order they are sent
+var imageTypes = []string{ImageSoftDeviceBootloader, ImageSoftDevice, ImageBootloader, ImageApplication}
+
+// maxFileSize limits the size of the files of a package, larger than the flash of any nRF52
+const maxFileSize = 4 << 20
+
+// Image is an image of a firmware package
+type Image struct {
+	// Type is one of ImageApplication, ImageSoftDeviceBootloader, ImageSoftDevice or ImageBootloader
+	Type string
+	// Init is the signed init packet, which the bootloader validates the firmware with
+	Init []byte
+	// Firmware is the binary
+	Firmware []byte
+}
+
+// Package is a firmware package, a zip file as created by nrfutil, e.g. the ones RuuviTag firmware releases come with:
+//
+//	{
+//		"manifest": {
+//			"application": {
+//				"bin_file": "ruuvitag_b_armgcc_ruuvifw_default_v3.31.1_app.bin",
+//				"dat_file": "ruuvitag_b_armgcc_ruuvifw_default_v3.31.1_app.dat"
+//			}
+//		}
+//	}
+type Package struct {
+	// Images holds the images in the order they are sent: a SoftDevice and bootloader update before the application
+	Images []Image
+}
+
+type manifest struct {
+	Manifest map[string]json.RawMessage `json:"manifest"`
+}
+
+type manifestImage struct {
+	BinFile string `json:"bin_file"`
+	DatFile string `json:"dat_file"`
+}
+
+// ParsePackage reads a firmware package from the zip file in r, which is size bytes long
+func ParsePackage(r io.ReaderAt, size int64) (*Package, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid firmware package: %w", err)
+	}
+	return parsePackage(z)
+}
+
+// OpenPackage reads a firmware package from the zip file at path
+func OpenPackage(path string) (*Package, error) {
+	z, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+	return parsePackage(&z.Reader)
+}
+
+func parsePackage(z *zip.Reader) (*Package, error) {
+	b, err := readFile(z, "manifest.json")
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("Invalid manifest.json: %w", err)
+	}
+
+	p := &Package{}
+	for _, t := range imageTypes {
+		raw, ok := m.Manifest[t]
+		if !ok {
+			continue
+		}
+		var mi manifestImage
+		if err := json.Unmarshal(raw, &mi); err != nil {
+			return nil, fmt.Errorf("Invalid manifest.json: %s: %w", t, err)
+		}
+		if mi.BinFile == "" || mi.DatFile == "" {
+			return nil, fmt.Errorf("Invalid manifest.json: %s has no bin_file or dat_file", t)
+		}
+		img := Image{Type: t}
+		if img.Init, err = readFile(z, mi.DatFile); err != nil {
+			return nil, err
+		}
+		if img.Firmware, err = readFile(z, mi.BinFile); err != nil {
+			return nil, err
+		}
+		if len(img.Init) == 0 || len(img.Firmware) == 0 {
+			return nil, fmt.Errorf("Invalid firmware package: %s is empty", t)
+		}
+		p.Images = append(p.Images, img)
+	}
+	if len(p.Images) == 0 {
+		return nil, fmt.Errorf("Invalid firmware package: no images in manifest.json")
+	}
+	return p, nil
+}
+
+// readFile returns the contents of the file with given name in z
+func readFile(z *zip.Reader, name string) ([]byte, error) {
+	for _, f := range z.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("Invalid firmware package: %s: %w", name, err)
+		}
+		defer rc.Close()
+		b, err := ioutil.ReadAll(io.LimitReader(rc, maxFileSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid firmware package: %s: %w", name, err)
+		}
+		if len(b) > maxFileSize {
+			return nil, fmt.Errorf("Invalid firmware package: %s is larger than %d bytes", name, maxFileSize)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("Invalid firmware package: %s not found", name)
+}
@@ -0,0 +1,150 @@
+package endpoints
+
+import "fmt"
+
+// Special values of SensorConfig fields. Numeric values, e.g. a sample rate of 10 Hz, are given as is.
+const (
+	// ConfigDefault selects the default of the sensor
+	ConfigDefault byte = 0x00
+	// ConfigMin selects the smallest value the sensor supports
+	ConfigMin byte = 0xF0
+	// ConfigMax selects the largest value the sensor supports
+	ConfigMax byte = 0xF1
+	// ConfigNoChange keeps the current value
+	ConfigNoChange byte = 0xFF
+
+	// ConfigErrInvalid is returned by the tag in place of a value which is not valid
+	ConfigErrInvalid byte = 0xE0
+	// ConfigErrNotImplemented is returned by the tag in place of a value which the firmware does not implement
+	ConfigErrNotImplemented byte = 0xE1
+	// ConfigErrNotSupported is returned by the tag in place of a value which the sensor does not support
+	ConfigErrNotSupported byte = 0xE2
+)
+
+// Modes of SensorConfig
+const (
+	ModeSleep      byte = 0xF2
+	ModeSingle     byte = 0xF3
+	ModeContinuous byte = 0xF4
+)
+
+// DSPFunction is the digital signal processing a sensor applies to samples
+type DSPFunction byte
+
+const (
+	// DSPLast uses the last sample
+	DSPLast DSPFunction = 0
+	// DSPLowPass applies a low pass filter, DSPParameter gives its strength
+	DSPLowPass DSPFunction = 1 << 1
+	// DSPHighPass applies a high pass filter, DSPParameter gives its strength
+	DSPHighPass DSPFunction = 1 << 2
+	// DSPOversampling averages DSPParameter samples
+	DSPOversampling DSPFunction = 1 << 3
+)
+
+func (f DSPFunction) String() string {
+	switch f {
+	case DSPLast:
+		return "last"
+	case DSPLowPass:
+		return "low-pass"
+	case DSPHighPass:
+		return "high-pass"
+	case DSPOversampling:
+		return "oversampling"
+	}
+	return configString(byte(f))
+}
+
+// SensorConfig is the payload of sensor configuration reads and writes.
+// Fields hold a numeric value, e.g. 10 for 10 Hz, or one of the special Config values.
+type SensorConfig struct {
+	// SampleRate is in Hz
+	SampleRate byte
+	// Resolution is in bits
+	Resolution byte
+	// Scale is the full range of the sensor, e.g. 2 for ±2 G of an accelerometer
+	Scale        byte
+	DSPFunction  DSPFunction
+	DSPParameter byte
+	// Mode is one of the Mode values
+	Mode byte
+}
+
+// NoChange returns a configuration which keeps every value, to be modified before writing
+func NoChange() SensorConfig {
+	return SensorConfig{
+		SampleRate:   ConfigNoChange,
+		Resolution:   ConfigNoChange,
+		Scale:        ConfigNoChange,
+		DSPFunction:  DSPFunction(ConfigNoChange),
+		DSPParameter: ConfigNoChange,
+		Mode:         ConfigNoChange,
+	}
+}
+
+// String returns c in readable form, e.g. "sample-rate=10 resolution=max scale=2 dsp=last/0 mode=continuous"
+func (c SensorConfig) String() string {
+	mode := configString(c.Mode)
+	switch c.Mode {
+	case ModeSleep:
+		mode = "sleep"
+	case ModeSingle:
+		mode = "single"
+	case ModeContinuous:
+		mode = "continuous"
+	}
+	return fmt.Sprintf("sample-rate=%s resolution=%s scale=%s dsp=%v/%s mode=%s",
+		configString(c.SampleRate), configString(c.Resolution), configString(c.Scale),
+		c.DSPFunction, configString(c.DSPParameter), mode)
+}
+
+func configString(v byte) string {
+	switch v {
+	case ConfigDefault:
+		return "default"
+	case ConfigMin:
+		return "min"
+	case ConfigMax:
+		return "max"
+	case ConfigNoChange:
+		return "no-change"
+	case ConfigErrInvalid:
+		return "invalid"
+	case ConfigErrNotImplemented:
+		return "not-implemented"
+	case ConfigErrNotSupported:
+		return "not-supported"
+	}
+	return fmt.Sprint(v)
+}
+
+// NewSensorConfigWrite returns a request configuring the sensor of endpoint e.
+// The tag answers with the configuration in effect.
+func NewSensorConfigWrite(e Endpoint, c SensorConfig) Message {
+	m := request(e, OpSensorConfigWrite)
+	m.Payload = [PayloadLength]byte{c.SampleRate, c.Resolution, c.Scale, byte(c.DSPFunction), c.DSPParameter, c.Mode}
+	return m
+}
+
+// NewSensorConfigRead returns a request for the configuration of the sensor of endpoint e,
+// which the tag answers with a sensor configuration write
+func NewSensorConfigRead(e Endpoint) Message {
+	return request(e, OpSensorConfigRead)
+}
+
+// SensorConfig decodes the payload of a sensor configuration write or read
+func (m Message) SensorConfig() (SensorConfig, error) {
+	if err := m.expect(OpSensorConfigWrite, OpSensorConfigRead); err != nil {
+		return SensorConfig{}, err
+	}
+	p := m.Payload
+	return SensorConfig{
+		SampleRate:   p[0],
+		Resolution:   p[1],
+		Scale:        p[2],
+		DSPFunction:  DSPFunction(p[3]),
+		DSPParameter: p[4],
+		Mode:         p[5],
+	}, nil
+}
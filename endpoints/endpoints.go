@@ -0,0 +1,299 @@
+// Package endpoints encodes and decodes messages of the Ruuvi endpoints protocol, which RuuviTag firmware 3.x
+// speaks over the Nordic UART Service for reading and writing sensor configuration, the clock and logs.
+//
+// Every message is 11 bytes: destination endpoint, source endpoint, operation, and an 8 byte payload.
+// Requests have the addressed endpoint as both destination and source, and the tag answers a read
+// with the corresponding write, e.g. a log value read with log value writes.
+// Multi-byte values are big endian.
+//
+// Described here: https://docs.ruuvi.com/communication/bluetooth-connection/nordic-uart-service-nus
+// and in ruuvi_endpoints.h of https://github.com/ruuvi/ruuvi.endpoints.c
+package endpoints
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// MessageLength is the length of every message
+	MessageLength = 11
+	// PayloadLength is the length of the payload of every message
+	PayloadLength = 8
+)
+
+// Endpoint identifies a sensor or other function of a tag
+type Endpoint byte
+
+const (
+	EndpointBattery       Endpoint = 0x20
+	EndpointRTC           Endpoint = 0x21
+	EndpointTemperature   Endpoint = 0x30
+	EndpointHumidity      Endpoint = 0x31
+	EndpointPressure      Endpoint = 0x32
+	EndpointEnvironmental Endpoint = 0x3A // temperature, humidity and pressure together
+	EndpointAccelerationX Endpoint = 0x40
+	EndpointAccelerationY Endpoint = 0x41
+	EndpointAccelerationZ Endpoint = 0x42
+	EndpointAcceleration  Endpoint = 0x4A // all axes together
+)
+
+var endpointNames = map[Endpoint]string{
+	EndpointBattery:       "battery",
+	EndpointRTC:           "rtc",
+	EndpointTemperature:   "temperature",
+	EndpointHumidity:      "humidity",
+	EndpointPressure:      "pressure",
+	EndpointEnvironmental: "environmental",
+	EndpointAccelerationX: "acceleration-x",
+	EndpointAccelerationY: "acceleration-y",
+	EndpointAccelerationZ: "acceleration-z",
+	EndpointAcceleration:  "acceleration",
+}
+
+// Endpoints returns all documented endpoints in ascending order
+func Endpoints() []Endpoint {
+	return []Endpoint{
+		EndpointBattery, EndpointRTC,
+		EndpointTemperature, EndpointHumidity, EndpointPressure, EndpointEnvironmental,
+		EndpointAccelerationX, EndpointAccelerationY, EndpointAccelerationZ, EndpointAcceleration,
+	}
+}
+
+// String returns the name of e, or its value in hex if it is not documented
+func (e Endpoint) String() string {
+	if name, ok := endpointNames[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("Endpoint(0x%02X)", byte(e))
+}
+
+// Operation is the type of a message
+type Operation byte
+
+const (
+	OpSensorConfigWrite Operation = 0x02
+	OpSensorConfigRead  Operation = 0x03
+	OpSensorOffsetWrite Operation = 0x04
+	OpSensorOffsetRead  Operation = 0x05
+	OpLogConfigWrite    Operation = 0x06
+	OpLogConfigRead     Operation = 0x07
+	OpValueWrite        Operation = 0x08
+	OpValueRead         Operation = 0x09
+	OpLogValueWrite     Operation = 0x10
+	OpLogValueRead      Operation = 0x11
+)
+
+var operationNames = map[Operation]string{
+	OpSensorConfigWrite: "sensor-config-write",
+	OpSensorConfigRead:  "sensor-config-read",
+	OpSensorOffsetWrite: "sensor-offset-write",
+	OpSensorOffsetRead:  "sensor-offset-read",
+	OpLogConfigWrite:    "log-config-write",
+	OpLogConfigRead:     "log-config-read",
+	OpValueWrite:        "value-write",
+	OpValueRead:         "value-read",
+	OpLogValueWrite:     "log-value-write",
+	OpLogValueRead:      "log-value-read",
+}
+
+// Operations returns all documented operations in ascending order
+func Operations() []Operation {
+	return []Operation{
+		OpSensorConfigWrite, OpSensorConfigRead, OpSensorOffsetWrite, OpSensorOffsetRead,
+		OpLogConfigWrite, OpLogConfigRead, OpValueWrite, OpValueRead, OpLogValueWrite, OpLogValueRead,
+	}
+}
+
+// String returns the name of o, or its value in hex if it is not documented
+func (o Operation) String() string {
+	if name, ok := operationNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("Operation(0x%02X)", byte(o))
+}
+
+var (
+	// ErrLength is returned when decoding data which is not a whole number of messages
+	ErrLength = errors.New("Invalid message length")
+
+	// ErrOperation is wrapped by errors returned when the payload of a message is decoded as the wrong type
+	ErrOperation = errors.New("Unexpected operation")
+)
+
+// Message is a single message of the protocol
+type Message struct {
+	Destination Endpoint
+	Source      Endpoint
+	Operation   Operation
+	Payload     [PayloadLength]byte
+}
+
+// String returns m in readable form, e.g. "environmental<-environmental log-value-read 60B62140 60B4CFC0"
+func (m Message) String() string {
+	return fmt.Sprintf("%v<-%v %v %X %X", m.Destination, m.Source, m.Operation, m.Payload[:4], m.Payload[4:])
+}
+
+// AppendBinary appends m encoded to b
+func (m Message) AppendBinary(b []byte) []byte {
+	b = append(b, byte(m.Destination), byte(m.Source), byte(m.Operation))
+	return append(b, m.Payload[:]...)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (m Message) MarshalBinary() ([]byte, error) {
+	return m.AppendBinary(make([]byte, 0, MessageLength)), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler
+func (m *Message) UnmarshalBinary(b []byte) error {
+	if len(b) != MessageLength {
+		return fmt.Errorf("%w %d", ErrLength, len(b))
+	}
+	m.Destination, m.Source, m.Operation = Endpoint(b[0]), Endpoint(b[1]), Operation(b[2])
+	copy(m.Payload[:], b[3:])
+	return nil
+}
+
+// Split decodes the messages in b, e.g. a notification carrying several messages
+func Split(b []byte) ([]Message, error) {
+	if len(b) == 0 || len(b)%MessageLength != 0 {
+		return nil, fmt.Errorf("%w %d", ErrLength, len(b))
+	}
+	msgs := make([]Message, len(b)/MessageLength)
+	for i := range msgs {
+		_ = msgs[i].UnmarshalBinary(b[i*MessageLength : (i+1)*MessageLength])
+	}
+	return msgs, nil
+}
+
+// expect returns an error wrapping ErrOperation unless m is one of ops
+func (m Message) expect(ops ...Operation) error {
+	for _, op := range ops {
+		if m.Operation == op {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w %v, expected %v", ErrOperation, m.Operation, ops[0])
+}
+
+// request returns a message with endpoint e as both destination and source
+func request(e Endpoint, op Operation) Message {
+	return Message{Destination: e, Source: e, Operation: op}
+}
+
+// LogRead is the payload of a log value read: the tag sends the values it has logged at or after Start
+// as log value writes, followed by EndOfLog
+type LogRead struct {
+	// Now is the current time, which the tag uses to timestamp the values
+	Now time.Time
+	// Start is the time of the earliest value to send
+	Start time.Time
+}
+
+// NewLogRead returns a request for the log of endpoint e
+func NewLogRead(e Endpoint, r LogRead) Message {
+	m := request(e, OpLogValueRead)
+	binary.BigEndian.PutUint32(m.Payload[0:], unixSeconds(r.Now))
+	binary.BigEndian.PutUint32(m.Payload[4:], unixSeconds(r.Start))
+	return m
+}
+
+// LogRead decodes the payload of a log value read
+func (m Message) LogRead() (LogRead, error) {
+	if err := m.expect(OpLogValueRead); err != nil {
+		return LogRead{}, err
+	}
+	return LogRead{
+		Now:   fromUnixSeconds(binary.BigEndian.Uint32(m.Payload[0:])),
+		Start: fromUnixSeconds(binary.BigEndian.Uint32(m.Payload[4:])),
+	}, nil
+}
+
+// LogValue is the payload of a log value write: a single logged value of the source endpoint
+type LogValue struct {
+	// Timestamp is the time the value was logged, with one second resolution
+	Timestamp time.Time
+	// Value is the logged value, scaled as the endpoint defines, e.g. 0.01 °C for temperature
+	Value int32
+}
+
+// NewLogValue returns a log value write of a value of endpoint src, answering a log value read of dst
+func NewLogValue(dst, src Endpoint, v LogValue) Message {
+	m := Message{Destination: dst, Source: src, Operation: OpLogValueWrite}
+	binary.BigEndian.PutUint32(m.Payload[0:], unixSeconds(v.Timestamp))
+	binary.BigEndian.PutUint32(m.Payload[4:], uint32(v.Value))
+	return m
+}
+
+// LogValue decodes the payload of a log value write
+func (m Message) LogValue() (LogValue, error) {
+	if err := m.expect(OpLogValueWrite); err != nil {
+		return LogValue{}, err
+	}
+	return LogValue{
+		Timestamp: fromUnixSeconds(binary.BigEndian.Uint32(m.Payload[0:])),
+		Value:     int32(binary.BigEndian.Uint32(m.Payload[4:])),
+	}, nil
+}
+
+// NewEndOfLog returns the message which ends the log of endpoint e
+func NewEndOfLog(e Endpoint) Message {
+	m := request(e, OpLogValueWrite)
+	for i := range m.Payload {
+		m.Payload[i] = 0xFF
+	}
+	return m
+}
+
+// IsEndOfLog reports whether m ends a log sent in answer to a log value read
+func (m Message) IsEndOfLog() bool {
+	return m == NewEndOfLog(m.Destination)
+}
+
+// NewValueRead returns a request for the current value of endpoint e, which the tag answers with a value write
+func NewValueRead(e Endpoint) Message {
+	return request(e, OpValueRead)
+}
+
+// NewClockWrite returns a request setting the clock of the tag to t, with millisecond resolution
+func NewClockWrite(t time.Time) Message {
+	m := request(EndpointRTC, OpValueWrite)
+	binary.BigEndian.PutUint64(m.Payload[:], uint64(t.UnixNano()/int64(time.Millisecond)))
+	return m
+}
+
+// NewClockRead returns a request for the time of the clock of the tag
+func NewClockRead() Message {
+	return NewValueRead(EndpointRTC)
+}
+
+// Clock decodes the payload of a value write of the clock, the time as milliseconds since the Unix epoch
+func (m Message) Clock() (time.Time, error) {
+	if err := m.expect(OpValueWrite); err != nil {
+		return time.Time{}, err
+	}
+	if m.Source != EndpointRTC {
+		return time.Time{}, fmt.Errorf("%w: value of %v, expected %v", ErrOperation, m.Source, EndpointRTC)
+	}
+	ms := int64(binary.BigEndian.Uint64(m.Payload[:]))
+	return time.Unix(ms/1000, ms%1000*int64(time.Millisecond)).UTC(), nil
+}
+
+// unixSeconds returns t as 32 bit seconds since the Unix epoch, 0 for zero and earlier times
+func unixSeconds(t time.Time) uint32 {
+	if t.IsZero() || t.Unix() < 0 {
+		return 0
+	}
+	return uint32(t.Unix())
+}
+
+// fromUnixSeconds converts 32 bit seconds since the Unix epoch to time, 0 to zero time
+func fromUnixSeconds(s uint32) time.Time {
+	if s == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(s), 0).UTC()
+}
@@ -0,0 +1,242 @@
+package endpoints
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var now = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func TestMessages(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		msg      Message
+		expected []byte
+		// decode decodes the typed payload of the message, and expected is what it should return
+		decode  func(Message) (interface{}, error)
+		payload interface{}
+	}{
+		{
+			name:     "log read",
+			msg:      NewLogRead(EndpointEnvironmental, LogRead{Now: now, Start: now.Add(-24 * time.Hour)}),
+			expected: []byte{0x3A, 0x3A, 0x11, 0x60, 0xB6, 0x21, 0x40, 0x60, 0xB4, 0xCF, 0xC0},
+			decode:   func(m Message) (interface{}, error) { return m.LogRead() },
+			payload:  LogRead{Now: now, Start: now.Add(-24 * time.Hour)},
+		},
+		{
+			name:     "log read from beginning",
+			msg:      NewLogRead(EndpointEnvironmental, LogRead{Now: now}),
+			expected: []byte{0x3A, 0x3A, 0x11, 0x60, 0xB6, 0x21, 0x40, 0, 0, 0, 0},
+			decode:   func(m Message) (interface{}, error) { return m.LogRead() },
+			payload:  LogRead{Now: now},
+		},
+		{
+			name:     "log value",
+			msg:      NewLogValue(EndpointEnvironmental, EndpointTemperature, LogValue{Timestamp: now, Value: -150}),
+			expected: []byte{0x3A, 0x30, 0x10, 0x60, 0xB6, 0x21, 0x40, 0xFF, 0xFF, 0xFF, 0x6A},
+			decode:   func(m Message) (interface{}, error) { return m.LogValue() },
+			payload:  LogValue{Timestamp: now, Value: -150},
+		},
+		{
+			name:     "end of log",
+			msg:      NewEndOfLog(EndpointEnvironmental),
+			expected: []byte{0x3A, 0x3A, 0x10, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+			decode:   func(m Message) (interface{}, error) { return m.IsEndOfLog(), nil },
+			payload:  true,
+		},
+		{
+			name:     "clock write",
+			msg:      NewClockWrite(now.Add(123 * time.Millisecond)),
+			expected: []byte{0x21, 0x21, 0x08, 0, 0, 0x01, 0x79, 0xC7, 0x71, 0xE2, 0x7B},
+			decode:   func(m Message) (interface{}, error) { return m.Clock() },
+			payload:  now.Add(123 * time.Millisecond),
+		},
+		{
+			name:     "clock read",
+			msg:      NewClockRead(),
+			expected: []byte{0x21, 0x21, 0x09, 0, 0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			name:     "value read",
+			msg:      NewValueRead(EndpointBattery),
+			expected: []byte{0x20, 0x20, 0x09, 0, 0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			name: "sensor config write",
+			msg: NewSensorConfigWrite(EndpointAcceleration, SensorConfig{
+				SampleRate: 10, Resolution: 12, Scale: 4, DSPFunction: DSPOversampling, DSPParameter: 8, Mode: ModeContinuous,
+			}),
+			expected: []byte{0x4A, 0x4A, 0x02, 10, 12, 4, 0x08, 8, 0xF4, 0, 0},
+			decode:   func(m Message) (interface{}, error) { return m.SensorConfig() },
+			payload: SensorConfig{
+				SampleRate: 10, Resolution: 12, Scale: 4, DSPFunction: DSPOversampling, DSPParameter: 8, Mode: ModeContinuous,
+			},
+		},
+		{
+			name:     "sensor config write without changes",
+			msg:      NewSensorConfigWrite(EndpointEnvironmental, NoChange()),
+			expected: []byte{0x3A, 0x3A, 0x02, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0, 0},
+			decode:   func(m Message) (interface{}, error) { return m.SensorConfig() },
+			payload:  NoChange(),
+		},
+		{
+			name:     "sensor config read",
+			msg:      NewSensorConfigRead(EndpointTemperature),
+			expected: []byte{0x30, 0x30, 0x03, 0, 0, 0, 0, 0, 0, 0, 0},
+			decode:   func(m Message) (interface{}, error) { return m.SensorConfig() },
+			payload:  SensorConfig{},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := test.msg.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.expected, b); diff != "" {
+				t.Error(diff)
+			}
+
+			var m Message
+			if err := m.UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+			if m != test.msg {
+				t.Errorf("expected %v, got %v", test.msg, m)
+			}
+			if test.decode == nil {
+				return
+			}
+			payload, err := test.decode(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.payload, payload); diff != "" {
+				t.Error("payload:", diff)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, e := range Endpoints() {
+		for _, op := range Operations() {
+			m := Message{Destination: e, Source: Endpoint(rng.Intn(256)), Operation: op}
+			rng.Read(m.Payload[:])
+
+			b, _ := m.MarshalBinary()
+			var u Message
+			if err := u.UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+			if u != m {
+				t.Errorf("expected %v, got %v", m, u)
+			}
+
+			switch op {
+			case OpSensorConfigWrite, OpSensorConfigRead:
+				c, err := m.SensorConfig()
+				if err != nil {
+					t.Fatal(err)
+				}
+				r := NewSensorConfigWrite(e, c)
+				if !bytes.Equal(r.Payload[:6], m.Payload[:6]) {
+					t.Errorf("sensor config %v did not round trip: %v", m, r)
+				}
+			case OpLogValueWrite:
+				v, err := m.LogValue()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if r := NewLogValue(m.Destination, m.Source, v); r != m {
+					t.Errorf("log value %v did not round trip: %v", m, r)
+				}
+			case OpLogValueRead:
+				v, err := m.LogRead()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if r := NewLogRead(m.Destination, v); r.Payload != m.Payload {
+					t.Errorf("log read %v did not round trip: %v", m, r)
+				}
+			}
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	a, b := NewLogRead(EndpointEnvironmental, LogRead{Now: now}), NewEndOfLog(EndpointEnvironmental)
+	msgs, err := Split(b.AppendBinary(a.AppendBinary(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]Message{a, b}, msgs); diff != "" {
+		t.Error(diff)
+	}
+
+	for _, n := range []int{0, 10, 12, 21} {
+		if _, err := Split(make([]byte, n)); !errors.Is(err, ErrLength) {
+			t.Errorf("length %d: expected ErrLength, got %v", n, err)
+		}
+		var m Message
+		if err := m.UnmarshalBinary(make([]byte, n)); !errors.Is(err, ErrLength) {
+			t.Errorf("length %d: expected ErrLength, got %v", n, err)
+		}
+	}
+}
+
+func TestWrongOperation(t *testing.T) {
+	m := NewClockRead()
+	if _, err := m.Clock(); !errors.Is(err, ErrOperation) {
+		t.Errorf("clock: expected ErrOperation, got %v", err)
+	}
+	if _, err := NewValueRead(EndpointBattery).Clock(); !errors.Is(err, ErrOperation) {
+		t.Errorf("clock: expected ErrOperation, got %v", err)
+	}
+	if _, err := m.LogValue(); !errors.Is(err, ErrOperation) {
+		t.Errorf("log value: expected ErrOperation, got %v", err)
+	}
+	if _, err := m.LogRead(); !errors.Is(err, ErrOperation) {
+		t.Errorf("log read: expected ErrOperation, got %v", err)
+	}
+	if _, err := m.SensorConfig(); !errors.Is(err, ErrOperation) {
+		t.Errorf("sensor config: expected ErrOperation, got %v", err)
+	}
+	if NewLogValue(EndpointEnvironmental, EndpointTemperature, LogValue{Timestamp: time.Unix(0xFFFFFFFF, 0), Value: -1}).IsEndOfLog() {
+		t.Error("temperature value reported as end of log")
+	}
+}
+
+func TestStrings(t *testing.T) {
+	for _, e := range Endpoints() {
+		if endpointNames[e] == "" {
+			t.Errorf("endpoint 0x%02X has no name", byte(e))
+		}
+	}
+	for _, op := range Operations() {
+		if operationNames[op] == "" {
+			t.Errorf("operation 0x%02X has no name", byte(op))
+		}
+	}
+	if len(endpointNames) != len(Endpoints()) || len(operationNames) != len(Operations()) {
+		t.Error("Endpoints or Operations does not list every named value")
+	}
+
+	for expected, s := range map[string]interface{ String() string }{
+		"Endpoint(0x99)":  Endpoint(0x99),
+		"Operation(0x99)": Operation(0x99),
+		"environmental<-environmental log-value-read 60B62140 00000000": NewLogRead(EndpointEnvironmental, LogRead{Now: now}),
+		"sample-rate=10 resolution=max scale=not-supported dsp=low-pass/default mode=continuous": SensorConfig{
+			SampleRate: 10, Resolution: ConfigMax, Scale: ConfigErrNotSupported, DSPFunction: DSPLowPass, Mode: ModeContinuous,
+		},
+	} {
+		if got := s.String(); got != expected {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+	}
+}
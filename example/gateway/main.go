@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/paypal/gatt"
+	"github.com/paypal/gatt/examples/option"
+
+	"github.com/LassiHeikkila/go-ruuvi/gateway"
+)
+
+var (
+	listenAddr = flag.String("listen", ":80", "Address to serve the Ruuvi Gateway compatible HTTP API on")
+	gwMAC      = flag.String("mac", "", "MAC address reported as gw_mac in responses")
+	token      = flag.String("token", "", "Bearer token required from clients, leave empty to disable authentication")
+	decode     = flag.Bool("decode", false, "Include decoded measurements in responses")
+)
+
+func onStateChanged(d gatt.Device, s gatt.State) {
+	fmt.Println("State:", s)
+	switch s {
+	case gatt.StatePoweredOn:
+		fmt.Println("scanning...")
+		d.Scan([]gatt.UUID{}, true) // report duplicates since we want to keep receiving adverts from sensors
+		return
+	default:
+		d.StopScanning()
+	}
+}
+
+func main() {
+	// disable default log output, some noise is coming from gatt library
+	log.SetOutput(ioutil.Discard)
+	flag.Parse()
+
+	server := gateway.NewServer(gateway.Config{
+		GatewayMAC:  *gwMAC,
+		BearerToken: *token,
+		Decode:      *decode,
+	})
+
+	d, err := gatt.NewDevice(option.DefaultClientOptions...)
+	if err != nil {
+		fmt.Printf("Failed to open device, err: %s\n", err)
+		os.Exit(1)
+	}
+
+	d.Handle(gatt.PeripheralDiscovered(func(p gatt.Peripheral, a *gatt.Advertisement, rssi int) {
+		server.Update(p.ID(), rssi, a.ManufacturerData, time.Now())
+	}))
+	d.Init(onStateChanged)
+
+	fmt.Println("serving on", *listenAddr)
+	if err := http.ListenAndServe(*listenAddr, server); err != nil {
+		fmt.Println("HTTP server failed:", err)
+		os.Exit(1)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"time"
 
 	"github.com/paypal/gatt"
 	"github.com/paypal/gatt/examples/option"
@@ -38,7 +39,7 @@ func onPeriphDiscovered(p gatt.Peripheral, a *gatt.Advertisement, rssi int) {
 	Println("  Manufacturer Data =", hex.EncodeToString(a.ManufacturerData))
 	Println("  Service Data      =", a.ServiceData)
 
-	OutputRuuviData(a.ManufacturerData)
+	OutputReading(p.ID(), rssi, a.ManufacturerData)
 }
 
 func main() {
@@ -69,7 +70,8 @@ func Printf(format string, a ...interface{}) {
 	}
 }
 
-func OutputRuuviData(b []byte) {
+// OutputReading decodes manufacturer data b received from address with given RSSI, and prints it with the receive metadata
+func OutputReading(address string, rssi int, b []byte) {
 	if len(b) == 0 {
 		return
 	}
@@ -80,11 +82,12 @@ func OutputRuuviData(b []byte) {
 		Println("Error processing bytes:", err)
 		return
 	}
+	reading := ruuvi.Reading{Timestamp: time.Now(), MAC: address, RSSI: rssi, Data: advert}
 
-	advertJson, err := advert.MarshalJSON()
+	readingJson, err := reading.MarshalJSON()
 	if err != nil {
 		Println("Error marshalling ruuvi data")
 		return
 	}
-	fmt.Println(string(advertJson))
+	fmt.Println(string(readingJson))
 }
@@ -0,0 +1,271 @@
+// Package gateway implements an HTTP server emulating the local HTTP API of a Ruuvi Gateway.
+//
+// The server keeps the latest advertisement received from each tag and serves it from
+// the /history endpoint in the same JSON format as the Ruuvi Gateway does,
+// so that existing Gateway clients can poll it unchanged.
+// Format is described here: https://docs.ruuvi.com/ruuvi-gateway-firmware/gw-data-formats
+package gateway
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// HistoryPath is the path of the endpoint serving the latest advertisement of each tag
+const HistoryPath = "/history"
+
+// Config contains settings for Server
+type Config struct {
+	// GatewayMAC is reported as "gw_mac" in responses, e.g. "C8:25:2D:8E:9C:2C"
+	GatewayMAC string
+
+	// Coordinates is reported as "coordinates" in responses, may be left empty
+	Coordinates string
+
+	// BearerToken, if non-empty, must be given by clients in the Authorization header
+	BearerToken string
+
+	// Decode adds decoded measurement fields next to the raw data, like gateway firmware does when decoding is enabled
+	Decode bool
+}
+
+// Server keeps the latest advertisement per tag and serves it in Ruuvi Gateway /history format.
+// Server is safe for concurrent use.
+type Server struct {
+	cfg Config
+
+	mu   sync.RWMutex
+	tags map[string]entry
+
+	// now returns the time responses are generated at, and entries aged against
+	now func() time.Time
+}
+
+type entry struct {
+	rssi      int
+	timestamp time.Time
+	counter   uint64
+	data      []byte
+}
+
+// NewServer returns pointer to a Server using given config
+func NewServer(cfg Config) *Server {
+	return &Server{
+		cfg:  cfg,
+		tags: make(map[string]entry),
+		now:  time.Now,
+	}
+}
+
+// Update stores manufacturer data received from tag with given MAC address.
+// Data not originating from a Ruuvi tag is ignored.
+// The data is copied, so the caller may reuse the buffer.
+func (s *Server) Update(mac string, rssi int, manufacturerData []byte, timestamp time.Time) {
+	if !ruuvi.IsAdvertisementFromRuuviTag(manufacturerData) {
+		return
+	}
+	c := make([]byte, len(manufacturerData))
+	copy(c, manufacturerData)
+
+	if m, err := ruuvi.ParseMAC(mac); err == nil {
+		mac = m.String()
+	} else {
+		mac = strings.ToUpper(mac)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev := s.tags[mac]
+	s.tags[mac] = entry{
+		rssi:      rssi,
+		timestamp: timestamp,
+		counter:   prev.counter + 1,
+		data:      c,
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != HistoryPath {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	// optional "time" parameter limits response to tags seen within given number of seconds
+	var maxAge time.Duration
+	if t := r.URL.Query().Get("time"); t != "" {
+		secs, err := strconv.ParseUint(t, 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid value for parameter 'time'", http.StatusBadRequest)
+			return
+		}
+		maxAge = time.Duration(secs) * time.Second
+	}
+
+	b, err := json.Marshal(s.history(maxAge))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(b)
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if s.cfg.BearerToken == "" {
+		return true
+	}
+	const prefix = "Bearer "
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, prefix) {
+		return false
+	}
+	token := strings.TrimSpace(h[len(prefix):])
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.BearerToken)) == 1
+}
+
+type historyResponse struct {
+	Data historyData `json:"data"`
+}
+
+type historyData struct {
+	Coordinates string             `json:"coordinates"`
+	Timestamp   string             `json:"timestamp"`
+	GatewayMAC  string             `json:"gw_mac"`
+	Tags        map[string]tagData `json:"tags"`
+}
+
+type tagData struct {
+	RSSI      int    `json:"rssi"`
+	Timestamp string `json:"timestamp"`
+	Data      string `json:"data"`
+
+	// only present if decoding is enabled
+	Counter    *string `json:"counter,omitempty"`
+	DataFormat *int8   `json:"dataFormat,omitempty"`
+
+	// decoded holds the available and valid decoded fields by their key in gatewayKeys
+	decoded map[string]interface{}
+}
+
+// gatewayKeys are the keys Ruuvi Gateway reports decoded fields with
+var gatewayKeys = map[ruuvi.Field]string{
+	ruuvi.FieldTemperature:               "temperature",
+	ruuvi.FieldHumidity:                  "humidity",
+	ruuvi.FieldPressure:                  "pressure",
+	ruuvi.FieldAccelerationX:             "accelX",
+	ruuvi.FieldAccelerationY:             "accelY",
+	ruuvi.FieldAccelerationZ:             "accelZ",
+	ruuvi.FieldBatteryVoltage:            "voltage",
+	ruuvi.FieldTransmissionPower:         "txPower",
+	ruuvi.FieldMovementCounter:           "movementCounter",
+	ruuvi.FieldMeasurementSequenceNumber: "measurementSequenceNumber",
+	ruuvi.FieldMACAddress:                "id",
+}
+
+// MarshalJSON outputs the fields of t followed by the decoded fields, sorted by key
+func (t tagData) MarshalJSON() ([]byte, error) {
+	type plain tagData
+	b, err := json.Marshal(plain(t))
+	if err != nil || len(t.decoded) == 0 {
+		return b, err
+	}
+	d, err := json.Marshal(t.decoded)
+	if err != nil {
+		return nil, err
+	}
+	// merge the two objects
+	return append(append(b[:len(b)-1], ','), d[1:]...), nil
+}
+
+func (s *Server) history(maxAge time.Duration) historyResponse {
+	now := s.now()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	resp := historyResponse{
+		Data: historyData{
+			Coordinates: s.cfg.Coordinates,
+			Timestamp:   unixString(now),
+			GatewayMAC:  s.cfg.GatewayMAC,
+			Tags:        make(map[string]tagData, len(s.tags)),
+		},
+	}
+
+	for mac, e := range s.tags {
+		if maxAge > 0 && now.Sub(e.timestamp) > maxAge {
+			continue
+		}
+		t := tagData{
+			RSSI:      e.rssi,
+			Timestamp: unixString(e.timestamp),
+			Data:      advertisementHex(e.data),
+		}
+		if s.cfg.Decode {
+			counter := strconv.FormatUint(e.counter, 10)
+			t.Counter = &counter
+			decode(&t, e.data)
+		}
+		resp.Data.Tags[mac] = t
+	}
+
+	return resp
+}
+
+// decode fills in decoded fields of t, leaving out any unavailable or invalid values
+func decode(t *tagData, manufacturerData []byte) {
+	d, err := ruuvi.ProcessAdvertisement(manufacturerData)
+	if err != nil {
+		return
+	}
+	m := ruuvi.MeasurementsOf(d)
+	t.DataFormat = &m.DataFormat
+	t.decoded = make(map[string]interface{})
+	for _, f := range ruuvi.Fields() {
+		key, ok := gatewayKeys[f]
+		switch {
+		case !ok || !m.Valid.Has(f):
+		case f == ruuvi.FieldMACAddress:
+			t.decoded[key] = m.MACAddress.String()
+		case f.Integer():
+			t.decoded[key] = int(m.Value(f))
+		default:
+			t.decoded[key] = m.Value(f)
+		}
+	}
+}
+
+// advertisementHex reconstructs the advertisement as the gateway reports it:
+// flags AD structure followed by manufacturer specific data AD structure, as upper case hex
+func advertisementHex(manufacturerData []byte) string {
+	b := make([]byte, 0, 5+len(manufacturerData))
+	b = append(b, 0x02, 0x01, 0x06)
+	b = append(b, byte(len(manufacturerData)+1), 0xFF)
+	b = append(b, manufacturerData...)
+	return strings.ToUpper(hex.EncodeToString(b))
+}
+
+func unixString(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
@@ -0,0 +1,214 @@
+package gateway
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var (
+	// 0x0499 company ID followed by RAWv2 test vector
+	rawv2Advertisement = []byte{
+		0x99, 0x04,
+		0x05, 0x12, 0xFC, 0x53, 0x94, 0xC3, 0x7C, 0x00,
+		0x04, 0xFF, 0xFC, 0x04, 0x0C, 0xAC, 0x36, 0x42,
+		0x00, 0xCD, 0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F,
+	}
+	// 0x0499 company ID followed by RAWv1 test vector
+	rawv1Advertisement = []byte{
+		0x99, 0x04,
+		0x03, 0x29, 0x1A, 0x1E, 0xCE, 0x1E, 0xFC,
+		0x18, 0xF9, 0x42, 0x02, 0xCA, 0x0B, 0x53,
+	}
+	now = time.Unix(1617183091, 0)
+)
+
+var float64FuzzyCompOpt = cmp.Comparer(func(x, y float64) bool {
+	delta := math.Abs(x - y)
+	mean := math.Abs(x+y) / 2.0
+	if mean == 0 {
+		return true
+	}
+	return (delta / mean) < 0.00001
+})
+
+func newTestServer(cfg Config) *Server {
+	s := NewServer(cfg)
+	s.now = func() time.Time { return now }
+	return s
+}
+
+func get(t *testing.T, h http.Handler, target string, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Result(), rec.Body.Bytes()
+}
+
+func TestHistory(t *testing.T) {
+	s := newTestServer(Config{GatewayMAC: "C8:25:2D:8E:9C:2C"})
+	s.Update("cb:b8:33:4c:88:4f", -53, rawv2Advertisement, now.Add(-time.Second))
+	s.Update("E0:01:02:03:04:05", -80, []byte{0x4C, 0x00, 0x02, 0x15}, now) // not a ruuvitag
+
+	resp, body := get(t, s, "/history", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("Unexpected status code:", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatal("Unexpected content type:", ct)
+	}
+
+	expected := `{"data":{"coordinates":"","timestamp":"1617183091","gw_mac":"C8:25:2D:8E:9C:2C","tags":{` +
+		`"CB:B8:33:4C:88:4F":{"rssi":-53,"timestamp":"1617183090",` +
+		`"data":"0201061BFF99040512FC5394C37C0004FFFC040CAC364200CDCBB8334C884F"}}}}`
+	if diff := cmp.Diff(expected, string(body)); diff != "" {
+		t.Fatal("Unexpected response body (-want +got):\n", diff)
+	}
+}
+
+func TestHistoryDecoded(t *testing.T) {
+	s := newTestServer(Config{Decode: true})
+	s.Update("CB:B8:33:4C:88:4F", -53, rawv2Advertisement, now)
+	s.Update("CB:B8:33:4C:88:4F", -50, rawv2Advertisement, now)
+	s.Update("D1:2A:3B:4C:5D:6E", -70, rawv1Advertisement, now)
+
+	resp, body := get(t, s, "/history", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("Unexpected status code:", resp.StatusCode)
+	}
+
+	var h struct {
+		Data struct {
+			Tags map[string]map[string]interface{} `json:"tags"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &h); err != nil {
+		t.Fatal("Failed to unmarshal response:", err)
+	}
+
+	v2 := h.Data.Tags["CB:B8:33:4C:88:4F"]
+	expectedV2 := map[string]interface{}{
+		"rssi":                      -50.0,
+		"timestamp":                 "1617183091",
+		"data":                      "0201061BFF99040512FC5394C37C0004FFFC040CAC364200CDCBB8334C884F",
+		"counter":                   "2",
+		"dataFormat":                5.0,
+		"temperature":               24.3,
+		"humidity":                  53.49,
+		"pressure":                  100044.0,
+		"accelX":                    0.004,
+		"accelY":                    -0.004,
+		"accelZ":                    1.036,
+		"movementCounter":           66.0,
+		"voltage":                   2.977,
+		"txPower":                   4.0,
+		"measurementSequenceNumber": 205.0,
+		"id":                        "CB:B8:33:4C:88:4F",
+	}
+	if diff := cmp.Diff(expectedV2, v2, float64FuzzyCompOpt); diff != "" {
+		t.Fatal("Unexpected RAWv2 tag data (-want +got):\n", diff)
+	}
+
+	v1 := h.Data.Tags["D1:2A:3B:4C:5D:6E"]
+	for _, field := range []string{"movementCounter", "txPower", "measurementSequenceNumber", "id"} {
+		if _, ok := v1[field]; ok {
+			t.Error("RAWv1 tag data should not contain field", field)
+		}
+	}
+	if v1["dataFormat"] != 3.0 {
+		t.Error("Wrong data format for RAWv1 tag:", v1["dataFormat"])
+	}
+}
+
+func TestHistoryTimeFilter(t *testing.T) {
+	s := newTestServer(Config{})
+	s.Update("CB:B8:33:4C:88:4F", -53, rawv2Advertisement, now.Add(-5*time.Second))
+	s.Update("D1:2A:3B:4C:5D:6E", -70, rawv1Advertisement, now.Add(-60*time.Second))
+
+	for _, tc := range []struct {
+		query    string
+		status   int
+		expected int
+	}{
+		{"", http.StatusOK, 2},
+		{"?time=10", http.StatusOK, 1},
+		{"?time=100", http.StatusOK, 2},
+		{"?time=abc", http.StatusBadRequest, 0},
+	} {
+		resp, body := get(t, s, "/history"+tc.query, nil)
+		if resp.StatusCode != tc.status {
+			t.Fatalf("%q: unexpected status code %d", tc.query, resp.StatusCode)
+		}
+		if tc.status != http.StatusOK {
+			continue
+		}
+		var h historyResponse
+		if err := json.Unmarshal(body, &h); err != nil {
+			t.Fatal("Failed to unmarshal response:", err)
+		}
+		if len(h.Data.Tags) != tc.expected {
+			t.Fatalf("%q: expected %d tags, got %d", tc.query, tc.expected, len(h.Data.Tags))
+		}
+	}
+}
+
+func TestBearerAuthentication(t *testing.T) {
+	s := newTestServer(Config{BearerToken: "secret"})
+
+	for _, tc := range []struct {
+		authorization string
+		status        int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Basic c2VjcmV0", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	} {
+		header := http.Header{}
+		if tc.authorization != "" {
+			header.Set("Authorization", tc.authorization)
+		}
+		resp, _ := get(t, s, "/history", header)
+		if resp.StatusCode != tc.status {
+			t.Errorf("%q: expected status %d, got %d", tc.authorization, tc.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestUnknownPathAndMethod(t *testing.T) {
+	s := newTestServer(Config{})
+
+	if resp, _ := get(t, s, "/metrics", nil); resp.StatusCode != http.StatusNotFound {
+		t.Error("Expected 404 for unknown path, got", resp.StatusCode)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/history", nil)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Error("Expected 405 for POST, got", rec.Code)
+	}
+}
+
+func TestUpdateCopiesData(t *testing.T) {
+	s := newTestServer(Config{})
+	data := make([]byte, len(rawv2Advertisement))
+	copy(data, rawv2Advertisement)
+
+	s.Update("CB:B8:33:4C:88:4F", -53, data, now)
+	data[3] = 0x00
+
+	h := s.history(0)
+	if h.Data.Tags["CB:B8:33:4C:88:4F"].Data != "0201061BFF99040512FC5394C37C0004FFFC040CAC364200CDCBB8334C884F" {
+		t.Fatal("Stored data was modified through caller's buffer")
+	}
+}
@@ -4,6 +4,7 @@ go 1.15
 
 require (
 	github.com/google/go-cmp v0.5.4
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/paypal/gatt v0.0.0-20151011220935-4ae819d591cf
 	tinygo.org/x/bluetooth v0.2.0
 )
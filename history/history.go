@@ -0,0 +1,197 @@
+// Package history downloads the environmental data logged by RuuviTag firmware 3.x over the Nordic UART Service.
+//
+// The client writes a log read request with the current time and the start of the requested range,
+// and the tag streams back one record per logged value until an end of log marker:
+//
+//	request:  3A 3A 11 <current time> <start time>
+//	record:   3A 30 10 <timestamp> <value>    temperature, 0.01 °C
+//	          3A 31 10 <timestamp> <value>    humidity, 0.01 %
+//	          3A 32 10 <timestamp> <value>    pressure, Pa
+//	end:      3A 3A 10 FFFFFFFF FFFFFFFF
+//
+// Times are seconds since the Unix epoch and values are signed, all big endian 32 bit integers.
+// Messages are encoded and decoded with package endpoints.
+// Described here: https://docs.ruuvi.com/communication/bluetooth-connection/nordic-uart-service-nus/log-read
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/LassiHeikkila/go-ruuvi/endpoints"
+	"github.com/LassiHeikkila/go-ruuvi/nus"
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// DefaultTimeout is how long Client waits for the next record by default
+const DefaultTimeout = 10 * time.Second
+
+// ErrTimeout is returned when the tag stops sending records before the end of log
+var ErrTimeout = errors.New("Timed out waiting for history records")
+
+// Record holds the values a tag logged at the same time
+type Record struct {
+	// Timestamp is the time the values were logged, according to the clock of the tag
+	Timestamp time.Time
+
+	// Measurements holds the logged temperature, humidity and pressure, each marked valid if the tag sent it.
+	// DataFormat is 5, so that the record can be given to ruuvi.Encode.
+	ruuvi.Measurements
+}
+
+// Reading returns the record as a reading of the tag with given MAC address, with the values encoded
+// into RAWv2 data like a broadcast would have them, and all other fields invalid.
+// The reading can be processed like readings from a live scanner, e.g. stored to fill in gaps.
+func (r Record) Reading(mac string) (ruuvi.Reading, error) {
+	b, err := ruuvi.Encode(r.Measurements)
+	if err != nil {
+		return ruuvi.Reading{}, err
+	}
+	d, err := ruuvi.ProcessAdvertisement(b)
+	if err != nil {
+		return ruuvi.Reading{}, err
+	}
+	return ruuvi.Reading{Timestamp: r.Timestamp, MAC: mac, Data: d}, nil
+}
+
+// LogReadRequest returns the request for environmental records logged at or after from.
+// now is the current time, which the tag uses to timestamp the records.
+func LogReadRequest(now, from time.Time) []byte {
+	m := endpoints.NewLogRead(endpoints.EndpointEnvironmental, endpoints.LogRead{Now: now, Start: from})
+	return m.AppendBinary(nil)
+}
+
+// Client downloads history from a tag over a Nordic UART Service connection
+type Client struct {
+	t nus.Transport
+
+	// Timeout is how long to wait for the next record before giving up, DefaultTimeout by default
+	Timeout time.Duration
+
+	// now returns the current time, which the tag is told in each request
+	now func() time.Time
+}
+
+// NewClient returns a Client using connection t
+func NewClient(t nus.Transport) *Client {
+	return &Client{t: t, Timeout: DefaultTimeout, now: time.Now}
+}
+
+// Read requests the records logged between from and to, inclusive, and receives them until the end of log.
+// A zero to means no end. Values logged at the same time are combined into one record.
+//
+// If the tag stops sending records for longer than Timeout, the records received so far are returned
+// with ErrTimeout, and if ctx is done, with the error of ctx.
+func (c *Client) Read(ctx context.Context, from, to time.Time) ([]Record, error) {
+	if err := c.t.Send(ctx, LogReadRequest(c.now(), from)); err != nil {
+		return nil, fmt.Errorf("Failed to send log read request: %w", err)
+	}
+
+	var records []Record
+	err := c.receiveRecords(ctx, &records)
+	return filter(records, from, to), err
+}
+
+// receiveRecords adds received records to records until the end of log
+func (c *Client) receiveRecords(ctx context.Context, records *[]Record) error {
+	for {
+		b, err := c.receive(ctx)
+		if err != nil {
+			return err
+		}
+		msgs, err := endpoints.Split(b)
+		if err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			end, err := parseRecord(m, records)
+			if err != nil || end {
+				return err
+			}
+		}
+	}
+}
+
+// receive returns the next notification, or ErrTimeout if none arrives in time
+func (c *Client) receive(ctx context.Context) ([]byte, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	rctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	b, err := c.t.Receive(rctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if rctx.Err() != nil {
+			return nil, ErrTimeout
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// parseRecord adds record m to records, merging it with the last one if it was logged at the same time.
+// Messages of other endpoints and operations, e.g. responses to other requests, are ignored.
+func parseRecord(m endpoints.Message, records *[]Record) (end bool, err error) {
+	if m.Destination != endpoints.EndpointEnvironmental || m.Operation != endpoints.OpLogValueWrite {
+		return false, nil
+	}
+	if m.IsEndOfLog() {
+		return true, nil
+	}
+	lv, err := m.LogValue()
+	if err != nil {
+		return false, err
+	}
+
+	var f ruuvi.Field
+	switch m.Source {
+	case endpoints.EndpointTemperature:
+		f = ruuvi.FieldTemperature
+	case endpoints.EndpointHumidity:
+		f = ruuvi.FieldHumidity
+	case endpoints.EndpointPressure:
+		f = ruuvi.FieldPressure
+	case endpoints.EndpointEnvironmental:
+		return false, fmt.Errorf("Unexpected record %v", m)
+	default:
+		return false, nil
+	}
+
+	t, v := lv.Timestamp, lv.Value
+	rs := *records
+	if len(rs) == 0 || !rs[len(rs)-1].Timestamp.Equal(t) || rs[len(rs)-1].Valid.Has(f) {
+		rs = append(rs, Record{Timestamp: t, Measurements: ruuvi.Measurements{DataFormat: 5}})
+	}
+	r := &rs[len(rs)-1]
+	switch f {
+	case ruuvi.FieldTemperature:
+		r.Temperature = float64(v) / 100
+	case ruuvi.FieldHumidity:
+		r.Humidity = float64(v) / 100
+	case ruuvi.FieldPressure:
+		r.Pressure = int(v)
+	}
+	r.Set(f)
+	*records = rs
+	return false, nil
+}
+
+// filter returns the records logged between from and to, the tag may send some from before
+func filter(records []Record, from, to time.Time) []Record {
+	from = from.Truncate(time.Second)
+	out := records[:0]
+	for _, r := range records {
+		if r.Timestamp.Before(from) || !to.IsZero() && r.Timestamp.After(to) {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
@@ -0,0 +1,204 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/LassiHeikkila/go-ruuvi/endpoints"
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// fakeTag is a NUS peer answering log read requests with its records
+type fakeTag struct {
+	// records are sent as notifications after a log read request, followed by end of log unless stall is set
+	records [][]byte
+	stall   bool
+
+	requests      [][]byte
+	notifications chan []byte
+}
+
+func newFakeTag(records ...[]byte) *fakeTag {
+	return &fakeTag{records: records, notifications: make(chan []byte, len(records)+1)}
+}
+
+func (f *fakeTag) Send(ctx context.Context, b []byte) error {
+	f.requests = append(f.requests, b)
+	var m endpoints.Message
+	if m.UnmarshalBinary(b) != nil || m.Operation != endpoints.OpLogValueRead {
+		return errors.New("unexpected request")
+	}
+	for _, r := range f.records {
+		f.notifications <- r
+	}
+	if !f.stall {
+		f.notifications <- endpoints.NewEndOfLog(endpoints.EndpointEnvironmental).AppendBinary(nil)
+	}
+	return nil
+}
+
+func (f *fakeTag) Receive(ctx context.Context) ([]byte, error) {
+	select {
+	case b := <-f.notifications:
+		return b, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func record(endpoint byte, ts uint32, v int32) []byte {
+	return []byte{
+		0x3A, endpoint, 0x10,
+		byte(ts >> 24), byte(ts >> 16), byte(ts >> 8), byte(ts),
+		byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v),
+	}
+}
+
+func expectedRecord(ts int64, temp, hum float64, pres int) Record {
+	r := Record{Timestamp: time.Unix(ts, 0).UTC(), Measurements: ruuvi.Measurements{DataFormat: 5}}
+	r.Temperature, r.Humidity, r.Pressure = temp, hum, pres
+	r.Set(ruuvi.FieldTemperature | ruuvi.FieldHumidity | ruuvi.FieldPressure)
+	return r
+}
+
+var now = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestClient(tag *fakeTag) *Client {
+	c := NewClient(tag)
+	c.now = func() time.Time { return now }
+	return c
+}
+
+func TestLogReadRequest(t *testing.T) {
+	expected := []byte{0x3A, 0x3A, 0x11, 0x60, 0xB6, 0x21, 0x40, 0x60, 0xB4, 0xCF, 0xC0}
+	if diff := cmp.Diff(expected, LogReadRequest(now, now.Add(-24*time.Hour))); diff != "" {
+		t.Error(diff)
+	}
+	expected = []byte{0x3A, 0x3A, 0x11, 0x60, 0xB6, 0x21, 0x40, 0, 0, 0, 0}
+	if diff := cmp.Diff(expected, LogReadRequest(now, time.Time{})); diff != "" {
+		t.Error("zero from:", diff)
+	}
+}
+
+func TestRead(t *testing.T) {
+	tag := newFakeTag(
+		record(0x30, 1000, 2431),
+		record(0x31, 1000, 5349),
+		record(0x32, 1000, 100044),
+		// several records in one notification
+		append(record(0x30, 1300, -150), append(record(0x31, 1300, 4012), record(0x32, 1300, 99870)...)...),
+		// unrelated message
+		[]byte{0x20, 0x20, 0x01, 0, 0, 0, 0, 0, 0, 0, 0},
+		record(0x30, 1600, 2000),
+		record(0x31, 1600, 5000),
+		record(0x32, 1600, 101000),
+		// unknown sensor
+		record(0x33, 1600, 1),
+	)
+	c := newTestClient(tag)
+
+	records, err := c.Read(context.Background(), time.Unix(1000, 0), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Record{
+		expectedRecord(1000, 24.31, 53.49, 100044),
+		expectedRecord(1300, -1.5, 40.12, 99870),
+		expectedRecord(1600, 20, 50, 101000),
+	}
+	if diff := cmp.Diff(expected, records); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([][]byte{LogReadRequest(now, time.Unix(1000, 0))}, tag.requests); diff != "" {
+		t.Error("request:", diff)
+	}
+
+	// records outside the range are left out
+	records, err = c.Read(context.Background(), time.Unix(1001, 500), time.Unix(1300, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expected[1:2], records); diff != "" {
+		t.Error("range:", diff)
+	}
+}
+
+func TestReadPartialRecords(t *testing.T) {
+	// pressure missing, and a repeated temperature starts a new record
+	tag := newFakeTag(
+		record(0x30, 1000, 2431),
+		record(0x31, 1000, 5349),
+		record(0x30, 1000, 2432),
+	)
+	records, err := newTestClient(tag).Read(context.Background(), time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := Record{Timestamp: time.Unix(1000, 0).UTC(), Measurements: ruuvi.Measurements{DataFormat: 5, Temperature: 24.31, Humidity: 53.49}}
+	first.Set(ruuvi.FieldTemperature | ruuvi.FieldHumidity)
+	second := Record{Timestamp: time.Unix(1000, 0).UTC(), Measurements: ruuvi.Measurements{DataFormat: 5, Temperature: 24.32}}
+	second.Set(ruuvi.FieldTemperature)
+	if diff := cmp.Diff([]Record{first, second}, records); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	tag := newFakeTag(record(0x30, 1000, 2431), record(0x31, 1000, 5349))
+	tag.stall = true
+	c := newTestClient(tag)
+	c.Timeout = 10 * time.Millisecond
+
+	records, err := c.Read(context.Background(), time.Time{}, time.Time{})
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	if len(records) != 1 || !records[0].Valid.Has(ruuvi.FieldTemperature|ruuvi.FieldHumidity) {
+		t.Errorf("expected records received before timeout, got %+v", records)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tag = newFakeTag()
+	tag.stall = true
+	if _, err := newTestClient(tag).Read(ctx, time.Time{}, time.Time{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	for name, notification := range map[string][]byte{
+		"length":            {0x3A, 0x30, 0x10},
+		"unexpected record": {0x3A, 0x3A, 0x10, 0, 0, 0, 1, 0, 0, 0, 1},
+	} {
+		tag := newFakeTag(notification)
+		if _, err := newTestClient(tag).Read(context.Background(), time.Time{}, time.Time{}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestRecordReading(t *testing.T) {
+	r, err := expectedRecord(1000, 24.31, 53.49, 100044).Reading("C5:1A:2B:3C:4D:5E")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Timestamp.Equal(time.Unix(1000, 0)) || r.MAC != "C5:1A:2B:3C:4D:5E" || r.Data.DataFormat() != 5 {
+		t.Errorf("unexpected reading %+v", r)
+	}
+	if v, err := r.Data.Temperature(); err != nil || math.Abs(v-24.31) > 1e-9 {
+		t.Errorf("expected temperature 24.31, got %v, %v", v, err)
+	}
+	if v, err := r.Data.Pressure(); err != nil || v != 100044 {
+		t.Errorf("expected pressure 100044, got %v, %v", v, err)
+	}
+	if _, err := r.Data.BatteryVoltage(); !errors.Is(err, ruuvi.ErrInvalidValue) {
+		t.Errorf("expected invalid battery voltage, got %v", err)
+	}
+}
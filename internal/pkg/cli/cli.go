@@ -0,0 +1,218 @@
+// Package cli implements the subcommands of the ruuvi command line tool
+package cli
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/LassiHeikkila/go-ruuvi/csvio"
+	"github.com/LassiHeikkila/go-ruuvi/lineprotocol"
+	"github.com/LassiHeikkila/go-ruuvi/pretty"
+	"github.com/LassiHeikkila/go-ruuvi/registry"
+	"github.com/LassiHeikkila/go-ruuvi/replay"
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// Env contains the input and outputs of a command
+type Env struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, env Env, args []string) error
+}
+
+var commands = []command{
+	{"decode", "decode hex encoded advertisement payloads", runDecode},
+	{"encode", "encode field values into an advertisement payload", runEncode},
+	{"scan", "scan for advertisements of nearby ruuvitags", runScan},
+	{"convert", "convert readings from JSON lines, CSV or JSON to any output format, including line protocol", runConvert},
+}
+
+// errUsage is returned by commands when arguments are invalid and usage has been printed
+var errUsage = errors.New("invalid usage")
+
+// Run runs the subcommand named by the first argument and returns the exit code
+func Run(ctx context.Context, env Env, args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		usage(env.Stderr)
+		return 2
+	}
+	for _, c := range commands {
+		if c.name != args[0] {
+			continue
+		}
+		err := c.run(ctx, env, args[1:])
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, errUsage), errors.Is(err, flag.ErrHelp):
+			return 2
+		default:
+			fmt.Fprintf(env.Stderr, "ruuvi %s: %s\n", c.name, err)
+			return 1
+		}
+	}
+	fmt.Fprintf(env.Stderr, "ruuvi: unknown command %q\n", args[0])
+	usage(env.Stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: ruuvi <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'ruuvi <command> -h' for flags of a command.")
+}
+
+func newFlagSet(env Env, name string, argsUsage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(env.Stderr, "Usage: ruuvi %s [flags] %s\n\nFlags:\n", name, argsUsage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses flags, returning errUsage on failure since flag package has already reported the error
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	return nil
+}
+
+// parsePayload decodes hex manufacturer data, with or without the Ruuvi company ID prefix.
+// Payloads without the prefix start with the data format byte.
+func parsePayload(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	s = strings.NewReplacer(" ", "", ":", "").Replace(s)
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex payload %q: %w", s, err)
+	}
+	if !ruuvi.IsAdvertisementFromRuuviTag(b) {
+		b = append([]byte{0x99, 0x04}, b...)
+	}
+	if len(b) < 3 {
+		return nil, fmt.Errorf("payload %q is too short", s)
+	}
+	return b, nil
+}
+
+// openInput returns stdin if path is empty or "-", otherwise the named file
+func openInput(env Env, path string) (io.ReadCloser, error) {
+	if path == "" || path == "-" {
+		return ioutil.NopCloser(env.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+// readingWriter is implemented by writers of all output formats
+type readingWriter interface {
+	Write(ruuvi.Reading) error
+	Flush() error
+}
+
+const outputFormats = "text, json, jsonl, csv or influx"
+
+// newReadingWriter returns a writer of given format. If tagInfo is set, CSV output has tag metadata columns.
+func newReadingWriter(w io.Writer, format string, tagInfo bool) (readingWriter, error) {
+	switch format {
+	case "text":
+		return &textWriter{w: w}, nil
+	case "json":
+		return &jsonWriter{w: w}, nil
+	case "jsonl":
+		return &recordingWriter{r: replay.NewRecorder(w)}, nil
+	case "csv":
+		return csvio.NewWriter(w, csvio.Options{TagInfo: tagInfo}), nil
+	case "influx":
+		return lineprotocol.NewWriter(w), nil
+	}
+	return nil, fmt.Errorf("unknown output format %q, expected %s", format, outputFormats)
+}
+
+type recordingWriter struct {
+	r *replay.Recorder
+}
+
+func (w *recordingWriter) Write(r ruuvi.Reading) error { return w.r.Record(r) }
+func (w *recordingWriter) Flush() error                { return nil }
+
+// jsonWriter writes each reading as a JSON line, see ruuvi.Reading.MarshalJSON
+type jsonWriter struct {
+	w io.Writer
+}
+
+func (w *jsonWriter) Write(r ruuvi.Reading) error {
+	if r.Data == nil {
+		return nil
+	}
+	b, err := r.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w.w, string(b))
+	return err
+}
+
+// loadRegistry loads the tag registry at path, or returns nil if path is empty
+func loadRegistry(path string) (*registry.Registry, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return registry.Load(path)
+}
+
+// reportUnknown writes a summary of tags seen but not in reg, so they can be added to it
+func reportUnknown(w io.Writer, reg *registry.Registry) {
+	if reg == nil {
+		return
+	}
+	for _, u := range reg.Unknown() {
+		if u.UnexpectedFormat {
+			fmt.Fprintf(w, "tag %s broadcast unexpected data format %d (%d readings)\n", u.MAC, u.DataFormat, u.Count)
+			continue
+		}
+		fmt.Fprintf(w, "unknown tag %s with data format %d (%d readings, last seen %s)\n", u.MAC, u.DataFormat, u.Count, u.LastSeen.Format(time.RFC3339))
+	}
+}
+
+func (w *jsonWriter) Flush() error { return nil }
+
+// textWriter writes readings in human readable form, see pretty.WriteReading
+type textWriter struct {
+	w io.Writer
+}
+
+func (w *textWriter) Write(r ruuvi.Reading) error {
+	if err := pretty.WriteReading(w.w, r); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w.w)
+	return err
+}
+
+func (w *textWriter) Flush() error { return nil }
@@ -0,0 +1,336 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/LassiHeikkila/go-ruuvi/pretty"
+	"github.com/LassiHeikkila/go-ruuvi/replay"
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+const (
+	rawv2Hex = "99040512FC5394C37C0004FFFC040CAC364200CDCBB8334C884F"
+	rawv1Hex = "990403291A1ECE1EFC18F94202CA0B53"
+)
+
+const recording = `{"timestamp":"2021-03-31T09:31:31.5Z","mac":"CB:B8:33:4C:88:4F","rssi":-53,"data":"99040512fc5394c37c0004fffc040cac364200cdcbb8334c884f"}
+{"timestamp":"2021-03-31T09:31:32.5Z","mac":"D1:2A:3B:4C:5D:6E","rssi":-70,"data":"990403291a1ece1efc18f94202ca0b53"}
+`
+
+func run(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := Run(context.Background(), Env{Stdin: strings.NewReader(stdin), Stdout: &stdout, Stderr: &stderr}, args)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestUsage(t *testing.T) {
+	if code, _, stderr := run(t, ""); code != 2 || !strings.Contains(stderr, "decode") {
+		t.Fatal("Expected usage, got", code, stderr)
+	}
+	if code, _, stderr := run(t, "", "frobnicate"); code != 2 || !strings.Contains(stderr, "unknown command") {
+		t.Fatal("Expected unknown command error, got", code, stderr)
+	}
+	if code, _, _ := run(t, "", "decode", "-nosuchflag"); code != 2 {
+		t.Fatal("Expected exit code 2 for unknown flag, got", code)
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	// without company ID prefix
+	code, stdout, stderr := run(t, "", "decode", rawv2Hex[4:])
+	if code != 0 {
+		t.Fatal("decode failed:", stderr)
+	}
+	for _, expected := range []string{"Temperature", "24.300 °C", "100044 Pa", "CB:B8:33:4C:88:4F", "Measurement sequence number  205"} {
+		if !strings.Contains(stdout, expected) {
+			t.Errorf("Output does not contain %q:\n%s", expected, stdout)
+		}
+	}
+
+	b, err := parsePayload(rawv2Hex)
+	if err != nil {
+		t.Fatal("parsePayload() returned error:", err)
+	}
+	d, err := ruuvi.ProcessAdvertisement(b)
+	if err != nil {
+		t.Fatal("ProcessAdvertisement() returned error:", err)
+	}
+	if diff := cmp.Diff(pretty.Format(d)+"\n", stdout); diff != "" {
+		t.Fatal("Output differs from pretty.Format (-want +got):\n", diff)
+	}
+}
+
+func TestDecodeJSONFromStdin(t *testing.T) {
+	stdin := "# comment\n0x" + rawv2Hex + "\n\n" + strings.ToLower(rawv1Hex) + "\n"
+	code, stdout, stderr := run(t, stdin, "decode", "-json")
+	if code != 0 {
+		t.Fatal("decode failed:", stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 2 {
+		t.Fatal("Expected 2 lines of output, got:\n", stdout)
+	}
+	if !strings.Contains(lines[0], `"format":5`) || !strings.Contains(lines[1], `"format":3`) {
+		t.Fatal("Unexpected output:\n", stdout)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	code, _, stderr := run(t, "", "decode", rawv2Hex, "zz", "9904", "990402")
+	if code != 1 {
+		t.Fatal("Expected exit code 1, got", code)
+	}
+	if !strings.Contains(stderr, "failed to decode 3 of 4 payloads") {
+		t.Fatal("Unexpected error output:", stderr)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	code, stdout, stderr := run(t, "", "encode",
+		"-temperature", "24.3", "-humidity", "53.49", "-pressure", "100044",
+		"-accel-x", "0.004", "-accel-y", "-0.004", "-accel-z", "1.036",
+		"-voltage", "2.977", "-tx-power", "4", "-movement", "66", "-sequence", "205",
+		"-mac", "CB:B8:33:4C:88:4F")
+	if code != 0 {
+		t.Fatal("encode failed:", stderr)
+	}
+	if diff := cmp.Diff(rawv2Hex+"\n", stdout); diff != "" {
+		t.Fatal("Unexpected output (-want +got):\n", diff)
+	}
+
+	// fields left out are encoded as invalid
+	code, stdout, stderr = run(t, "", "encode", "-noprefix", "-temperature", "24.3")
+	if code != 0 {
+		t.Fatal("encode failed:", stderr)
+	}
+	if diff := cmp.Diff("0512FCFFFFFFFF800080008000FFFFFFFFFFFFFFFFFFFFFF\n", stdout); diff != "" {
+		t.Fatal("Unexpected output (-want +got):\n", diff)
+	}
+
+	code, stdout, stderr = run(t, "", "encode", "-format", "3",
+		"-temperature", "26.3", "-humidity", "20.5", "-pressure", "102766",
+		"-accel-x", "-1", "-accel-y", "-1.726", "-accel-z", "0.714", "-voltage", "2.899")
+	if code != 0 {
+		t.Fatal("encode failed:", stderr)
+	}
+	if diff := cmp.Diff(rawv1Hex+"\n", stdout); diff != "" {
+		t.Fatal("Unexpected output (-want +got):\n", diff)
+	}
+
+	if code, _, _ := run(t, "", "encode", "-temperature", "500"); code != 1 {
+		t.Fatal("Expected failure for out of range value, got", code)
+	}
+	if code, _, _ := run(t, "", "encode", "-format", "4"); code != 1 {
+		t.Fatal("Expected failure for unsupported format, got", code)
+	}
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	_, encoded, _ := run(t, "", "encode", "-temperature", "-12.5", "-humidity", "80")
+	code, stdout, stderr := run(t, encoded, "decode")
+	if code != 0 {
+		t.Fatal("decode failed:", stderr)
+	}
+	if !strings.Contains(stdout, "-12.500 °C") || !strings.Contains(stdout, "80.0000 %") {
+		t.Fatal("Unexpected output:\n", stdout)
+	}
+}
+
+type sliceSource []ruuvi.Reading
+
+func (s sliceSource) Run(ctx context.Context, out chan<- ruuvi.Reading) error {
+	for _, r := range s {
+		out <- r
+	}
+	return nil
+}
+
+func TestScanFilter(t *testing.T) {
+	p := replay.NewReplayer(strings.NewReader(recording))
+	p.Speed = 0
+	var readings sliceSource
+	ch := make(chan ruuvi.Reading, 10)
+	if err := p.Run(context.Background(), ch); err != nil {
+		t.Fatal("Run() returned error:", err)
+	}
+	close(ch)
+	for r := range ch {
+		readings = append(readings, r)
+	}
+
+	orig := newScanner
+	defer func() { newScanner = orig }()
+	newScanner = func() ruuvi.Source { return readings }
+
+	code, stdout, stderr := run(t, "", "scan", "-format", "jsonl", "-mac", "d1:2a:3b:4c:5d:6e")
+	if code != 0 {
+		t.Fatal("scan failed:", stderr)
+	}
+	if diff := cmp.Diff(strings.Split(recording, "\n")[1]+"\n", stdout); diff != "" {
+		t.Fatal("Unexpected output (-want +got):\n", diff)
+	}
+
+	if code, _, _ := run(t, "", "scan", "-mac", "not-a-mac"); code != 2 {
+		t.Fatal("Expected usage error for invalid MAC, got", code)
+	}
+	if code, _, _ := run(t, "", "scan", "-format", "xml"); code != 1 {
+		t.Fatal("Expected error for unknown format, got", code)
+	}
+}
+
+func TestScanTable(t *testing.T) {
+	orig := newScanner
+	defer func() { newScanner = orig }()
+	newScanner = func() ruuvi.Source {
+		p := replay.NewReplayer(strings.NewReader(recording))
+		p.Speed = 0
+		return p
+	}
+
+	code, stdout, stderr := run(t, "", "scan", "-format", "table", "-registry", writeRegistry(t))
+	if code != 0 {
+		t.Fatal("scan failed:", stderr)
+	}
+	if !strings.Contains(stdout, "CB:B8:33:4C:88:4F  Freezer 2           5     24.30") || !strings.Contains(stdout, "D1:2A:3B:4C:5D:6E  -                   3     26.30") {
+		t.Fatalf("Unexpected table output: %q", stdout)
+	}
+	if !strings.Contains(stderr, "unknown tag D1:2A:3B:4C:5D:6E with data format 3 (1 readings") {
+		t.Fatalf("Expected unknown tag to be reported, got %q", stderr)
+	}
+}
+
+// writeRegistry writes a registry file naming the RAWv2 tag of the recording and returns its path
+func writeRegistry(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tags.json")
+	config := `{"tags": [{"mac": "cb:b8:33:4c:88:4f", "name": "Freezer 2", "location": "Kitchen", "labels": {"floor": "1"}}]}`
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestScanSimulated(t *testing.T) {
+	code, stdout, stderr := run(t, "", "scan", "-simulate", "2", "-duration", "1500ms", "-format", "influx")
+	if code != 0 {
+		t.Fatal("scan failed:", stderr)
+	}
+	if n := strings.Count(stdout, "\n"); n < 2 || n%2 != 0 {
+		t.Fatalf("Expected full rounds of 2 simulated tags, got %d lines:\n%s", n, stdout)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	code, csv, stderr := run(t, recording, "convert", "-from", "jsonl", "-to", "csv")
+	if code != 0 {
+		t.Fatal("convert failed:", stderr)
+	}
+	if n := strings.Count(csv, "\n"); n != 3 {
+		t.Fatalf("Expected header and 2 rows, got:\n%s", csv)
+	}
+
+	code, jsonl, stderr := run(t, csv, "convert", "-from", "csv", "-to", "jsonl")
+	if code != 0 {
+		t.Fatal("convert failed:", stderr)
+	}
+	if diff := cmp.Diff(recording, jsonl); diff != "" {
+		t.Fatal("JSON lines changed in round trip through CSV (-want +got):\n", diff)
+	}
+
+	code, js, stderr := run(t, recording, "convert", "-to", "json")
+	if code != 0 {
+		t.Fatal("convert failed:", stderr)
+	}
+	code, jsonl, stderr = run(t, js, "convert", "-from", "json", "-to", "jsonl")
+	if code != 0 || stderr != "" {
+		t.Fatal("convert failed:", stderr)
+	}
+	if diff := cmp.Diff(recording, jsonl); diff != "" {
+		t.Fatal("JSON lines changed in round trip through JSON (-want +got):\n", diff)
+	}
+
+	// stored fields not matching the raw data are reported, and the raw data wins
+	tampered := strings.Replace(js, `"temperature":24.3`, `"temperature":30`, 1)
+	code, jsonl, stderr = run(t, tampered, "convert", "-from", "json", "-to", "jsonl")
+	if code != 0 || stderr != "line 1: Stored fields do not match raw data: temperature: stored 30, decoded 24.3\n" {
+		t.Fatalf("Expected mismatch to be reported, got %d: %s", code, stderr)
+	}
+	if diff := cmp.Diff(recording, jsonl); diff != "" {
+		t.Fatal("Expected readings decoded from raw data (-want +got):\n", diff)
+	}
+
+	code, influx, stderr := run(t, recording, "convert", "-to", "influx", "-")
+	if code != 0 {
+		t.Fatal("convert failed:", stderr)
+	}
+	if !strings.HasPrefix(influx, "ruuvi,mac=CB:B8:33:4C:88:4F,data_format=5 temperature=24.3,") {
+		t.Fatal("Unexpected output:\n", influx)
+	}
+
+	code, text, stderr := run(t, recording, "convert", "-to", "text")
+	if code != 0 {
+		t.Fatal("convert failed:", stderr)
+	}
+	p := replay.NewReplayer(strings.NewReader(recording))
+	p.Speed = 0
+	ch := make(chan ruuvi.Reading, 10)
+	if err := p.Run(context.Background(), ch); err != nil {
+		t.Fatal("Run() returned error:", err)
+	}
+	close(ch)
+	var expected strings.Builder
+	for r := range ch {
+		if err := pretty.WriteReading(&expected, r); err != nil {
+			t.Fatal("WriteReading() returned error:", err)
+		}
+		expected.WriteString("\n")
+	}
+	if diff := cmp.Diff(expected.String(), text); diff != "" {
+		t.Fatal("Output differs from pretty.WriteReading (-want +got):\n", diff)
+	}
+
+	if code, _, _ := run(t, recording, "convert", "-from", "xml"); code != 1 {
+		t.Fatal("Expected error for unknown input format, got", code)
+	}
+}
+
+func TestConvertWithRegistry(t *testing.T) {
+	reg := writeRegistry(t)
+
+	code, csv, stderr := run(t, recording, "convert", "-to", "csv", "-registry", reg)
+	if code != 0 {
+		t.Fatal("convert failed:", stderr)
+	}
+	if !strings.HasSuffix(strings.Split(csv, "\n")[1], ",Freezer 2,Kitchen,floor=1") {
+		t.Fatal("Expected tag metadata in CSV, got:\n", csv)
+	}
+
+	// metadata survives conversion from CSV without the registry
+	code, jsonl, stderr := run(t, csv, "convert", "-from", "csv", "-to", "json")
+	if code != 0 {
+		t.Fatal("convert failed:", stderr)
+	}
+	if !strings.Contains(jsonl, `"labels":{"floor":"1"},"location":"Kitchen"`) || !strings.Contains(jsonl, `"name":"Freezer 2"`) {
+		t.Fatal("Expected tag metadata in JSON, got:\n", jsonl)
+	}
+
+	code, influx, stderr := run(t, recording, "convert", "-to", "influx", "-registry", reg)
+	if code != 0 {
+		t.Fatal("convert failed:", stderr)
+	}
+	if !strings.HasPrefix(influx, `ruuvi,mac=CB:B8:33:4C:88:4F,data_format=5,name=Freezer\ 2,location=Kitchen,floor=1 `) {
+		t.Fatal("Unexpected output:\n", influx)
+	}
+
+	if code, _, _ := run(t, recording, "convert", "-registry", "does-not-exist.json"); code != 1 {
+		t.Fatal("Expected error for unknown input format, got", code)
+	}
+}
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/LassiHeikkila/go-ruuvi/csvio"
+	"github.com/LassiHeikkila/go-ruuvi/registry"
+	"github.com/LassiHeikkila/go-ruuvi/replay"
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+func runConvert(ctx context.Context, env Env, args []string) error {
+	fs := newFlagSet(env, "convert", "[input file]")
+	from := fs.String("from", "jsonl", "Input format: jsonl, csv, or json as written by -to json. Line protocol (influx) is output only, since it has no raw data to decode readings from")
+	to := fs.String("to", "csv", "Output format: "+outputFormats)
+	registryPath := fs.String("registry", "", "Enrich readings with names, locations and labels from this tag registry file, and report unknown tags")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	reg, err := loadRegistry(*registryPath)
+	if err != nil {
+		return err
+	}
+	defer reportUnknown(env.Stderr, reg)
+
+	in, err := openInput(env, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	w, err := newReadingWriter(env.Stdout, *to, reg != nil)
+	if err != nil {
+		return err
+	}
+
+	switch *from {
+	case "jsonl":
+		p := replay.NewReplayer(in)
+		p.Speed = 0
+		err = scan(ctx, p, nil, reg, w)
+	case "csv":
+		err = convertCSV(in, reg, w)
+	case "json":
+		err = convertJSON(in, reg, w, env.Stderr)
+	default:
+		return fmt.Errorf("unknown input format %q, expected jsonl, csv or json", *from)
+	}
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// convertCSV re-decodes raw data of each CSV record and writes it as a reading.
+// Tag metadata in the CSV is kept, unless reg is given and knows the tag.
+func convertCSV(in io.Reader, reg *registry.Registry, w readingWriter) error {
+	r := csvio.NewReader(in, csvio.Options{})
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		d, err := ruuvi.ProcessAdvertisement(append([]byte{0x99, 0x04}, rec.Raw...))
+		if err != nil {
+			return fmt.Errorf("failed to decode raw data of %s at %s: %w", rec.MAC, rec.Timestamp, err)
+		}
+		reading := ruuvi.Reading{Timestamp: rec.Timestamp, MAC: rec.MAC, RSSI: rec.RSSI, Data: d, Tag: rec.Tag}
+		enrich(reg, &reading)
+		if err := w.Write(reading); err != nil {
+			return err
+		}
+	}
+}
+
+// convertJSON reconstructs readings from JSON lines written by jsonWriter and writes them.
+// Lines whose stored fields do not match their raw data are reported to stderr, and converted from the raw data.
+func convertJSON(in io.Reader, reg *registry.Registry, w readingWriter, stderr io.Writer) error {
+	s := bufio.NewScanner(in)
+	s.Buffer(make([]byte, 0, 4096), 1024*1024)
+	for line := 1; s.Scan(); line++ {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+		var reading ruuvi.Reading
+		var mismatch *ruuvi.MismatchError
+		if err := json.Unmarshal(s.Bytes(), &reading); errors.As(err, &mismatch) {
+			fmt.Fprintf(stderr, "line %d: %v\n", line, err)
+		} else if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		enrich(reg, &reading)
+		if err := w.Write(reading); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
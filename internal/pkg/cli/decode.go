@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/LassiHeikkila/go-ruuvi/pretty"
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+func runDecode(ctx context.Context, env Env, args []string) error {
+	fs := newFlagSet(env, "decode", "[payload ...]")
+	asJSON := fs.Bool("json", false, "Output decoded data as JSON, one object per line")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	payloads := fs.Args()
+	if len(payloads) == 0 {
+		// read payloads from stdin, one per line
+		s := bufio.NewScanner(env.Stdin)
+		for s.Scan() {
+			if line := strings.TrimSpace(s.Text()); line != "" && !strings.HasPrefix(line, "#") {
+				payloads = append(payloads, line)
+			}
+		}
+		if err := s.Err(); err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	for _, p := range payloads {
+		if err := decodeOne(env, p, *asJSON); err != nil {
+			fmt.Fprintf(env.Stderr, "%s: %s\n", p, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to decode %d of %d payloads", failed, len(payloads))
+	}
+	return nil
+}
+
+func decodeOne(env Env, payload string, asJSON bool) error {
+	b, err := parsePayload(payload)
+	if err != nil {
+		return err
+	}
+	d, err := ruuvi.ProcessAdvertisement(b)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		j, err := d.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(env.Stdout, string(j))
+		return nil
+	}
+	if err := pretty.Write(env.Stdout, d); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(env.Stdout)
+	return err
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+func runEncode(ctx context.Context, env Env, args []string) error {
+	fs := newFlagSet(env, "encode", "")
+	var m ruuvi.Measurements
+	format := fs.Int("format", 5, "Data format to encode, 3 (RAWv1) or 5 (RAWv2)")
+	noPrefix := fs.Bool("noprefix", false, "Leave out the 0x0499 company ID, output starts with the data format byte")
+	fs.Float64Var(&m.Temperature, "temperature", 0, "Temperature in degrees Celsius")
+	fs.Float64Var(&m.Humidity, "humidity", 0, "Relative humidity in percent")
+	fs.IntVar(&m.Pressure, "pressure", 0, "Atmospheric pressure in Pa")
+	fs.Float64Var(&m.AccelerationX, "accel-x", 0, "Acceleration in X axis in G")
+	fs.Float64Var(&m.AccelerationY, "accel-y", 0, "Acceleration in Y axis in G")
+	fs.Float64Var(&m.AccelerationZ, "accel-z", 0, "Acceleration in Z axis in G")
+	fs.Float64Var(&m.BatteryVoltage, "voltage", 0, "Battery voltage in V")
+	fs.Float64Var(&m.TransmissionPower, "tx-power", 0, "Transmission power in dBm")
+	fs.IntVar(&m.MovementCounter, "movement", 0, "Movement counter")
+	fs.IntVar(&m.MeasurementSequenceNumber, "sequence", 0, "Measurement sequence number")
+	mac := fs.String("mac", "", "MAC address, e.g. CB:B8:33:4C:88:4F")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	// only fields given on the command line are valid, the rest are encoded as invalid
+	fields := map[string]ruuvi.Field{
+		"temperature": ruuvi.FieldTemperature,
+		"humidity":    ruuvi.FieldHumidity,
+		"pressure":    ruuvi.FieldPressure,
+		"accel-x":     ruuvi.FieldAccelerationX,
+		"accel-y":     ruuvi.FieldAccelerationY,
+		"accel-z":     ruuvi.FieldAccelerationZ,
+		"voltage":     ruuvi.FieldBatteryVoltage,
+		"tx-power":    ruuvi.FieldTransmissionPower,
+		"movement":    ruuvi.FieldMovementCounter,
+		"sequence":    ruuvi.FieldMeasurementSequenceNumber,
+		"mac":         ruuvi.FieldMACAddress,
+	}
+	fs.Visit(func(f *flag.Flag) {
+		m.Set(fields[f.Name])
+	})
+	if *mac != "" {
+		var err error
+		if m.MACAddress, err = ruuvi.ParseMAC(*mac); err != nil {
+			return err
+		}
+	}
+	m.DataFormat = int8(*format)
+
+	b, err := ruuvi.Encode(m)
+	if err != nil {
+		return err
+	}
+	if *noPrefix {
+		b = b[2:]
+	}
+	fmt.Fprintln(env.Stdout, strings.ToUpper(hex.EncodeToString(b)))
+	return nil
+}
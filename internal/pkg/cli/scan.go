@@ -0,0 +1,173 @@
+package cli
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/LassiHeikkila/go-ruuvi/pretty"
+	"github.com/LassiHeikkila/go-ruuvi/registry"
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+	"github.com/LassiHeikkila/go-ruuvi/scanner"
+	"github.com/LassiHeikkila/go-ruuvi/simulator"
+)
+
+// newScanner returns a scanner of the Bluetooth adapter with platform default options, used unless -simulate is given
+var newScanner = func() ruuvi.Source { return scanner.New() }
+
+// macFilter is a flag.Value collecting MAC addresses given with repeated flags or comma separated
+type macFilter map[ruuvi.MAC]bool
+
+func (f macFilter) String() string {
+	macs := make([]string, 0, len(f))
+	for mac := range f {
+		macs = append(macs, mac.String())
+	}
+	return strings.Join(macs, ",")
+}
+
+func (f macFilter) Set(s string) error {
+	for _, m := range strings.Split(s, ",") {
+		mac, err := ruuvi.ParseMAC(m)
+		if err != nil {
+			return err
+		}
+		f[mac] = true
+	}
+	return nil
+}
+
+// allows reports whether the BLE address of r, or the MAC address in its payload, is in the filter
+func (f macFilter) allows(r ruuvi.Reading) bool {
+	if len(f) == 0 {
+		return true
+	}
+	if mac, err := ruuvi.ParseMAC(r.MAC); err == nil && f[mac] {
+		return true
+	}
+	if r.Data == nil {
+		return false
+	}
+	mac, err := r.Data.MACAddress()
+	return err == nil && f[mac]
+}
+
+func runScan(ctx context.Context, env Env, args []string) error {
+	fs := newFlagSet(env, "scan", "")
+	macs := macFilter{}
+	fs.Var(macs, "mac", "Only output readings from tag with this MAC address, can be repeated")
+	format := fs.String("format", "text", "Output format: "+outputFormats+", or table for a live view of all tags")
+	duration := fs.Duration("duration", 0, "Stop scanning after this long, zero scans until interrupted")
+	simulate := fs.Int("simulate", 0, "Use given number of simulated tags instead of the Bluetooth adapter")
+	registryPath := fs.String("registry", "", "Enrich readings with names, locations and labels from this tag registry file, and report unknown tags")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	reg, err := loadRegistry(*registryPath)
+	if err != nil {
+		return err
+	}
+	defer reportUnknown(env.Stderr, reg)
+
+	var w readingWriter
+	if *format != "table" {
+		if w, err = newReadingWriter(env.Stdout, *format, reg != nil); err != nil {
+			return err
+		}
+	}
+
+	var src ruuvi.Source
+	if *simulate > 0 {
+		src = simulator.New(simulator.Config{Tags: simulator.DefaultTags(*simulate), Seed: time.Now().UnixNano()}, time.Now())
+	} else {
+		src = newScanner()
+	}
+
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+	if w == nil {
+		return scanTable(ctx, src, macs, reg, env)
+	}
+	return scan(ctx, src, macs, reg, w)
+}
+
+// scanTable shows readings from src allowed by filter as a table updating in place.
+// Readings are enriched by reg if it is not nil.
+func scanTable(ctx context.Context, src ruuvi.Source, filter macFilter, reg *registry.Registry, env Env) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	readings := make(chan ruuvi.Reading)
+	filtered := make(chan ruuvi.Reading)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- src.Run(ctx, readings)
+		close(readings)
+	}()
+	go func() {
+		defer close(filtered)
+		for r := range readings {
+			if filter.allows(r) {
+				enrich(reg, &r)
+				filtered <- r
+			}
+		}
+	}()
+
+	if err := pretty.NewTable().Live(ctx, filtered, env.Stdout, 500*time.Millisecond); err != nil {
+		cancel()
+		for range filtered {
+		}
+		return err
+	}
+	cancel()
+	for range filtered {
+	}
+	return <-errs
+}
+
+// enrich attaches tag metadata from reg to r, unless reg is nil
+func enrich(reg *registry.Registry, r *ruuvi.Reading) {
+	if reg != nil {
+		reg.Enrich(r)
+	}
+}
+
+// scan writes readings from src allowed by filter to w until ctx is done or src is exhausted.
+// Readings are enriched by reg if it is not nil.
+func scan(ctx context.Context, src ruuvi.Source, filter macFilter, reg *registry.Registry, w readingWriter) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	readings := make(chan ruuvi.Reading)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- src.Run(ctx, readings)
+		close(readings)
+	}()
+
+	for r := range readings {
+		if !filter.allows(r) {
+			continue
+		}
+		enrich(reg, &r)
+		if err := w.Write(r); err != nil {
+			cancel()
+			for range readings {
+			}
+			return err
+		}
+		// flush each reading so output can be followed live
+		if err := w.Flush(); err != nil {
+			cancel()
+			for range readings {
+			}
+			return err
+		}
+	}
+	return <-errs
+}
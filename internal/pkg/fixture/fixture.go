@@ -0,0 +1,41 @@
+// Package fixture provides the advertisements used in the tests of several packages.
+package fixture
+
+import (
+	"testing"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+var (
+	// RAWv2 is manufacturer data of data format 5 with all fields valid
+	RAWv2 = []byte{
+		0x99, 0x04,
+		0x05, 0x12, 0xFC, 0x53, 0x94, 0xC3, 0x7C, 0x00,
+		0x04, 0xFF, 0xFC, 0x04, 0x0C, 0xAC, 0x36, 0x42,
+		0x00, 0xCD, 0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F,
+	}
+	// RAWv2Invalid is manufacturer data of data format 5 with all fields invalid
+	RAWv2Invalid = []byte{
+		0x99, 0x04,
+		0x05, 0x80, 0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0x80,
+		0x00, 0x80, 0x00, 0x80, 0x00, 0xFF, 0xFF, 0xFF,
+		0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+	}
+	// RAWv1 is manufacturer data of data format 3
+	RAWv1 = []byte{
+		0x99, 0x04,
+		0x03, 0x29, 0x1A, 0x1E, 0xCE, 0x1E, 0xFC,
+		0x18, 0xF9, 0x42, 0x02, 0xCA, 0x0B, 0x53,
+	}
+)
+
+// Process returns b processed with ruuvi.ProcessAdvertisement, failing the test on error
+func Process(t testing.TB, b []byte) ruuvi.AdvertisementData {
+	t.Helper()
+	d, err := ruuvi.ProcessAdvertisement(b)
+	if err != nil {
+		t.Fatal("ProcessAdvertisement() returned error:", err)
+	}
+	return d
+}
@@ -0,0 +1,266 @@
+package measurement
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// descriptor holds the format independent metadata of a field, and reads its value
+type descriptor struct {
+	field   Field
+	name    string
+	label   string
+	unit    string
+	integer bool
+	read    func(g Getter, m *Measurements) error
+}
+
+// descriptors lists every field in a fixed order, which is also the order of Fields
+var descriptors = []descriptor{
+	{Temperature, "temperature", "Temperature", "°C", false, func(g Getter, m *Measurements) (err error) {
+		m.Temperature, err = g.Temperature()
+		return err
+	}},
+	{Humidity, "humidity", "Humidity", "%", false, func(g Getter, m *Measurements) (err error) {
+		m.Humidity, err = g.Humidity()
+		return err
+	}},
+	{Pressure, "pressure", "Pressure", "Pa", true, func(g Getter, m *Measurements) (err error) {
+		m.Pressure, err = g.Pressure()
+		return err
+	}},
+	{AccelerationX, "accel-x", "Acceleration X", "G", false, func(g Getter, m *Measurements) (err error) {
+		m.AccelerationX, err = g.AccelerationX()
+		return err
+	}},
+	{AccelerationY, "accel-y", "Acceleration Y", "G", false, func(g Getter, m *Measurements) (err error) {
+		m.AccelerationY, err = g.AccelerationY()
+		return err
+	}},
+	{AccelerationZ, "accel-z", "Acceleration Z", "G", false, func(g Getter, m *Measurements) (err error) {
+		m.AccelerationZ, err = g.AccelerationZ()
+		return err
+	}},
+	{BatteryVoltage, "voltage", "Battery voltage", "V", false, func(g Getter, m *Measurements) (err error) {
+		m.BatteryVoltage, err = g.BatteryVoltage()
+		return err
+	}},
+	{TransmissionPower, "tx-power", "TX power", "dBm", false, func(g Getter, m *Measurements) (err error) {
+		m.TransmissionPower, err = g.TransmissionPower()
+		return err
+	}},
+	{MovementCounter, "movement-count", "Movement counter", "", true, func(g Getter, m *Measurements) (err error) {
+		m.MovementCounter, err = g.MovementCounter()
+		return err
+	}},
+	{MeasurementSequenceNumber, "meas-seq", "Measurement sequence number", "", true, func(g Getter, m *Measurements) (err error) {
+		m.MeasurementSequenceNumber, err = g.MeasurementSequenceNumber()
+		return err
+	}},
+	{MACAddress, "mac", "MAC address", "", false, func(g Getter, m *Measurements) (err error) {
+		m.MACAddress, err = g.MACAddress()
+		return err
+	}},
+}
+
+// Fields returns every field in a fixed order
+func Fields() []Field {
+	fields := make([]Field, len(descriptors))
+	for i, d := range descriptors {
+		fields[i] = d.field
+	}
+	return fields
+}
+
+func describe(f Field) (descriptor, bool) {
+	for _, d := range descriptors {
+		if d.field == f {
+			return d, true
+		}
+	}
+	return descriptor{}, false
+}
+
+// String returns the name of a single field, as used for JSON keys
+func (f Field) String() string {
+	if d, ok := describe(f); ok {
+		return d.name
+	}
+	return "Field(" + strconv.Itoa(int(f)) + ")"
+}
+
+// Label returns the human readable name of a single field, e.g. "Battery voltage"
+func (f Field) Label() string {
+	d, _ := describe(f)
+	return d.label
+}
+
+// Unit returns the unit of a single field, or an empty string for counters and the MAC address
+func (f Field) Unit() string {
+	d, _ := describe(f)
+	return d.unit
+}
+
+// Integer reports whether a single field holds whole numbers
+func (f Field) Integer() bool {
+	d, _ := describe(f)
+	return d.integer
+}
+
+// Getter is implemented by decoded advertisements of every data format, see ruuvi.AdvertisementData
+type Getter interface {
+	DataFormat() int8
+	Temperature() (float64, error)
+	Humidity() (float64, error)
+	Pressure() (int, error)
+	AccelerationX() (float64, error)
+	AccelerationY() (float64, error)
+	AccelerationZ() (float64, error)
+	BatteryVoltage() (float64, error)
+	TransmissionPower() (float64, error)
+	MovementCounter() (int, error)
+	MeasurementSequenceNumber() (int, error)
+	MACAddress() (MAC, error)
+}
+
+// Of returns the values of g, with the fields g returns without error marked valid
+func Of(g Getter) Measurements {
+	m := Measurements{DataFormat: g.DataFormat()}
+	for _, d := range descriptors {
+		if d.read(g, &m) == nil {
+			m.Set(d.field)
+		}
+	}
+	return m
+}
+
+// Read reads the value of a single field f of g into m, marking it valid if g returns it without error.
+// The error of g is returned.
+func Read(g Getter, f Field, m *Measurements) error {
+	d, ok := describe(f)
+	if !ok {
+		return fmt.Errorf("%v: %w", f, ErrUnsupported)
+	}
+	if err := d.read(g, m); err != nil {
+		return err
+	}
+	m.Set(f)
+	return nil
+}
+
+// Value returns the value of numeric field f in m, or 0 for the MAC address and unknown fields.
+// Validity is not checked, see m.Valid.
+func (m *Measurements) Value(f Field) float64 {
+	switch f {
+	case Temperature:
+		return m.Temperature
+	case Humidity:
+		return m.Humidity
+	case Pressure:
+		return float64(m.Pressure)
+	case AccelerationX:
+		return m.AccelerationX
+	case AccelerationY:
+		return m.AccelerationY
+	case AccelerationZ:
+		return m.AccelerationZ
+	case BatteryVoltage:
+		return m.BatteryVoltage
+	case TransmissionPower:
+		return m.TransmissionPower
+	case MovementCounter:
+		return float64(m.MovementCounter)
+	case MeasurementSequenceNumber:
+		return float64(m.MeasurementSequenceNumber)
+	}
+	return 0
+}
+
+// SetValue sets numeric field f of m to v, rounded for integer fields, and marks it valid.
+// The MAC address and unknown fields are left unchanged.
+func (m *Measurements) SetValue(f Field, v float64) {
+	switch f {
+	case Temperature:
+		m.Temperature = v
+	case Humidity:
+		m.Humidity = v
+	case Pressure:
+		m.Pressure = int(math.Round(v))
+	case AccelerationX:
+		m.AccelerationX = v
+	case AccelerationY:
+		m.AccelerationY = v
+	case AccelerationZ:
+		m.AccelerationZ = v
+	case BatteryVoltage:
+		m.BatteryVoltage = v
+	case TransmissionPower:
+		m.TransmissionPower = v
+	case MovementCounter:
+		m.MovementCounter = int(math.Round(v))
+	case MeasurementSequenceNumber:
+		m.MeasurementSequenceNumber = int(math.Round(v))
+	default:
+		return
+	}
+	m.Set(f)
+}
+
+// FieldInfo describes a field as supported by a data format
+type FieldInfo struct {
+	Field Field
+	// Name is the name of the field, as used for JSON keys
+	Name string
+	// Label is the human readable name of the field, e.g. "Battery voltage"
+	Label string
+	// Unit is the unit of the value, empty for counters and the MAC address
+	Unit string
+	// Resolution is the smallest step between values, 0 for the MAC address
+	Resolution float64
+	// Min and Max are the limits of valid values, both 0 for the MAC address
+	Min, Max float64
+}
+
+// Describe returns FieldInfo of f with given resolution and range of valid values
+func Describe(f Field, resolution, min, max float64) FieldInfo {
+	d, _ := describe(f)
+	return FieldInfo{Field: f, Name: d.name, Label: d.label, Unit: d.unit, Resolution: resolution, Min: min, Max: max}
+}
+
+// Capabilities lists the fields supported by a data format
+type Capabilities struct {
+	DataFormat int8
+	// Fields are in the order of Fields()
+	Fields []FieldInfo
+}
+
+// Copy returns c with its own copy of Fields, so that the caller can modify it
+func (c Capabilities) Copy() Capabilities {
+	c.Fields = append([]FieldInfo(nil), c.Fields...)
+	return c
+}
+
+// Supported returns the set of supported fields
+func (c Capabilities) Supported() Field {
+	var s Field
+	for _, f := range c.Fields {
+		s |= f.Field
+	}
+	return s
+}
+
+// Supports reports whether all fields in f are supported
+func (c Capabilities) Supports(f Field) bool {
+	return c.Supported().Has(f)
+}
+
+// Info returns FieldInfo of a single field, if supported
+func (c Capabilities) Info(f Field) (FieldInfo, bool) {
+	for _, i := range c.Fields {
+		if i.Field == f {
+			return i, true
+		}
+	}
+	return FieldInfo{}, false
+}
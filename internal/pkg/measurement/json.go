@@ -0,0 +1,93 @@
+package measurement
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// jsonKey is a key of the JSON object, either a field or one of "format" and "raw" which have no Field
+type jsonKey struct {
+	name  string
+	field Field
+}
+
+// jsonKeys lists the keys of all fields plus "format" and "raw", sorted like encoding/json sorts map keys
+var jsonKeys = func() []jsonKey {
+	keys := []jsonKey{{name: "format"}, {name: "raw"}}
+	for _, d := range descriptors {
+		keys = append(keys, jsonKey{name: d.name, field: d.field})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].name < keys[j].name })
+	return keys
+}()
+
+// AppendJSON appends m as a JSON object to b and returns the extended buffer.
+// Only fields in m.Valid are included, raw is included hex encoded.
+// The output is identical to what encoding/json produces for a map of the same keys,
+// so keys are in sorted order, but nothing is allocated if b has enough capacity.
+func AppendJSON(b []byte, m *Measurements, raw []byte) []byte {
+	b = append(b, '{')
+	first := true
+	for _, k := range jsonKeys {
+		if k.field != 0 && !m.Valid.Has(k.field) {
+			continue
+		}
+		if !first {
+			b = append(b, ',')
+		}
+		first = false
+		b = append(b, '"')
+		b = append(b, k.name...)
+		b = append(b, '"', ':')
+
+		switch {
+		case k.name == "format":
+			b = strconv.AppendInt(b, int64(m.DataFormat), 10)
+		case k.name == "raw":
+			b = append(b, '"')
+			for _, v := range raw {
+				b = append(b, lowerHexDigits[v>>4], lowerHexDigits[v&0xF])
+			}
+			b = append(b, '"')
+		case k.field == MACAddress:
+			b = append(b, '"')
+			for i, v := range m.MACAddress {
+				if i > 0 {
+					b = append(b, ':')
+				}
+				b = append(b, hexDigits[v>>4], hexDigits[v&0xF])
+			}
+			b = append(b, '"')
+		case k.field.Integer():
+			b = strconv.AppendInt(b, int64(m.Value(k.field)), 10)
+		default:
+			b = appendFloat(b, m.Value(k.field))
+		}
+	}
+	return append(b, '}')
+}
+
+const lowerHexDigits = "0123456789abcdef"
+
+// appendFloat formats f like encoding/json does: without exponent unless the value is very small or large
+func appendFloat(b []byte, f float64) []byte {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		// not representable in JSON, cannot come from decoding
+		return append(b, "null"...)
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b = strconv.AppendFloat(b, f, format, -1, 64)
+	if format == 'e' {
+		// clean up e-09 to e-9, like encoding/json
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b
+}
@@ -0,0 +1,74 @@
+package measurement
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// MAC is a 48 bit MAC address. MAC is comparable and can be used as a map key.
+type MAC [6]byte
+
+const hexDigits = "0123456789ABCDEF"
+
+// String returns the MAC address in canonical form: upper case hex bytes separated by colons, e.g. "CB:B8:33:4C:88:4F"
+func (m MAC) String() string {
+	b := make([]byte, 0, 17)
+	for i, v := range m {
+		if i > 0 {
+			b = append(b, ':')
+		}
+		b = append(b, hexDigits[v>>4], hexDigits[v&0xF])
+	}
+	return string(b)
+}
+
+// ParseMAC parses a MAC address. Besides the canonical form, it accepts lower case hex,
+// '-' as separator, and no separators at all, e.g. "cb-b8-33-4c-88-4f" and "CBB8334C884F".
+//
+// For compatibility with data written by earlier versions, colon separated bytes without
+// zero padding are accepted too, e.g. "cb:b8:33:4c:88:f" for "CB:B8:33:4C:88:0F".
+func ParseMAC(s string) (MAC, error) {
+	var m MAC
+
+	var parts []string
+	switch {
+	case strings.Contains(s, ":"):
+		parts = strings.Split(s, ":")
+	case strings.Contains(s, "-"):
+		parts = strings.Split(s, "-")
+	case len(s) == 12:
+		parts = []string{s[0:2], s[2:4], s[4:6], s[6:8], s[8:10], s[10:12]}
+	}
+	if len(parts) != len(m) {
+		return MAC{}, fmt.Errorf("Invalid MAC address %q", s)
+	}
+
+	for i, p := range parts {
+		if len(p) == 1 {
+			p = "0" + p
+		}
+		if len(p) != 2 {
+			return MAC{}, fmt.Errorf("Invalid MAC address %q", s)
+		}
+		if _, err := hex.Decode(m[i:i+1], []byte(p)); err != nil {
+			return MAC{}, fmt.Errorf("Invalid MAC address %q", s)
+		}
+	}
+	return m, nil
+}
+
+// MarshalText implements encoding.TextMarshaler, returning the canonical form
+func (m MAC) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting any form ParseMAC accepts
+func (m *MAC) UnmarshalText(text []byte) error {
+	parsed, err := ParseMAC(string(text))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
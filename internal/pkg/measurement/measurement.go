@@ -0,0 +1,58 @@
+// Package measurement contains the value type shared by data format implementations for encoding and decoding
+package measurement
+
+import "errors"
+
+// Field identifies a single measured field. Fields can be combined into a set with bitwise or.
+type Field uint16
+
+const (
+	Temperature Field = 1 << iota
+	Humidity
+	Pressure
+	AccelerationX
+	AccelerationY
+	AccelerationZ
+	BatteryVoltage
+	TransmissionPower
+	MovementCounter
+	MeasurementSequenceNumber
+	MACAddress
+)
+
+// Has reports whether all fields in g are in f
+func (f Field) Has(g Field) bool {
+	return f&g == g
+}
+
+// Measurements holds the values of a single advertisement.
+// Only the fields listed in Valid are meaningful; when encoding, fields not in Valid are
+// encoded as invalid if the data format has a way to express that.
+type Measurements struct {
+	DataFormat                int8
+	Valid                     Field
+	Temperature               float64 // degrees Celsius
+	Humidity                  float64 // percent
+	Pressure                  int     // Pa
+	AccelerationX             float64 // G
+	AccelerationY             float64 // G
+	AccelerationZ             float64 // G
+	BatteryVoltage            float64 // V
+	TransmissionPower         float64 // dBm
+	MovementCounter           int
+	MeasurementSequenceNumber int
+	MACAddress                MAC
+}
+
+// Set marks field f as valid
+func (m *Measurements) Set(f Field) {
+	m.Valid |= f
+}
+
+var (
+	// ErrUnsupported is wrapped by errors returned when the data format does not contain the requested field
+	ErrUnsupported = errors.New("field not supported by data format")
+
+	// ErrInvalid is wrapped by errors returned when the tag reported the field as invalid
+	ErrInvalid = errors.New("field reported as invalid")
+)
@@ -0,0 +1,150 @@
+package measurement
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMACString(t *testing.T) {
+	mac := MAC{0xCB, 0xB8, 0x03, 0x4C, 0x88, 0x0F}
+	if s := mac.String(); s != "CB:B8:03:4C:88:0F" {
+		t.Fatal("Unexpected String():", s)
+	}
+}
+
+func TestParseMAC(t *testing.T) {
+	expected := MAC{0xCB, 0xB8, 0x03, 0x4C, 0x88, 0x0F}
+	for _, s := range []string{
+		"CB:B8:03:4C:88:0F",
+		"cb:b8:03:4c:88:0f",
+		"cb-b8-03-4c-88-0f",
+		"CBB8034C880F",
+		// unpadded form written by earlier versions
+		"cb:b8:3:4c:88:f",
+	} {
+		mac, err := ParseMAC(s)
+		if err != nil {
+			t.Errorf("ParseMAC(%q) returned error: %v", s, err)
+		} else if mac != expected {
+			t.Errorf("ParseMAC(%q) = %s, expected %s", s, mac, expected)
+		}
+	}
+
+	for _, s := range []string{
+		"",
+		"CB:B8:03:4C:88",
+		"CB:B8:03:4C:88:0F:00",
+		"CB:B8:03:4C:88:0G",
+		"CB:B8:03:4C:88:",
+		"CB:B8:003:4C:88:0F",
+		"CBB8034C880",
+		"CB:B8-03:4C:88:0F",
+	} {
+		if _, err := ParseMAC(s); err == nil {
+			t.Errorf("ParseMAC(%q) should fail", s)
+		}
+	}
+}
+
+func TestMACText(t *testing.T) {
+	type tag struct {
+		MAC MAC `json:"mac"`
+	}
+	b, err := json.Marshal(tag{MAC{0x0A, 0x0B, 0x00, 0x4C, 0x88, 0x0F}})
+	if err != nil {
+		t.Fatal("Marshal returned error:", err)
+	}
+	if string(b) != `{"mac":"0A:0B:00:4C:88:0F"}` {
+		t.Fatal("Unexpected JSON:", string(b))
+	}
+
+	var got tag
+	if err := json.Unmarshal([]byte(`{"mac":"a:b:0:4c:88:f"}`), &got); err != nil {
+		t.Fatal("Unmarshal returned error:", err)
+	}
+	if got.MAC != (MAC{0x0A, 0x0B, 0x00, 0x4C, 0x88, 0x0F}) {
+		t.Fatal("Unexpected MAC:", got.MAC)
+	}
+	if err := json.Unmarshal([]byte(`{"mac":"not a mac"}`), &got); err == nil {
+		t.Fatal("Expected error for invalid MAC")
+	}
+
+	// usable as map key
+	seen := map[MAC]int{}
+	seen[got.MAC]++
+	seen[MAC{0x0A, 0x0B, 0x00, 0x4C, 0x88, 0x0F}]++
+	if len(seen) != 1 {
+		t.Fatal("Equal MACs should be the same map key")
+	}
+}
+
+func TestAppendJSONMatchesEncodingJSON(t *testing.T) {
+	for _, m := range []Measurements{
+		{
+			DataFormat: 5, Valid: 0xFFFF,
+			Temperature: -12.345, Humidity: 0.0000001, Pressure: 100044,
+			AccelerationX: 1e21, AccelerationY: -0.004, AccelerationZ: 0,
+			BatteryVoltage: 2.977, TransmissionPower: 4, MovementCounter: 66,
+			MeasurementSequenceNumber: 205, MACAddress: MAC{0x0A, 0xB8, 0x33, 0x4C, 0x88, 0x4F},
+		},
+		{DataFormat: 3},
+	} {
+		raw := []byte{0x05, 0x0A, 0xFF}
+		expected := map[string]interface{}{
+			"format": m.DataFormat,
+			"raw":    "050aff",
+		}
+		if m.Valid != 0 {
+			expected["temperature"] = m.Temperature
+			expected["humidity"] = m.Humidity
+			expected["pressure"] = m.Pressure
+			expected["accel-x"] = m.AccelerationX
+			expected["accel-y"] = m.AccelerationY
+			expected["accel-z"] = m.AccelerationZ
+			expected["voltage"] = m.BatteryVoltage
+			expected["tx-power"] = m.TransmissionPower
+			expected["movement-count"] = m.MovementCounter
+			expected["meas-seq"] = m.MeasurementSequenceNumber
+			expected["mac"] = m.MACAddress
+		}
+		b, err := json.Marshal(expected)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := AppendJSON(nil, &m, raw); string(got) != string(b) {
+			t.Errorf("AppendJSON() = %s\nexpected %s", got, b)
+		}
+	}
+}
+
+func TestFieldMetadata(t *testing.T) {
+	fields := Fields()
+	if len(fields) != 11 {
+		t.Fatalf("Expected 11 fields, got %d", len(fields))
+	}
+	var all Field
+	for _, f := range fields {
+		if strings.HasPrefix(f.String(), "Field(") || f.Label() == "" {
+			t.Errorf("Field %d has no name or label", f)
+		}
+		all |= f
+	}
+	if all != MACAddress<<1-1 {
+		t.Errorf("Fields() does not cover every field: %b", all)
+	}
+	if s := (Temperature | Humidity).String(); s != "Field(3)" {
+		t.Error("Unexpected String() of a set of fields:", s)
+	}
+	if Pressure.Unit() != "Pa" || !Pressure.Integer() || Humidity.Integer() || BatteryVoltage.Label() != "Battery voltage" {
+		t.Error("Unexpected pressure, humidity or battery voltage metadata")
+	}
+
+	c := Capabilities{DataFormat: 9, Fields: []FieldInfo{Describe(Humidity, 0.5, 0, 100), Describe(MACAddress, 0, 0, 0)}}
+	if c.Supported() != Humidity|MACAddress || !c.Supports(Humidity|MACAddress) || c.Supports(Humidity|Pressure) {
+		t.Error("Unexpected supported fields:", c.Supported())
+	}
+	if info, ok := c.Info(Humidity); !ok || info.Name != "humidity" || info.Unit != "%" || info.Max != 100 {
+		t.Errorf("Unexpected humidity info %+v", info)
+	}
+}
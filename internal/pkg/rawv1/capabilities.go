@@ -0,0 +1,27 @@
+package rawv1
+
+import "github.com/LassiHeikkila/go-ruuvi/internal/pkg/measurement"
+
+// capabilities lists the fields of RAWv1 with resolution and range from the data format specification
+var capabilities = measurement.Capabilities{
+	DataFormat: 3,
+	Fields: []measurement.FieldInfo{
+		measurement.Describe(measurement.Temperature, 0.01, -127.99, 127.99),
+		measurement.Describe(measurement.Humidity, 0.5, 0, 127.5),
+		measurement.Describe(measurement.Pressure, 1, 50000, 115535),
+		measurement.Describe(measurement.AccelerationX, 0.001, -32.767, 32.767),
+		measurement.Describe(measurement.AccelerationY, 0.001, -32.767, 32.767),
+		measurement.Describe(measurement.AccelerationZ, 0.001, -32.767, 32.767),
+		measurement.Describe(measurement.BatteryVoltage, 0.001, 0, 65.535),
+	},
+}
+
+// Capabilities returns the fields supported by RAWv1
+func Capabilities() measurement.Capabilities {
+	return capabilities.Copy()
+}
+
+// Capabilities returns the fields supported by RAWv1
+func (d *DataRAWv1) Capabilities() measurement.Capabilities {
+	return capabilities.Copy()
+}
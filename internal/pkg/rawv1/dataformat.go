@@ -1,11 +1,10 @@
 package rawv1
 
 import (
-	"encoding/binary"
-	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
+
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/measurement"
 )
 
 // DataRAWv1 is a concrete implementation of AdvertisementData interface
@@ -14,24 +13,39 @@ type DataRAWv1 struct {
 	rawBytes []byte
 }
 
-// NewDataRAWv1 returns pointer to DataRAWv1 wrapping
+// errors returned for data which is not RAWv1, preallocated so decoding does not allocate
+var (
+	errNotRAWv1 = errors.New("Data is not RAWv1 (3)")
+	errTooShort = errors.New("Data is too short to be valid, expected 14 bytes")
+)
+
+// NewDataRAWv1 returns pointer to DataRAWv1 wrapping d.
+// An error is returned, instead of panicking, if d is not valid RAWv1 data of sufficient length.
 func NewDataRAWv1(d []byte) (*DataRAWv1, error) {
-	if determineDataVersion(d) != 3 {
-		return nil, errors.New("Data is not RAWv1 (3)")
-	}
-	if len(d) < 14 {
-		return nil, errors.New("Data is too short to be valid, expected 14 bytes")
+	if err := check(d); err != nil {
+		return nil, err
 	}
 
 	return &DataRAWv1{rawBytes: d}, nil
 }
 
+// check returns an error if d is not RAWv1 data
+func check(d []byte) error {
+	if len(d) == 0 || determineDataVersion(d) != 3 {
+		return errNotRAWv1
+	}
+	if len(d) < Length {
+		return errTooShort
+	}
+	return nil
+}
+
 func determineDataVersion(d []byte) int8 {
 	return int8(d[0])
 }
 
 func dataNotAvailable(whatData string) error {
-	return fmt.Errorf("%s is not available with data format RAWv1 (3)", whatData)
+	return fmt.Errorf("%s is not available with data format RAWv1 (3): %w", whatData, measurement.ErrUnsupported)
 }
 
 // Copy copies the raw bytes internally so the AdvertisementData object is safe to use for a longer time.
@@ -48,70 +62,40 @@ func (d *DataRAWv1) DataFormat() int8 { return 3 }
 
 // Temperature returns measured temperature in degrees Celsius
 func (d *DataRAWv1) Temperature() (float64, error) {
-	t1 := d.rawBytes[2] & 0b01111111
-	negative := d.rawBytes[2]&0b10000000 > 0
-	t2 := d.rawBytes[3]
-
-	if t2 > 99 {
-		return 0, errors.New("Temperature fractional part exceeds maximum value")
+	if v, ok := temperature(d.rawBytes); ok {
+		return v, nil
 	}
-	var mult float64
-	if negative {
-		mult = -1.0
-	} else {
-		mult = 1.0
-	}
-
-	temp := (float64(t1) + (float64(t2) / 100.0)) * mult
-
-	return temp, nil
+	return 0, fmt.Errorf("Temperature fractional part exceeds maximum value: %w", measurement.ErrInvalid)
 }
 
 // Humidity returns measured humidity as percentage
 func (d *DataRAWv1) Humidity() (float64, error) {
-	b := d.rawBytes[1]
-
-	humidity := float64(b) * 0.5
-	return humidity, nil
+	return humidity(d.rawBytes), nil
 }
 
 // Pressure returns measured atmospheric pressure with unit Pa (pascal)
 func (d *DataRAWv1) Pressure() (int, error) {
-	pb := d.rawBytes[4:6]
-
-	pres := binary.BigEndian.Uint16(pb)
-	return int(pres) + 50000, nil
+	return pressure(d.rawBytes), nil
 }
 
 // AccelerationX returns the acceleration in X axis with unit G, if supported by data format
 func (d *DataRAWv1) AccelerationX() (float64, error) {
-	b := d.rawBytes[6:8]
-	acc := int16(binary.BigEndian.Uint16(b))
-	gs := float64(acc) / 1000.0
-	return gs, nil
+	return acceleration(d.rawBytes, 6), nil
 }
 
 // AccelerationY returns the acceleration in Y axis with unit G, if supported by data format
 func (d *DataRAWv1) AccelerationY() (float64, error) {
-	b := d.rawBytes[8:10]
-	acc := int16(binary.BigEndian.Uint16(b))
-	gs := float64(acc) / 1000.0
-	return gs, nil
+	return acceleration(d.rawBytes, 8), nil
 }
 
 // AccelerationZ returns the acceleration in Z axis with unit G, if supported by data format
 func (d *DataRAWv1) AccelerationZ() (float64, error) {
-	b := d.rawBytes[10:12]
-	acc := int16(binary.BigEndian.Uint16(b))
-	gs := float64(acc) / 1000.0
-	return gs, nil
+	return acceleration(d.rawBytes, 10), nil
 }
 
 // BatteryVoltage returns battery voltage with unit V (volt), if supported by data format
 func (d *DataRAWv1) BatteryVoltage() (float64, error) {
-	b := d.rawBytes[12:14]
-	millivolts := binary.BigEndian.Uint16(b)
-	return float64(millivolts) / 1000, nil
+	return batteryVoltage(d.rawBytes), nil
 }
 
 // TransmissionPower returns transmission power with unit dBm, if supported by data format
@@ -130,8 +114,8 @@ func (d *DataRAWv1) MeasurementSequenceNumber() (int, error) {
 }
 
 // MACAddress returns MAC address (48 bits / 6 bytes) of broadcasting ruuvitag, if supported by data format
-func (d *DataRAWv1) MACAddress() ([]byte, error) {
-	return nil, dataNotAvailable("MAC address")
+func (d *DataRAWv1) MACAddress() (measurement.MAC, error) {
+	return measurement.MAC{}, dataNotAvailable("MAC address")
 }
 
 // RawData returns the raw bytes. Make sure to copy the data, or it may be overwritten by the next broadcast.
@@ -141,31 +125,7 @@ func (d *DataRAWv1) RawData() []byte {
 
 // MarshalJSON outputs available data as JSON
 func (d *DataRAWv1) MarshalJSON() ([]byte, error) {
-	m := make(map[string]interface{}, 8)
-
-	m["raw"] = hex.EncodeToString(d.rawBytes)
-	m["format"] = d.DataFormat()
-	if t, err := d.Temperature(); err == nil {
-		m["temperature"] = t
-	}
-	if h, err := d.Humidity(); err == nil {
-		m["humidity"] = h
-	}
-	if p, err := d.Pressure(); err == nil {
-		m["pressure"] = p
-	}
-	if a, err := d.AccelerationX(); err == nil {
-		m["accel-x"] = a
-	}
-	if a, err := d.AccelerationY(); err == nil {
-		m["accel-y"] = a
-	}
-	if a, err := d.AccelerationZ(); err == nil {
-		m["accel-z"] = a
-	}
-	if v, err := d.BatteryVoltage(); err == nil {
-		m["voltage"] = v
-	}
-
-	return json.Marshal(&m)
+	var m measurement.Measurements
+	decode(d.rawBytes, &m)
+	return measurement.AppendJSON(make([]byte, 0, 192), &m, d.rawBytes), nil
 }
@@ -1,9 +1,12 @@
 package rawv1
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/measurement"
 )
 
 func TestValidData(t *testing.T) {
@@ -187,22 +190,34 @@ func TestErrorReturnedOnUnsupportedValues(t *testing.T) {
 	}
 	rawv1, _ := NewDataRAWv1(validExampleData)
 
-	if _, err := rawv1.TransmissionPower(); err == nil {
-		t.Fatal("TransmissionPower() did not return error")
+	if _, err := rawv1.TransmissionPower(); !errors.Is(err, measurement.ErrUnsupported) {
+		t.Fatal("TransmissionPower() did not return ErrUnsupported")
+	}
+
+	if _, err := rawv1.MovementCounter(); !errors.Is(err, measurement.ErrUnsupported) {
+		t.Fatal("MovementCounter() did not return ErrUnsupported")
 	}
 
-	if _, err := rawv1.MovementCounter(); err == nil {
-		t.Fatal("MovementCounter() did not return error")
+	if _, err := rawv1.MeasurementSequenceNumber(); !errors.Is(err, measurement.ErrUnsupported) {
+		t.Fatal("MeasurementSequenceNumber() did not return ErrUnsupported")
 	}
 
-	if _, err := rawv1.MeasurementSequenceNumber(); err == nil {
-		t.Fatal("MeasurementSequenceNumber() did not return error")
+	if _, err := rawv1.MACAddress(); !errors.Is(err, measurement.ErrUnsupported) {
+		t.Fatal("MACAddress() did not return ErrUnsupported")
 	}
 
-	if _, err := rawv1.MACAddress(); err == nil {
-		t.Fatal("MACAddress() did not return error")
+}
+
+func TestInvalidTemperatureFraction(t *testing.T) {
+	data := []byte{
+		0x03, 0x29, 0x1A, 0x64, 0xCE, 0x1E, 0xFC,
+		0x18, 0xF9, 0x42, 0x02, 0xCA, 0x0B, 0x53,
 	}
+	rawv1, _ := NewDataRAWv1(data)
 
+	if _, err := rawv1.Temperature(); !errors.Is(err, measurement.ErrInvalid) {
+		t.Fatal("Temperature() did not return ErrInvalid for fraction over 99")
+	}
 }
 
 func TestRawData(t *testing.T) {
@@ -217,6 +232,23 @@ func TestRawData(t *testing.T) {
 	}
 }
 
+func TestMarshalBinaryText(t *testing.T) {
+	validExampleData := []byte{
+		0x03, 0x29, 0x1A, 0x1E, 0xCE, 0x1E, 0xFC,
+		0x18, 0xF9, 0x42, 0x02, 0xCA, 0x0B, 0x53,
+	}
+	d, _ := NewDataRAWv1(validExampleData)
+
+	b, _ := d.MarshalBinary()
+	text, _ := d.MarshalText()
+	if !cmp.Equal(validExampleData, b) || string(text) != "03291a1ece1efc18f94202ca0b53" {
+		t.Fatalf("Unexpected marshalled data %x, %s", b, text)
+	}
+	if v, err := d.Value(); err != nil || !cmp.Equal(validExampleData, v.([]byte)) {
+		t.Errorf("Value() = %v, %v", v, err)
+	}
+}
+
 func TestDataModifiedWithoutCopy(t *testing.T) {
 	data := []byte{
 		0x03, 0x29, 0x1A, 0x1E, 0xCE, 0x1E, 0xFC,
@@ -273,3 +305,80 @@ func TestErrorReturnedOnBadInput(t *testing.T) {
 		t.Fatal("No error from too short data")
 	}
 }
+
+func TestEncode(t *testing.T) {
+	all := measurement.Temperature | measurement.Humidity | measurement.Pressure |
+		measurement.AccelerationX | measurement.AccelerationY | measurement.AccelerationZ |
+		measurement.BatteryVoltage
+
+	for _, tc := range []struct {
+		m        measurement.Measurements
+		expected []byte
+	}{
+		{
+			m: measurement.Measurements{
+				DataFormat: 3, Valid: all,
+				Temperature: 26.3, Humidity: 20.5, Pressure: 102766,
+				AccelerationX: -1.0, AccelerationY: -1.726, AccelerationZ: 0.714,
+				BatteryVoltage: 2.899,
+			},
+			expected: []byte{
+				0x03, 0x29, 0x1A, 0x1E, 0xCE, 0x1E, 0xFC,
+				0x18, 0xF9, 0x42, 0x02, 0xCA, 0x0B, 0x53,
+			},
+		},
+		{
+			m: measurement.Measurements{
+				DataFormat: 3, Valid: all,
+				Temperature: 127.99, Humidity: 127.5, Pressure: 115535,
+				AccelerationX: 32.767, AccelerationY: 32.767, AccelerationZ: 32.767,
+				BatteryVoltage: 65.535,
+			},
+			expected: []byte{
+				0x03, 0xFF, 0x7F, 0x63, 0xFF, 0xFF, 0x7F,
+				0xFF, 0x7F, 0xFF, 0x7F, 0xFF, 0xFF, 0xFF,
+			},
+		},
+		{
+			m: measurement.Measurements{
+				DataFormat: 3, Valid: all,
+				Temperature: -127.99, Humidity: 0, Pressure: 50000,
+				AccelerationX: -32.767, AccelerationY: -32.767, AccelerationZ: -32.767,
+				BatteryVoltage: 0,
+			},
+			expected: []byte{
+				0x03, 0x00, 0xFF, 0x63, 0x00, 0x00, 0x80,
+				0x01, 0x80, 0x01, 0x80, 0x01, 0x00, 0x00,
+			},
+		},
+		{
+			m: measurement.Measurements{DataFormat: 3},
+			expected: []byte{
+				0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+			},
+		},
+	} {
+		b, err := Encode(tc.m)
+		if err != nil {
+			t.Fatal("Encode() returned error:", err)
+		}
+		if !cmp.Equal(b, tc.expected) {
+			t.Fatalf("Wrong bytes encoded: %x", b)
+		}
+	}
+}
+
+func TestEncodeOutOfRange(t *testing.T) {
+	for _, m := range []measurement.Measurements{
+		{Valid: measurement.Temperature, Temperature: 128.0},
+		{Valid: measurement.Humidity, Humidity: 128.0},
+		{Valid: measurement.Pressure, Pressure: 49999},
+		{Valid: measurement.AccelerationX, AccelerationX: 33.0},
+		{Valid: measurement.BatteryVoltage, BatteryVoltage: -1.0},
+	} {
+		if _, err := Encode(m); err == nil {
+			t.Errorf("No error from out of range value: %+v", m)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package rawv1
+
+import (
+	"encoding/binary"
+
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/measurement"
+)
+
+// Length is the length of RAWv1 data, starting with the format byte
+const Length = 14
+
+// Decode decodes RAWv1 data (starting with the format byte) into m, without allocating.
+// Fields not supported by RAWv1, or reported as invalid, are left out of m.Valid.
+// m does not refer to d after Decode returns.
+func Decode(d []byte, m *measurement.Measurements) error {
+	if err := check(d); err != nil {
+		return err
+	}
+	*m = measurement.Measurements{}
+	decode(d, m)
+	return nil
+}
+
+// decode decodes the fields of valid RAWv1 data into m
+func decode(d []byte, m *measurement.Measurements) {
+	m.DataFormat = 3
+	var ok bool
+	if m.Temperature, ok = temperature(d); ok {
+		m.Set(measurement.Temperature)
+	}
+	m.Humidity = humidity(d)
+	m.Pressure = pressure(d)
+	m.AccelerationX = acceleration(d, 6)
+	m.AccelerationY = acceleration(d, 8)
+	m.AccelerationZ = acceleration(d, 10)
+	m.BatteryVoltage = batteryVoltage(d)
+	m.Set(measurement.Humidity | measurement.Pressure |
+		measurement.AccelerationX | measurement.AccelerationY | measurement.AccelerationZ |
+		measurement.BatteryVoltage)
+}
+
+// temperature returns false if the fractional part is out of range
+func temperature(d []byte) (float64, bool) {
+	t1 := d[2] & 0b01111111
+	negative := d[2]&0b10000000 > 0
+	t2 := d[3]
+
+	if t2 > 99 {
+		return 0, false
+	}
+	temp := float64(t1) + (float64(t2) / 100.0)
+	if negative {
+		temp = -temp
+	}
+	return temp, true
+}
+
+func humidity(d []byte) float64 {
+	return float64(d[1]) * 0.5
+}
+
+func pressure(d []byte) int {
+	return int(binary.BigEndian.Uint16(d[4:6])) + 50000
+}
+
+// acceleration decodes the axis starting at pos
+func acceleration(d []byte, pos int) float64 {
+	return float64(int16(binary.BigEndian.Uint16(d[pos:pos+2]))) / 1000.0
+}
+
+func batteryVoltage(d []byte) float64 {
+	return float64(binary.BigEndian.Uint16(d[12:14])) / 1000
+}
@@ -0,0 +1,83 @@
+package rawv1
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/measurement"
+)
+
+// Encode returns RAWv1 data (starting with the format byte) containing the given measurements.
+// RAWv1 has no way to mark values invalid, so fields not marked valid are encoded as zero.
+// Values outside the range of the format cause an error.
+func Encode(m measurement.Measurements) ([]byte, error) {
+	b := make([]byte, 14)
+	b[0] = 3
+
+	if m.Valid.Has(measurement.Humidity) {
+		v, err := scaled(m.Humidity, 0.5, 0, 255, "humidity")
+		if err != nil {
+			return nil, err
+		}
+		b[1] = byte(v)
+	}
+
+	if m.Valid.Has(measurement.Temperature) {
+		// sign and magnitude: integer part with sign bit, then fractional part in hundredths
+		v, err := scaled(math.Abs(m.Temperature), 0.01, 0, 12799, "temperature")
+		if err != nil {
+			return nil, err
+		}
+		b[2] = byte(v / 100)
+		b[3] = byte(v % 100)
+		if m.Temperature < 0 && v > 0 {
+			b[2] |= 0b10000000
+		}
+	}
+
+	if m.Valid.Has(measurement.Pressure) {
+		v, err := scaled(float64(m.Pressure-50000), 1, 0, 65535, "pressure")
+		if err != nil {
+			return nil, err
+		}
+		binary.BigEndian.PutUint16(b[4:6], uint16(v))
+	}
+
+	for i, axis := range []struct {
+		field measurement.Field
+		value float64
+		name  string
+	}{
+		{measurement.AccelerationX, m.AccelerationX, "acceleration-x"},
+		{measurement.AccelerationY, m.AccelerationY, "acceleration-y"},
+		{measurement.AccelerationZ, m.AccelerationZ, "acceleration-z"},
+	} {
+		if m.Valid.Has(axis.field) {
+			v, err := scaled(axis.value, 0.001, -32768, 32767, axis.name)
+			if err != nil {
+				return nil, err
+			}
+			binary.BigEndian.PutUint16(b[6+i*2:8+i*2], uint16(int16(v)))
+		}
+	}
+
+	if m.Valid.Has(measurement.BatteryVoltage) {
+		v, err := scaled(m.BatteryVoltage, 0.001, 0, 65535, "battery voltage")
+		if err != nil {
+			return nil, err
+		}
+		binary.BigEndian.PutUint16(b[12:14], uint16(v))
+	}
+
+	return b, nil
+}
+
+// scaled divides v by resolution, rounds to nearest integer and checks it is within [min, max]
+func scaled(v float64, resolution float64, min, max int, what string) (int, error) {
+	s := math.Round(v / resolution)
+	if math.IsNaN(s) || s < float64(min) || s > float64(max) {
+		return 0, fmt.Errorf("Value %v for %s is out of range", v, what)
+	}
+	return int(s), nil
+}
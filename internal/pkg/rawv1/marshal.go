@@ -0,0 +1,26 @@
+package rawv1
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+)
+
+// MarshalBinary implements encoding.BinaryMarshaler, returning a copy of the raw bytes
+func (d *DataRAWv1) MarshalBinary() ([]byte, error) {
+	b := make([]byte, len(d.rawBytes))
+	copy(b, d.rawBytes)
+	return b, nil
+}
+
+// MarshalText implements encoding.TextMarshaler, returning the raw bytes hex encoded
+func (d *DataRAWv1) MarshalText() ([]byte, error) {
+	b := make([]byte, hex.EncodedLen(len(d.rawBytes)))
+	hex.Encode(b, d.rawBytes)
+	return b, nil
+}
+
+// Value implements driver.Valuer, storing the raw bytes as binary.
+// There is no Scan: stored data is loaded with ruuvi.Advertisement, which goes through the data format registry.
+func (d *DataRAWv1) Value() (driver.Value, error) {
+	return d.MarshalBinary()
+}
@@ -0,0 +1,31 @@
+package rawv2
+
+import "github.com/LassiHeikkila/go-ruuvi/internal/pkg/measurement"
+
+// capabilities lists the fields of RAWv2 with resolution and range from the data format specification
+var capabilities = measurement.Capabilities{
+	DataFormat: 5,
+	Fields: []measurement.FieldInfo{
+		measurement.Describe(measurement.Temperature, 0.005, -163.835, 163.835),
+		measurement.Describe(measurement.Humidity, 0.0025, 0, 163.835),
+		measurement.Describe(measurement.Pressure, 1, 50000, 115534),
+		measurement.Describe(measurement.AccelerationX, 0.001, -32.767, 32.767),
+		measurement.Describe(measurement.AccelerationY, 0.001, -32.767, 32.767),
+		measurement.Describe(measurement.AccelerationZ, 0.001, -32.767, 32.767),
+		measurement.Describe(measurement.BatteryVoltage, 0.001, 1.6, 3.646),
+		measurement.Describe(measurement.TransmissionPower, 2, -40, 20),
+		measurement.Describe(measurement.MovementCounter, 1, 0, 254),
+		measurement.Describe(measurement.MeasurementSequenceNumber, 1, 0, 65534),
+		measurement.Describe(measurement.MACAddress, 0, 0, 0),
+	},
+}
+
+// Capabilities returns the fields supported by RAWv2
+func Capabilities() measurement.Capabilities {
+	return capabilities.Copy()
+}
+
+// Capabilities returns the fields supported by RAWv2
+func (d *DataRAWv2) Capabilities() measurement.Capabilities {
+	return capabilities.Copy()
+}
@@ -1,12 +1,10 @@
 package rawv2
 
 import (
-	"bytes"
-	"encoding/binary"
-	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
+
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/measurement"
 )
 
 // DataRAWv2 is a concrete implementation of AdvertisementData interface
@@ -31,6 +29,9 @@ func (iv *InvalidValue) Error() string {
 
 // Is makes it possible to use errors.Is() on this error type
 func (iv *InvalidValue) Is(target error) bool {
+	if target == measurement.ErrInvalid {
+		return true
+	}
 	switch target.(type) {
 	case *InvalidValue:
 		return true
@@ -39,24 +40,39 @@ func (iv *InvalidValue) Is(target error) bool {
 	}
 }
 
-// NewDataRAWv2 returns pointer to DataRAWv2 wrapping
+// errors returned for data which is not RAWv2, preallocated so decoding does not allocate
+var (
+	errNotRAWv2 = errors.New("Data is not RAWv2 (5)")
+	errTooShort = errors.New("Data is too short to be valid, expected 24 bytes")
+)
+
+// NewDataRAWv2 returns pointer to DataRAWv2 wrapping d.
+// An error is returned, instead of panicking, if d is not valid RAWv2 data of sufficient length.
 func NewDataRAWv2(d []byte) (*DataRAWv2, error) {
-	if determineDataVersion(d) != 5 {
-		return nil, errors.New("Data is not RAWv2 (5)")
-	}
-	if len(d) < 24 {
-		return nil, errors.New("Data is too short to be valid, expected 14 bytes")
+	if err := check(d); err != nil {
+		return nil, err
 	}
 
 	return &DataRAWv2{rawBytes: d}, nil
 }
 
+// check returns an error if d is not RAWv2 data
+func check(d []byte) error {
+	if len(d) == 0 || determineDataVersion(d) != 5 {
+		return errNotRAWv2
+	}
+	if len(d) < Length {
+		return errTooShort
+	}
+	return nil
+}
+
 func determineDataVersion(d []byte) int8 {
 	return int8(d[0])
 }
 
 func dataNotAvailable(whatData string) error {
-	return fmt.Errorf("%s is not available with data format RAWv2 (5)", whatData)
+	return fmt.Errorf("%s is not available with data format RAWv2 (5): %w", whatData, measurement.ErrUnsupported)
 }
 
 // Copy copies the raw bytes internally so the AdvertisementData object is safe to use for a longer time.
@@ -73,138 +89,90 @@ func (d *DataRAWv2) DataFormat() int8 { return 5 }
 
 // Temperature returns measured temperature in degrees Celsius
 func (d *DataRAWv2) Temperature() (float64, error) {
-	b := d.rawBytes[1:3]
-
-	u := binary.BigEndian.Uint16(b)
-
-	if u == 0x8000 {
-		return 0.0, newInvalidValue("temperature")
+	if v, ok := temperature(d.rawBytes); ok {
+		return v, nil
 	}
-
-	temp := float64(int16(u)) * 0.005
-
-	return temp, nil
+	return 0.0, newInvalidValue("temperature")
 }
 
 // Humidity returns measured humidity as percentage
 func (d *DataRAWv2) Humidity() (float64, error) {
-	b := d.rawBytes[3:5]
-
-	v := binary.BigEndian.Uint16(b)
-	if v == 0xFFFF {
-		return 0.0, newInvalidValue("humidity")
+	if v, ok := humidity(d.rawBytes); ok {
+		return v, nil
 	}
-	humidity := float64(v) * 0.0025
-	return humidity, nil
+	return 0.0, newInvalidValue("humidity")
 }
 
 // Pressure returns measured atmospheric pressure with unit Pa (pascal)
 func (d *DataRAWv2) Pressure() (int, error) {
-	pb := d.rawBytes[5:7]
-
-	pres := binary.BigEndian.Uint16(pb)
-	if pres == 0xFFFF {
-		return 0, newInvalidValue("pressure")
+	if v, ok := pressure(d.rawBytes); ok {
+		return v, nil
 	}
-	return int(pres) + 50000, nil
+	return 0, newInvalidValue("pressure")
 }
 
 // AccelerationX returns the acceleration in X axis with unit G, if supported by data format
 func (d *DataRAWv2) AccelerationX() (float64, error) {
-	b := d.rawBytes[7:9]
-	u := binary.BigEndian.Uint16(b)
-	if u == 0x8000 {
-		return 0.0, newInvalidValue("acceleration-x")
+	if v, ok := acceleration(d.rawBytes, 7); ok {
+		return v, nil
 	}
-	acc := int16(u)
-	gs := float64(acc) / 1000.0
-	return gs, nil
+	return 0.0, newInvalidValue("acceleration-x")
 }
 
 // AccelerationY returns the acceleration in Y axis with unit G, if supported by data format
 func (d *DataRAWv2) AccelerationY() (float64, error) {
-	b := d.rawBytes[9:11]
-	u := binary.BigEndian.Uint16(b)
-	if u == 0x8000 {
-		return 0.0, newInvalidValue("acceleration-y")
+	if v, ok := acceleration(d.rawBytes, 9); ok {
+		return v, nil
 	}
-	acc := int16(u)
-	gs := float64(acc) / 1000.0
-	return gs, nil
+	return 0.0, newInvalidValue("acceleration-y")
 }
 
 // AccelerationZ returns the acceleration in Z axis with unit G, if supported by data format
 func (d *DataRAWv2) AccelerationZ() (float64, error) {
-	b := d.rawBytes[11:13]
-	u := binary.BigEndian.Uint16(b)
-	if u == 0x8000 {
-		return 0.0, newInvalidValue("acceleration-z")
+	if v, ok := acceleration(d.rawBytes, 11); ok {
+		return v, nil
 	}
-	acc := int16(u)
-	gs := float64(acc) / 1000.0
-	return gs, nil
+	return 0.0, newInvalidValue("acceleration-z")
 }
 
 // BatteryVoltage returns battery voltage with unit V (volt), if supported by data format
 func (d *DataRAWv2) BatteryVoltage() (float64, error) {
-	b := d.rawBytes[13:15]
-	v := binary.BigEndian.Uint16(b)
-
-	if v == 0xFFFF {
-		return 0.0, newInvalidValue("battery voltage")
+	if v, ok := batteryVoltage(d.rawBytes); ok {
+		return v, nil
 	}
-
-	v = (v & 0b1111111111100000) >> 5
-
-	return (float64(v) / 1000) + 1.6, nil
+	return 0.0, newInvalidValue("battery voltage")
 }
 
 // TransmissionPower returns transmission power with unit dBm, if supported by data format
 func (d *DataRAWv2) TransmissionPower() (float64, error) {
-	b := d.rawBytes[13:15]
-	v := binary.BigEndian.Uint16(b)
-	if v == 0xFFFF {
-		return 0.0, newInvalidValue("tx power")
+	if v, ok := transmissionPower(d.rawBytes); ok {
+		return v, nil
 	}
-
-	v = v & 0b0000000000011111
-
-	return (float64(v) * 2) - 40.0, nil
+	return 0.0, newInvalidValue("tx power")
 }
 
 // MovementCounter returns number of movements detected by accelerometer, if supported by data format
 func (d *DataRAWv2) MovementCounter() (int, error) {
-	b := d.rawBytes[15]
-
-	if b == 0xFF {
-		return 0, newInvalidValue("movement counter")
+	if v, ok := movementCounter(d.rawBytes); ok {
+		return v, nil
 	}
-
-	return int(b), nil
+	return 0, newInvalidValue("movement counter")
 }
 
 // MeasurementSequenceNumber returns measurement sequence number, if supported by data format
 func (d *DataRAWv2) MeasurementSequenceNumber() (int, error) {
-	b := d.rawBytes[16:18]
-
-	v := binary.BigEndian.Uint16(b)
-
-	if v == 0xFFFF {
-		return 0, newInvalidValue("measurement sequence number")
+	if v, ok := measurementSequenceNumber(d.rawBytes); ok {
+		return v, nil
 	}
-
-	return int(v), nil
+	return 0, newInvalidValue("measurement sequence number")
 }
 
 // MACAddress returns MAC address (48 bits / 6 bytes) of broadcasting ruuvitag, if supported by data format
-func (d *DataRAWv2) MACAddress() ([]byte, error) {
-	b := d.rawBytes[18:24]
-
-	if bytes.Equal(b, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}) {
-		return nil, newInvalidValue("MAC address")
+func (d *DataRAWv2) MACAddress() (measurement.MAC, error) {
+	if v, ok := macAddress(d.rawBytes); ok {
+		return v, nil
 	}
-
-	return b, nil
+	return measurement.MAC{}, newInvalidValue("MAC address")
 }
 
 // RawData returns the raw bytes. Make sure to copy the data, or it may be overwritten by the next broadcast.
@@ -214,43 +182,7 @@ func (d *DataRAWv2) RawData() []byte {
 
 // MarshalJSON outputs available data as JSON
 func (d *DataRAWv2) MarshalJSON() ([]byte, error) {
-	m := make(map[string]interface{}, 13)
-
-	m["raw"] = hex.EncodeToString(d.rawBytes)
-	m["format"] = d.DataFormat()
-	if t, err := d.Temperature(); err == nil {
-		m["temperature"] = t
-	}
-	if h, err := d.Humidity(); err == nil {
-		m["humidity"] = h
-	}
-	if p, err := d.Pressure(); err == nil {
-		m["pressure"] = p
-	}
-	if a, err := d.AccelerationX(); err == nil {
-		m["accel-x"] = a
-	}
-	if a, err := d.AccelerationY(); err == nil {
-		m["accel-y"] = a
-	}
-	if a, err := d.AccelerationZ(); err == nil {
-		m["accel-z"] = a
-	}
-	if v, err := d.BatteryVoltage(); err == nil {
-		m["voltage"] = v
-	}
-	if p, err := d.TransmissionPower(); err == nil {
-		m["tx-power"] = p
-	}
-	if s, err := d.MeasurementSequenceNumber(); err == nil {
-		m["meas-seq"] = s
-	}
-	if c, err := d.MovementCounter(); err == nil {
-		m["movement-count"] = c
-	}
-	if mac, err := d.MACAddress(); err == nil && len(mac) == 6 {
-		m["mac"] = fmt.Sprintf("%x:%x:%x:%x:%x:%x", mac[0], mac[1], mac[2], mac[3], mac[4], mac[5])
-	}
-
-	return json.Marshal(&m)
+	var m measurement.Measurements
+	decode(d.rawBytes, &m)
+	return measurement.AppendJSON(make([]byte, 0, 320), &m, d.rawBytes), nil
 }
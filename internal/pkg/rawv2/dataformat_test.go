@@ -1,11 +1,14 @@
 package rawv2
 
 import (
+	"encoding/json"
 	"errors"
 	"math"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/measurement"
 )
 
 type result struct {
@@ -20,7 +23,7 @@ type result struct {
 	voltage         float64
 	movementCounter int
 	measSequence    int
-	MAC             []byte
+	MAC             measurement.MAC
 }
 
 var float64FuzzyCompOpt = cmp.Comparer(func(x, y float64) bool {
@@ -52,7 +55,7 @@ func TestValidData(t *testing.T) {
 		voltage:         2.977,
 		movementCounter: 66,
 		measSequence:    205,
-		MAC:             []byte{0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F},
+		MAC:             measurement.MAC{0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F},
 	}
 
 	rawv2, err := NewDataRAWv2(validExampleData)
@@ -151,7 +154,7 @@ func TestMaximumValuesData(t *testing.T) {
 		voltage:         3.646,
 		movementCounter: 254,
 		measSequence:    65534,
-		MAC:             []byte{0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F},
+		MAC:             measurement.MAC{0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F},
 	}
 
 	rawv2, err := NewDataRAWv2(validExampleData)
@@ -250,7 +253,7 @@ func TestMinimumValuesData(t *testing.T) {
 		voltage:         1.600,
 		movementCounter: 0,
 		measSequence:    0,
-		MAC:             []byte{0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F},
+		MAC:             measurement.MAC{0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F},
 	}
 
 	rawv2, err := NewDataRAWv2(validExampleData)
@@ -379,6 +382,9 @@ func TestInvalidValues(t *testing.T) {
 	if _, err := rawv2.MACAddress(); !errors.Is(err, &InvalidValue{}) {
 		t.Error("No InvalidValue returned from MACAddress()")
 	}
+	if _, err := rawv2.Temperature(); !errors.Is(err, measurement.ErrInvalid) {
+		t.Error("InvalidValue does not match measurement.ErrInvalid")
+	}
 }
 
 func TestRawData(t *testing.T) {
@@ -394,6 +400,62 @@ func TestRawData(t *testing.T) {
 	}
 }
 
+func TestMarshalJSONMAC(t *testing.T) {
+	rawv2, err := NewDataRAWv2([]byte{
+		0x05, 0x12, 0xFC, 0x53, 0x94, 0xC3, 0x7C, 0x00,
+		0x04, 0xFF, 0xFC, 0x04, 0x0C, 0xAC, 0x36, 0x42,
+		0x00, 0xCD, 0x0A, 0x0B, 0x00, 0x4C, 0x88, 0x0F,
+	})
+	if err != nil {
+		t.Fatal("Error: ", err)
+	}
+	b, err := rawv2.MarshalJSON()
+	if err != nil {
+		t.Fatal("MarshalJSON() returned error:", err)
+	}
+	var m struct {
+		MAC string `json:"mac"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal("Error: ", err)
+	}
+	if m.MAC != "0A:0B:00:4C:88:0F" {
+		t.Fatal("Wrong MAC in JSON:", m.MAC)
+	}
+}
+
+func TestMACAddressIsCopy(t *testing.T) {
+	data := []byte{
+		0x05, 0x12, 0xFC, 0x53, 0x94, 0xC3, 0x7C, 0x00,
+		0x04, 0xFF, 0xFC, 0x04, 0x0C, 0xAC, 0x36, 0x42,
+		0x00, 0xCD, 0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F,
+	}
+	rawv2, _ := NewDataRAWv2(data)
+	mac, _ := rawv2.MACAddress()
+	data[23] = 0x00
+	if mac != (measurement.MAC{0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F}) {
+		t.Fatal("MAC changed along with raw data:", mac)
+	}
+}
+
+func TestMarshalBinaryText(t *testing.T) {
+	validExampleData := []byte{
+		0x05, 0x12, 0xFC, 0x53, 0x94, 0xC3, 0x7C, 0x00,
+		0x04, 0xFF, 0xFC, 0x04, 0x0C, 0xAC, 0x36, 0x42,
+		0x00, 0xCD, 0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F,
+	}
+	d, _ := NewDataRAWv2(validExampleData)
+
+	b, _ := d.MarshalBinary()
+	text, _ := d.MarshalText()
+	if !cmp.Equal(validExampleData, b) || string(text) != "0512fc5394c37c0004fffc040cac364200cdcbb8334c884f" {
+		t.Fatalf("Unexpected marshalled data %x, %s", b, text)
+	}
+	if v, err := d.Value(); err != nil || !cmp.Equal(validExampleData, v.([]byte)) {
+		t.Errorf("Value() = %v, %v", v, err)
+	}
+}
+
 func TestDataModifiedWithoutCopy(t *testing.T) {
 	data := []byte{
 		0x05, 0x12, 0xFC, 0x53, 0x94, 0xC3, 0x7C, 0x00,
@@ -454,3 +516,93 @@ func TestErrorReturnedOnBadInput(t *testing.T) {
 		t.Fatal("No error from too short data")
 	}
 }
+
+func TestEncode(t *testing.T) {
+	all := measurement.Temperature | measurement.Humidity | measurement.Pressure |
+		measurement.AccelerationX | measurement.AccelerationY | measurement.AccelerationZ |
+		measurement.BatteryVoltage | measurement.TransmissionPower | measurement.MovementCounter |
+		measurement.MeasurementSequenceNumber | measurement.MACAddress
+	mac := measurement.MAC{0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F}
+
+	for _, tc := range []struct {
+		m        measurement.Measurements
+		expected []byte
+	}{
+		{
+			m: measurement.Measurements{
+				DataFormat: 5, Valid: all,
+				Temperature: 24.3, Humidity: 53.49, Pressure: 100044,
+				AccelerationX: 0.004, AccelerationY: -0.004, AccelerationZ: 1.036,
+				BatteryVoltage: 2.977, TransmissionPower: 4, MovementCounter: 66,
+				MeasurementSequenceNumber: 205, MACAddress: mac,
+			},
+			expected: []byte{
+				0x05, 0x12, 0xFC, 0x53, 0x94, 0xC3, 0x7C, 0x00,
+				0x04, 0xFF, 0xFC, 0x04, 0x0C, 0xAC, 0x36, 0x42,
+				0x00, 0xCD, 0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F,
+			},
+		},
+		{
+			m: measurement.Measurements{
+				DataFormat: 5, Valid: all,
+				Temperature: 163.835, Humidity: 163.835, Pressure: 115534,
+				AccelerationX: 32.767, AccelerationY: 32.767, AccelerationZ: 32.767,
+				BatteryVoltage: 3.646, TransmissionPower: 20, MovementCounter: 254,
+				MeasurementSequenceNumber: 65534, MACAddress: mac,
+			},
+			expected: []byte{
+				0x05, 0x7F, 0xFF, 0xFF, 0xFE, 0xFF, 0xFE, 0x7F,
+				0xFF, 0x7F, 0xFF, 0x7F, 0xFF, 0xFF, 0xDE, 0xFE,
+				0xFF, 0xFE, 0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F,
+			},
+		},
+		{
+			m: measurement.Measurements{
+				DataFormat: 5, Valid: all,
+				Temperature: -163.835, Humidity: 0, Pressure: 50000,
+				AccelerationX: -32.767, AccelerationY: -32.767, AccelerationZ: -32.767,
+				BatteryVoltage: 1.6, TransmissionPower: -40, MovementCounter: 0,
+				MeasurementSequenceNumber: 0, MACAddress: mac,
+			},
+			expected: []byte{
+				0x05, 0x80, 0x01, 0x00, 0x00, 0x00, 0x00, 0x80,
+				0x01, 0x80, 0x01, 0x80, 0x01, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F,
+			},
+		},
+		{
+			m: measurement.Measurements{DataFormat: 5},
+			expected: []byte{
+				0x05, 0x80, 0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0x80,
+				0x00, 0x80, 0x00, 0x80, 0x00, 0xFF, 0xFF, 0xFF,
+				0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+			},
+		},
+	} {
+		b, err := Encode(tc.m)
+		if err != nil {
+			t.Fatal("Encode() returned error:", err)
+		}
+		if !cmp.Equal(b, tc.expected) {
+			t.Fatalf("Wrong bytes encoded: %x", b)
+		}
+	}
+}
+
+func TestEncodeOutOfRange(t *testing.T) {
+	power := measurement.BatteryVoltage | measurement.TransmissionPower
+	for _, m := range []measurement.Measurements{
+		{Valid: measurement.Temperature, Temperature: 164.0},
+		{Valid: measurement.Humidity, Humidity: -1.0},
+		{Valid: measurement.Pressure, Pressure: 115535},
+		{Valid: measurement.AccelerationZ, AccelerationZ: -33.0},
+		{Valid: power, BatteryVoltage: 1.5, TransmissionPower: 4},
+		{Valid: power, BatteryVoltage: 3.0, TransmissionPower: 22},
+		{Valid: measurement.MovementCounter, MovementCounter: 255},
+		{Valid: measurement.MeasurementSequenceNumber, MeasurementSequenceNumber: 65535},
+	} {
+		if _, err := Encode(m); err == nil {
+			t.Errorf("No error from out of range value: %+v", m)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package rawv2
+
+import (
+	"encoding/binary"
+
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/measurement"
+)
+
+// Length is the length of RAWv2 data, starting with the format byte
+const Length = 24
+
+// Decode decodes RAWv2 data (starting with the format byte) into m, without allocating.
+// Fields reported as invalid by the tag are left out of m.Valid.
+// m does not refer to d after Decode returns.
+func Decode(d []byte, m *measurement.Measurements) error {
+	if err := check(d); err != nil {
+		return err
+	}
+	*m = measurement.Measurements{DataFormat: 5}
+	decode(d, m)
+	return nil
+}
+
+// decode decodes the fields of valid RAWv2 data into m
+func decode(d []byte, m *measurement.Measurements) {
+	m.DataFormat = 5
+	var ok bool
+	if m.Temperature, ok = temperature(d); ok {
+		m.Set(measurement.Temperature)
+	}
+	if m.Humidity, ok = humidity(d); ok {
+		m.Set(measurement.Humidity)
+	}
+	if m.Pressure, ok = pressure(d); ok {
+		m.Set(measurement.Pressure)
+	}
+	if m.AccelerationX, ok = acceleration(d, 7); ok {
+		m.Set(measurement.AccelerationX)
+	}
+	if m.AccelerationY, ok = acceleration(d, 9); ok {
+		m.Set(measurement.AccelerationY)
+	}
+	if m.AccelerationZ, ok = acceleration(d, 11); ok {
+		m.Set(measurement.AccelerationZ)
+	}
+	if m.BatteryVoltage, ok = batteryVoltage(d); ok {
+		m.Set(measurement.BatteryVoltage)
+	}
+	if m.TransmissionPower, ok = transmissionPower(d); ok {
+		m.Set(measurement.TransmissionPower)
+	}
+	if m.MovementCounter, ok = movementCounter(d); ok {
+		m.Set(measurement.MovementCounter)
+	}
+	if m.MeasurementSequenceNumber, ok = measurementSequenceNumber(d); ok {
+		m.Set(measurement.MeasurementSequenceNumber)
+	}
+	if m.MACAddress, ok = macAddress(d); ok {
+		m.Set(measurement.MACAddress)
+	}
+}
+
+// The field decoders below return false if the tag reported the field as invalid
+
+func temperature(d []byte) (float64, bool) {
+	u := binary.BigEndian.Uint16(d[1:3])
+	if u == 0x8000 {
+		return 0, false
+	}
+	return float64(int16(u)) * 0.005, true
+}
+
+func humidity(d []byte) (float64, bool) {
+	v := binary.BigEndian.Uint16(d[3:5])
+	if v == 0xFFFF {
+		return 0, false
+	}
+	return float64(v) * 0.0025, true
+}
+
+func pressure(d []byte) (int, bool) {
+	v := binary.BigEndian.Uint16(d[5:7])
+	if v == 0xFFFF {
+		return 0, false
+	}
+	return int(v) + 50000, true
+}
+
+// acceleration decodes the axis starting at pos
+func acceleration(d []byte, pos int) (float64, bool) {
+	u := binary.BigEndian.Uint16(d[pos : pos+2])
+	if u == 0x8000 {
+		return 0, false
+	}
+	return float64(int16(u)) / 1000.0, true
+}
+
+func batteryVoltage(d []byte) (float64, bool) {
+	v := binary.BigEndian.Uint16(d[13:15])
+	if v == 0xFFFF {
+		return 0, false
+	}
+	v = (v & 0b1111111111100000) >> 5
+	return (float64(v) / 1000) + 1.6, true
+}
+
+func transmissionPower(d []byte) (float64, bool) {
+	v := binary.BigEndian.Uint16(d[13:15])
+	if v == 0xFFFF {
+		return 0, false
+	}
+	v = v & 0b0000000000011111
+	return (float64(v) * 2) - 40.0, true
+}
+
+func movementCounter(d []byte) (int, bool) {
+	if d[15] == 0xFF {
+		return 0, false
+	}
+	return int(d[15]), true
+}
+
+func measurementSequenceNumber(d []byte) (int, bool) {
+	v := binary.BigEndian.Uint16(d[16:18])
+	if v == 0xFFFF {
+		return 0, false
+	}
+	return int(v), true
+}
+
+func macAddress(d []byte) (measurement.MAC, bool) {
+	var mac measurement.MAC
+	copy(mac[:], d[18:24])
+	if mac == (measurement.MAC{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}) {
+		return measurement.MAC{}, false
+	}
+	return mac, true
+}
@@ -0,0 +1,112 @@
+package rawv2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/measurement"
+)
+
+// Encode returns RAWv2 data (starting with the format byte) containing the given measurements.
+// Fields not marked valid are encoded as invalid. Values outside the range of the format cause an error.
+func Encode(m measurement.Measurements) ([]byte, error) {
+	b := make([]byte, 24)
+	b[0] = 5
+
+	u16 := func(pos int, v uint16) { binary.BigEndian.PutUint16(b[pos:pos+2], v) }
+
+	u16(1, 0x8000)
+	if m.Valid.Has(measurement.Temperature) {
+		v, err := scaled(m.Temperature, 0.005, -32767, 32767, "temperature")
+		if err != nil {
+			return nil, err
+		}
+		u16(1, uint16(int16(v)))
+	}
+
+	u16(3, 0xFFFF)
+	if m.Valid.Has(measurement.Humidity) {
+		v, err := scaled(m.Humidity, 0.0025, 0, 65534, "humidity")
+		if err != nil {
+			return nil, err
+		}
+		u16(3, uint16(v))
+	}
+
+	u16(5, 0xFFFF)
+	if m.Valid.Has(measurement.Pressure) {
+		v, err := scaled(float64(m.Pressure-50000), 1, 0, 65534, "pressure")
+		if err != nil {
+			return nil, err
+		}
+		u16(5, uint16(v))
+	}
+
+	for i, axis := range []struct {
+		field measurement.Field
+		value float64
+		name  string
+	}{
+		{measurement.AccelerationX, m.AccelerationX, "acceleration-x"},
+		{measurement.AccelerationY, m.AccelerationY, "acceleration-y"},
+		{measurement.AccelerationZ, m.AccelerationZ, "acceleration-z"},
+	} {
+		pos := 7 + i*2
+		u16(pos, 0x8000)
+		if m.Valid.Has(axis.field) {
+			v, err := scaled(axis.value, 0.001, -32767, 32767, axis.name)
+			if err != nil {
+				return nil, err
+			}
+			u16(pos, uint16(int16(v)))
+		}
+	}
+
+	// battery voltage and tx power share two bytes, all ones in either means both are invalid
+	power := uint16(0xFFFF)
+	if m.Valid.Has(measurement.BatteryVoltage) && m.Valid.Has(measurement.TransmissionPower) {
+		voltage, err := scaled(m.BatteryVoltage-1.6, 0.001, 0, 2046, "battery voltage")
+		if err != nil {
+			return nil, err
+		}
+		tx, err := scaled(m.TransmissionPower+40, 2, 0, 30, "tx power")
+		if err != nil {
+			return nil, err
+		}
+		power = uint16(voltage)<<5 | uint16(tx)
+	}
+	u16(13, power)
+
+	b[15] = 0xFF
+	if m.Valid.Has(measurement.MovementCounter) {
+		if m.MovementCounter < 0 || m.MovementCounter > 254 {
+			return nil, fmt.Errorf("Movement counter %d out of range", m.MovementCounter)
+		}
+		b[15] = byte(m.MovementCounter)
+	}
+
+	u16(16, 0xFFFF)
+	if m.Valid.Has(measurement.MeasurementSequenceNumber) {
+		if m.MeasurementSequenceNumber < 0 || m.MeasurementSequenceNumber > 65534 {
+			return nil, fmt.Errorf("Measurement sequence number %d out of range", m.MeasurementSequenceNumber)
+		}
+		u16(16, uint16(m.MeasurementSequenceNumber))
+	}
+
+	copy(b[18:24], []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+	if m.Valid.Has(measurement.MACAddress) {
+		copy(b[18:24], m.MACAddress[:])
+	}
+
+	return b, nil
+}
+
+// scaled divides v by resolution, rounds to nearest integer and checks it is within [min, max]
+func scaled(v float64, resolution float64, min, max int, what string) (int, error) {
+	s := math.Round(v / resolution)
+	if math.IsNaN(s) || s < float64(min) || s > float64(max) {
+		return 0, fmt.Errorf("Value %v for %s is out of range", v, what)
+	}
+	return int(s), nil
+}
@@ -0,0 +1,89 @@
+//go:build go1.18
+// +build go1.18
+
+package rawv2
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/measurement"
+)
+
+// fuzzSeeds contains the test vectors of the other tests, and inputs which used to panic
+var fuzzSeeds = []string{
+	"0512FC5394C37C0004FFFC040CAC364200CDCBB8334C884F",
+	"057FFFFFFEFFFE7FFF7FFF7FFFFFDEFEFFFECBB8334C884F",
+	"058001000000008001800180010000000000CBB8334C884F",
+	"058000FFFFFFFF800080008000FFFFFFFFFFFFFFFFFFFFFF",
+	"",
+	"05",
+	"0512FC5394C37C0004FFFC040CAC364200CDCBB8334C88",
+	"0312FC5394C37C0004FFFC040CAC364200CDCBB8334C884F",
+}
+
+// FuzzNewDataRAWv2 checks that no input makes the constructor or any getter panic,
+// and that Decode and MarshalJSON agree with the getters
+func FuzzNewDataRAWv2(f *testing.F) {
+	for _, s := range fuzzSeeds {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var m measurement.Measurements
+		decodeErr := Decode(b, &m)
+
+		d, err := NewDataRAWv2(b)
+		if (err == nil) != (decodeErr == nil) {
+			t.Fatalf("NewDataRAWv2() returned %v but Decode() returned %v", err, decodeErr)
+		}
+		if err != nil {
+			return
+		}
+
+		check := func(name string, field measurement.Field, err error) {
+			if (err == nil) != m.Valid.Has(field) {
+				t.Errorf("%s returned error %v but Decode() marked it valid: %v", name, err, m.Valid.Has(field))
+			}
+		}
+		_, err = d.Temperature()
+		check("Temperature()", measurement.Temperature, err)
+		_, err = d.Humidity()
+		check("Humidity()", measurement.Humidity, err)
+		_, err = d.Pressure()
+		check("Pressure()", measurement.Pressure, err)
+		_, err = d.AccelerationX()
+		check("AccelerationX()", measurement.AccelerationX, err)
+		_, err = d.AccelerationY()
+		check("AccelerationY()", measurement.AccelerationY, err)
+		_, err = d.AccelerationZ()
+		check("AccelerationZ()", measurement.AccelerationZ, err)
+		_, err = d.BatteryVoltage()
+		check("BatteryVoltage()", measurement.BatteryVoltage, err)
+		_, err = d.TransmissionPower()
+		check("TransmissionPower()", measurement.TransmissionPower, err)
+		_, err = d.MovementCounter()
+		check("MovementCounter()", measurement.MovementCounter, err)
+		_, err = d.MeasurementSequenceNumber()
+		check("MeasurementSequenceNumber()", measurement.MeasurementSequenceNumber, err)
+		_, err = d.MACAddress()
+		check("MACAddress()", measurement.MACAddress, err)
+
+		j, err := d.MarshalJSON()
+		if err != nil {
+			t.Fatal("MarshalJSON() returned error:", err)
+		}
+		if !json.Valid(j) {
+			t.Fatalf("MarshalJSON() returned invalid JSON: %s", j)
+		}
+		d.Copy()
+		if len(d.RawData()) != len(b) {
+			t.Fatal("Copy() changed length of raw data")
+		}
+	})
+}
@@ -0,0 +1,174 @@
+// Package lineprotocol writes ruuvi readings in InfluxDB line protocol.
+//
+// Each reading is written as one line, e.g.
+//
+//	ruuvi,mac=CB:B8:33:4C:88:4F,data_format=5 temperature=24.3,humidity=53.49,pressure=100044i,rssi=-53i 1617183091500000000
+//
+// Fields which are unsupported by the data format or reported invalid are left out.
+// Readings with a known receiver get a receiver tag.
+// Readings with tag metadata get name and location tags, and a tag per label.
+package lineprotocol
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// DefaultMeasurement is the measurement name used unless configured otherwise
+const DefaultMeasurement = "ruuvi"
+
+// Writer writes readings as line protocol
+type Writer struct {
+	w           *bufio.Writer
+	measurement string
+}
+
+// NewWriter returns a Writer writing to w, using DefaultMeasurement as measurement name
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w), measurement: DefaultMeasurement}
+}
+
+// SetMeasurement changes the measurement name written
+func (w *Writer) SetMeasurement(name string) {
+	w.measurement = name
+}
+
+// Write writes a single reading. Output is buffered, call Flush to make sure it is written.
+// Readings without data are skipped, since a line needs at least one field.
+func (w *Writer) Write(r ruuvi.Reading) error {
+	if r.Data == nil {
+		return nil
+	}
+	_, err := w.w.WriteString(w.line(r))
+	return err
+}
+
+// WriteAll writes all readings received from the channel until it is closed, then flushes
+func (w *Writer) WriteAll(readings <-chan ruuvi.Reading) error {
+	for r := range readings {
+		if err := w.Write(r); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// Flush writes any buffered data to the underlying io.Writer
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+func (w *Writer) line(r ruuvi.Reading) string {
+	var sb strings.Builder
+	d := r.Data
+
+	sb.WriteString(escape(w.measurement, ", "))
+	if r.MAC != "" {
+		sb.WriteString(",mac=")
+		sb.WriteString(escape(r.Address(), ", ="))
+	}
+	sb.WriteString(",data_format=")
+	sb.WriteString(strconv.Itoa(int(d.DataFormat())))
+	if r.Receiver != "" {
+		sb.WriteString(",receiver=")
+		sb.WriteString(escape(r.Receiver, ", ="))
+	}
+	if r.Tag != nil {
+		writeTagInfo(&sb, r.Tag)
+	}
+
+	sep := byte(' ')
+	field := func(key, value string) {
+		sb.WriteByte(sep)
+		sb.WriteString(key)
+		sb.WriteByte('=')
+		sb.WriteString(value)
+		sep = ','
+	}
+	// round away floating point noise from decoding
+	float := func(f float64) string { return strconv.FormatFloat(math.Round(f*1e6)/1e6, 'f', -1, 64) }
+	integer := func(i int) string { return strconv.Itoa(i) + "i" }
+
+	if v, err := d.Temperature(); err == nil {
+		field("temperature", float(v))
+	}
+	if v, err := d.Humidity(); err == nil {
+		field("humidity", float(v))
+	}
+	if v, err := d.Pressure(); err == nil {
+		field("pressure", integer(v))
+	}
+	if v, err := d.AccelerationX(); err == nil {
+		field("acceleration_x", float(v))
+	}
+	if v, err := d.AccelerationY(); err == nil {
+		field("acceleration_y", float(v))
+	}
+	if v, err := d.AccelerationZ(); err == nil {
+		field("acceleration_z", float(v))
+	}
+	if v, err := d.BatteryVoltage(); err == nil {
+		field("battery_voltage", float(v))
+	}
+	if v, err := d.TransmissionPower(); err == nil {
+		field("tx_power", float(v))
+	}
+	if v, err := d.MovementCounter(); err == nil {
+		field("movement_counter", integer(v))
+	}
+	if v, err := d.MeasurementSequenceNumber(); err == nil {
+		field("measurement_sequence_number", integer(v))
+	}
+	field("rssi", integer(r.RSSI))
+
+	if !r.Timestamp.IsZero() {
+		sb.WriteByte(' ')
+		sb.WriteString(strconv.FormatInt(r.Timestamp.UnixNano(), 10))
+	}
+	sb.WriteByte('\n')
+	return sb.String()
+}
+
+// writeTagInfo writes tag metadata as tags, skipping empty values which line protocol does not allow
+func writeTagInfo(sb *strings.Builder, t *ruuvi.TagInfo) {
+	tag := func(key, value string) {
+		if value == "" || key == "" {
+			return
+		}
+		sb.WriteByte(',')
+		sb.WriteString(escape(key, ", ="))
+		sb.WriteByte('=')
+		sb.WriteString(escape(value, ", ="))
+	}
+	tag("name", t.Name)
+	tag("location", t.Location)
+	keys := make([]string, 0, len(t.Labels))
+	for k := range t.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		tag(k, t.Labels[k])
+	}
+}
+
+// escape escapes given special characters with a backslash
+func escape(s string, special string) string {
+	if !strings.ContainsAny(s, special) {
+		return s
+	}
+	var sb strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(special, c) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
@@ -0,0 +1,68 @@
+package lineprotocol
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+func TestWrite(t *testing.T) {
+	rawv2, err := ruuvi.ProcessAdvertisement([]byte{
+		0x99, 0x04,
+		0x05, 0x12, 0xFC, 0x53, 0x94, 0xC3, 0x7C, 0x00,
+		0x04, 0xFF, 0xFC, 0x04, 0x0C, 0xAC, 0x36, 0x42,
+		0x00, 0xCD, 0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F,
+	})
+	if err != nil {
+		t.Fatal("Error: ", err)
+	}
+	rawv1, err := ruuvi.ProcessAdvertisement([]byte{
+		0x99, 0x04,
+		0x03, 0x29, 0x1A, 0x1E, 0xCE, 0x1E, 0xFC,
+		0x18, 0xF9, 0x42, 0x02, 0xCA, 0x0B, 0x53,
+	})
+	if err != nil {
+		t.Fatal("Error: ", err)
+	}
+	ts := time.Unix(1617183091, 500000000)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	ch := make(chan ruuvi.Reading, 3)
+	ch <- ruuvi.Reading{Timestamp: ts, MAC: "CB:B8:33:4C:88:4F", RSSI: -53, Data: rawv2}
+	ch <- ruuvi.Reading{MAC: "D1:2A:3B:4C:5D:6E", RSSI: -70, Receiver: "gw 1", Data: rawv1, Tag: &ruuvi.TagInfo{
+		Name:   "Sauna",
+		Labels: map[string]string{"zone": "b", "floor": "-1", "empty": ""},
+	}}
+	ch <- ruuvi.Reading{MAC: "no data"}
+	close(ch)
+	if err := w.WriteAll(ch); err != nil {
+		t.Fatal("WriteAll() returned error:", err)
+	}
+
+	expected := "ruuvi,mac=CB:B8:33:4C:88:4F,data_format=5 temperature=24.3,humidity=53.49,pressure=100044i," +
+		"acceleration_x=0.004,acceleration_y=-0.004,acceleration_z=1.036,battery_voltage=2.977,tx_power=4," +
+		"movement_counter=66i,measurement_sequence_number=205i,rssi=-53i 1617183091500000000\n" +
+		"ruuvi,mac=D1:2A:3B:4C:5D:6E,data_format=3,receiver=gw\\ 1,name=Sauna,floor=-1,zone=b temperature=26.3,humidity=20.5,pressure=102766i," +
+		"acceleration_x=-1,acceleration_y=-1.726,acceleration_z=0.714,battery_voltage=2.899,rssi=-70i\n"
+	if diff := cmp.Diff(expected, buf.String()); diff != "" {
+		t.Fatal("Unexpected output (-want +got):\n", diff)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	for in, expected := range map[string]string{
+		"plain":        "plain",
+		"with space":   `with\ space`,
+		"a,b=c":        `a\,b\=c`,
+		"freezer 2=ok": `freezer\ 2\=ok`,
+	} {
+		if got := escape(in, ", ="); got != expected {
+			t.Errorf("escape(%q) = %q, expected %q", in, got, expected)
+		}
+	}
+}
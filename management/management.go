@@ -0,0 +1,199 @@
+// Package management sets the clock and sensor configuration of RuuviTags with firmware 3.x over the Nordic UART Service.
+//
+// Setting the clock matters for history download: the tag timestamps logged values with its own clock,
+// which starts from zero when the battery is inserted. Sensor configuration changes e.g. the scale and
+// sample rate of the accelerometer, or how often environmental values are sampled.
+//
+// Messages are encoded and decoded with package endpoints. Messages which do not answer the current request,
+// e.g. late answers to an earlier one, are skipped.
+package management
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/LassiHeikkila/go-ruuvi/endpoints"
+	"github.com/LassiHeikkila/go-ruuvi/nus"
+)
+
+// DefaultTimeout is how long Client waits for an answer by default
+const DefaultTimeout = 5 * time.Second
+
+var (
+	// ErrTimeout is returned when the tag does not answer in time
+	ErrTimeout = errors.New("Timed out waiting for answer from tag")
+
+	// ErrInvalid is the reason of a RejectedValue which is not valid for the sensor
+	ErrInvalid = errors.New("invalid value")
+	// ErrNotImplemented is the reason of a RejectedValue the firmware does not implement
+	ErrNotImplemented = errors.New("not implemented by firmware")
+	// ErrNotSupported is the reason of a RejectedValue the sensor does not support
+	ErrNotSupported = errors.New("not supported by sensor")
+)
+
+// RejectedValue is a value of a sensor configuration which the tag did not accept
+type RejectedValue struct {
+	// Field is the name of the configuration field, e.g. "scale"
+	Field string
+	// Requested is the value which was written
+	Requested byte
+	// Reason is ErrInvalid, ErrNotImplemented or ErrNotSupported
+	Reason error
+}
+
+// ConfigError is returned when the tag rejects values of a sensor configuration.
+// errors.Is reports whether any value was rejected for a given reason, e.g. ErrNotSupported.
+type ConfigError struct {
+	Endpoint endpoints.Endpoint
+	// Requested is the configuration which was written
+	Requested endpoints.SensorConfig
+	// Applied is the configuration the tag answered with, the rejected values hold the reason
+	Applied  endpoints.SensorConfig
+	Rejected []RejectedValue
+}
+
+func (e *ConfigError) Error() string {
+	s := make([]string, len(e.Rejected))
+	for i, r := range e.Rejected {
+		s[i] = fmt.Sprintf("%s %d %v", r.Field, r.Requested, r.Reason)
+	}
+	return fmt.Sprintf("Configuration of %v rejected: %s", e.Endpoint, strings.Join(s, ", "))
+}
+
+// Is reports whether target is the reason any value was rejected
+func (e *ConfigError) Is(target error) bool {
+	for _, r := range e.Rejected {
+		if r.Reason == target {
+			return true
+		}
+	}
+	return false
+}
+
+// Client manages a tag over a Nordic UART Service connection
+type Client struct {
+	t nus.Transport
+
+	// Timeout is how long to wait for an answer to a request, DefaultTimeout by default
+	Timeout time.Duration
+}
+
+// NewClient returns a Client using connection t
+func NewClient(t nus.Transport) *Client {
+	return &Client{t: t, Timeout: DefaultTimeout}
+}
+
+// SetClock sets the clock of the tag to t, with millisecond resolution.
+// The tag does not answer; use Clock to check the result.
+func (c *Client) SetClock(ctx context.Context, t time.Time) error {
+	return c.send(ctx, endpoints.NewClockWrite(t))
+}
+
+// Clock returns the time of the clock of the tag
+func (c *Client) Clock(ctx context.Context) (time.Time, error) {
+	m, err := c.exchange(ctx, endpoints.NewClockRead(), endpoints.OpValueWrite)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return m.Clock()
+}
+
+// SensorConfig returns the configuration of the sensor of endpoint e
+func (c *Client) SensorConfig(ctx context.Context, e endpoints.Endpoint) (endpoints.SensorConfig, error) {
+	m, err := c.exchange(ctx, endpoints.NewSensorConfigRead(e), endpoints.OpSensorConfigWrite)
+	if err != nil {
+		return endpoints.SensorConfig{}, err
+	}
+	return m.SensorConfig()
+}
+
+// SetSensorConfig configures the sensor of endpoint e and returns the configuration the tag applied.
+// Fields set to endpoints.ConfigNoChange keep their value, see endpoints.NoChange.
+// If the tag rejects any value, the applied configuration is returned with a *ConfigError.
+func (c *Client) SetSensorConfig(ctx context.Context, e endpoints.Endpoint, cfg endpoints.SensorConfig) (endpoints.SensorConfig, error) {
+	m, err := c.exchange(ctx, endpoints.NewSensorConfigWrite(e, cfg), endpoints.OpSensorConfigWrite)
+	if err != nil {
+		return endpoints.SensorConfig{}, err
+	}
+	applied, err := m.SensorConfig()
+	if err != nil {
+		return endpoints.SensorConfig{}, err
+	}
+
+	var rejected []RejectedValue
+	for _, f := range []struct {
+		name               string
+		requested, applied byte
+	}{
+		{"sample rate", cfg.SampleRate, applied.SampleRate},
+		{"resolution", cfg.Resolution, applied.Resolution},
+		{"scale", cfg.Scale, applied.Scale},
+		{"DSP function", byte(cfg.DSPFunction), byte(applied.DSPFunction)},
+		{"DSP parameter", cfg.DSPParameter, applied.DSPParameter},
+		{"mode", cfg.Mode, applied.Mode},
+	} {
+		var reason error
+		switch f.applied {
+		case endpoints.ConfigErrInvalid:
+			reason = ErrInvalid
+		case endpoints.ConfigErrNotImplemented:
+			reason = ErrNotImplemented
+		case endpoints.ConfigErrNotSupported:
+			reason = ErrNotSupported
+		default:
+			continue
+		}
+		rejected = append(rejected, RejectedValue{Field: f.name, Requested: f.requested, Reason: reason})
+	}
+	if len(rejected) > 0 {
+		return applied, &ConfigError{Endpoint: e, Requested: cfg, Applied: applied, Rejected: rejected}
+	}
+	return applied, nil
+}
+
+func (c *Client) send(ctx context.Context, req endpoints.Message) error {
+	if err := c.t.Send(ctx, req.AppendBinary(nil)); err != nil {
+		return fmt.Errorf("Failed to send %v: %w", req.Operation, err)
+	}
+	return nil
+}
+
+// exchange sends req and returns the first answer with operation op from the endpoint req was sent to
+func (c *Client) exchange(ctx context.Context, req endpoints.Message, op endpoints.Operation) (endpoints.Message, error) {
+	if err := c.send(ctx, req); err != nil {
+		return endpoints.Message{}, err
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	rctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		b, err := c.t.Receive(rctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return endpoints.Message{}, ctx.Err()
+			}
+			if rctx.Err() != nil {
+				return endpoints.Message{}, ErrTimeout
+			}
+			return endpoints.Message{}, err
+		}
+		msgs, err := endpoints.Split(b)
+		if err != nil {
+			// not a message of the endpoints protocol, e.g. a data notification
+			continue
+		}
+		for _, m := range msgs {
+			if m.Source == req.Destination && m.Operation == op {
+				return m, nil
+			}
+		}
+	}
+}
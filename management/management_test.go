@@ -0,0 +1,199 @@
+package management
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/LassiHeikkila/go-ruuvi/endpoints"
+)
+
+// fakeTag answers clock and sensor configuration requests like RuuviTag firmware does
+type fakeTag struct {
+	clock   time.Time
+	configs map[endpoints.Endpoint]endpoints.SensorConfig
+	silent  bool
+
+	notifications chan []byte
+}
+
+func newFakeTag() *fakeTag {
+	return &fakeTag{
+		configs: map[endpoints.Endpoint]endpoints.SensorConfig{
+			endpoints.EndpointAcceleration: {SampleRate: 10, Resolution: 10, Scale: 2, Mode: endpoints.ModeContinuous},
+		},
+		notifications: make(chan []byte, 16),
+	}
+}
+
+func (f *fakeTag) notify(m endpoints.Message) {
+	f.notifications <- m.AppendBinary(nil)
+}
+
+func (f *fakeTag) Send(ctx context.Context, b []byte) error {
+	var m endpoints.Message
+	if err := m.UnmarshalBinary(b); err != nil {
+		return err
+	}
+	if f.silent {
+		return nil
+	}
+	// stray messages, which the client must skip
+	f.notifications <- []byte{0x05, 0x12, 0xFC}
+	f.notify(endpoints.NewEndOfLog(endpoints.EndpointEnvironmental))
+
+	switch {
+	case m.Destination == endpoints.EndpointRTC && m.Operation == endpoints.OpValueWrite:
+		f.clock, _ = m.Clock()
+	case m.Destination == endpoints.EndpointRTC && m.Operation == endpoints.OpValueRead:
+		f.notify(endpoints.NewClockWrite(f.clock))
+	case m.Operation == endpoints.OpSensorConfigRead:
+		f.notify(endpoints.NewSensorConfigWrite(m.Destination, f.configs[m.Destination]))
+	case m.Operation == endpoints.OpSensorConfigWrite:
+		requested, _ := m.SensorConfig()
+		cfg := f.configs[m.Destination]
+		set := func(dst *byte, v byte, valid func(byte) bool) {
+			switch {
+			case v == endpoints.ConfigNoChange:
+			case valid(v):
+				*dst = v
+			default:
+				*dst = endpoints.ConfigErrNotSupported
+			}
+		}
+		any := func(byte) bool { return true }
+		set(&cfg.SampleRate, requested.SampleRate, func(v byte) bool { return v <= 100 })
+		set(&cfg.Resolution, requested.Resolution, func(v byte) bool { return v == 8 || v == 10 || v == 12 })
+		set(&cfg.Scale, requested.Scale, func(v byte) bool { return v == 2 || v == 4 || v == 8 || v == 16 })
+		dsp := byte(cfg.DSPFunction)
+		set(&dsp, byte(requested.DSPFunction), any)
+		if dsp == byte(endpoints.DSPHighPass) {
+			dsp = endpoints.ConfigErrNotImplemented
+		}
+		cfg.DSPFunction = endpoints.DSPFunction(dsp)
+		set(&cfg.DSPParameter, requested.DSPParameter, any)
+		set(&cfg.Mode, requested.Mode, any)
+		f.notify(endpoints.NewSensorConfigWrite(m.Destination, cfg))
+		// keep the rejected values out of the stored configuration
+		if cfg.Scale != endpoints.ConfigErrNotSupported && cfg.Resolution != endpoints.ConfigErrNotSupported {
+			f.configs[m.Destination] = cfg
+		}
+	}
+	return nil
+}
+
+func (f *fakeTag) Receive(ctx context.Context) ([]byte, error) {
+	select {
+	case b := <-f.notifications:
+		return b, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestClock(t *testing.T) {
+	tag := newFakeTag()
+	c := NewClient(tag)
+	ctx := context.Background()
+
+	now := time.Date(2021, 6, 1, 12, 0, 0, 123456789, time.UTC)
+	if err := c.SetClock(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	clock, err := c.Clock(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := now.Truncate(time.Millisecond); !clock.Equal(expected) {
+		t.Errorf("expected clock %v, got %v", expected, clock)
+	}
+}
+
+func TestSensorConfig(t *testing.T) {
+	tag := newFakeTag()
+	c := NewClient(tag)
+	ctx := context.Background()
+	e := endpoints.EndpointAcceleration
+
+	cfg, err := c.SensorConfig(ctx, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(tag.configs[e], cfg); diff != "" {
+		t.Error(diff)
+	}
+
+	requested := endpoints.NoChange()
+	requested.Scale = 8
+	requested.SampleRate = 25
+	applied, err := c.SetSensorConfig(ctx, e, requested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := endpoints.SensorConfig{SampleRate: 25, Resolution: 10, Scale: 8, Mode: endpoints.ModeContinuous}
+	if diff := cmp.Diff(expected, applied); diff != "" {
+		t.Error(diff)
+	}
+	if cfg, err := c.SensorConfig(ctx, e); err != nil || cfg != expected {
+		t.Errorf("expected configuration %v to be stored, got %v, %v", expected, cfg, err)
+	}
+}
+
+func TestSensorConfigRejected(t *testing.T) {
+	tag := newFakeTag()
+	c := NewClient(tag)
+	e := endpoints.EndpointAcceleration
+
+	requested := endpoints.NoChange()
+	requested.Scale = 32
+	requested.DSPFunction = endpoints.DSPHighPass
+	requested.SampleRate = 50
+	applied, err := c.SetSensorConfig(context.Background(), e, requested)
+
+	var cfgErr *ConfigError
+	if !errors.As(err, &cfgErr) {
+		t.Fatalf("expected *ConfigError, got %v", err)
+	}
+	expected := []RejectedValue{
+		{Field: "scale", Requested: 32, Reason: ErrNotSupported},
+		{Field: "DSP function", Requested: byte(endpoints.DSPHighPass), Reason: ErrNotImplemented},
+	}
+	if diff := cmp.Diff(expected, cfgErr.Rejected, cmp.Comparer(func(a, b error) bool { return a == b })); diff != "" {
+		t.Error(diff)
+	}
+	if cfgErr.Endpoint != e || cfgErr.Requested != requested || cfgErr.Applied != applied {
+		t.Errorf("unexpected error fields %+v", cfgErr)
+	}
+	if applied.SampleRate != 50 {
+		t.Errorf("expected accepted sample rate to be applied, got %v", applied)
+	}
+	if !errors.Is(err, ErrNotSupported) || !errors.Is(err, ErrNotImplemented) || errors.Is(err, ErrInvalid) {
+		t.Errorf("errors.Is does not match the reasons of %v", err)
+	}
+	if expected := "Configuration of acceleration rejected: scale 32 not supported by sensor, DSP function 4 not implemented by firmware"; err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err.Error())
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	tag := newFakeTag()
+	tag.silent = true
+	c := NewClient(tag)
+	c.Timeout = 10 * time.Millisecond
+
+	if _, err := c.Clock(context.Background()); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+	if _, err := c.SensorConfig(context.Background(), endpoints.EndpointEnvironmental); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Clock(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+// Package nus describes the Nordic UART Service, through which RuuviTag firmware 3.x
+// serves its logged history and configuration when connected.
+//
+// Clients write requests to the RX characteristic and receive responses as notifications
+// of the TX characteristic.
+//
+// While connected, the tag also sends its measurements as notifications, which Source turns into readings.
+package nus
+
+import "context"
+
+// UUIDs of the Nordic UART Service and its characteristics
+const (
+	ServiceUUID = "6e400001-b5a3-f393-e0a9-e50e24dcca9e"
+	// RXUUID is the characteristic clients write to
+	RXUUID = "6e400002-b5a3-f393-e0a9-e50e24dcca9e"
+	// TXUUID is the characteristic the tag sends notifications from
+	TXUUID = "6e400003-b5a3-f393-e0a9-e50e24dcca9e"
+)
+
+// Transport sends requests to the Nordic UART Service of a tag and receives its responses, with notifications of TX enabled
+type Transport interface {
+	// Send writes b to the RX characteristic
+	Send(ctx context.Context, b []byte) error
+
+	// Receive returns the next notification of the TX characteristic, waiting until one arrives or ctx is done.
+	// Notifications must be queued between calls, so that none are lost while the caller processes the previous one.
+	// io.EOF is returned when the connection has been closed.
+	Receive(ctx context.Context) ([]byte, error)
+}
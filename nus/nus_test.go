@@ -0,0 +1,103 @@
+package nus
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// fakeTag sends given notifications, and then reports the connection closed or err
+type fakeTag struct {
+	notifications [][]byte
+	err           error
+}
+
+func (f *fakeTag) Send(ctx context.Context, b []byte) error {
+	return nil
+}
+
+func (f *fakeTag) Receive(ctx context.Context) ([]byte, error) {
+	if len(f.notifications) == 0 {
+		if f.err != nil {
+			return nil, f.err
+		}
+		return nil, io.EOF
+	}
+	b := f.notifications[0]
+	f.notifications = f.notifications[1:]
+	return b, nil
+}
+
+var (
+	payload = []byte{
+		0x05, 0x12, 0xFC, 0x53, 0x94, 0xC3, 0x7C, 0x00,
+		0x04, 0xFF, 0xFC, 0x04, 0x0C, 0xAC, 0x36, 0x42,
+		0x00, 0xCD, 0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F,
+	}
+	manufacturerData = append([]byte{0x99, 0x04}, payload...)
+)
+
+func TestSource(t *testing.T) {
+	buf := make([]byte, len(payload))
+	copy(buf, payload)
+	tag := &fakeTag{notifications: [][]byte{
+		buf,
+		// answer to a request of another client
+		{0x3A, 0x3A, 0x10, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+		// tags send payloads only, not manufacturer data
+		manufacturerData,
+		buf,
+	}}
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := NewSource(tag, "C5:1A:2B:3C:4D:5E")
+	s.Receiver = "laptop"
+	s.now = func() time.Time { return now }
+
+	out := make(chan ruuvi.Reading, 10)
+	if err := s.Run(context.Background(), out); err != nil {
+		t.Fatal(err)
+	}
+	close(out)
+	// the transport may reuse its buffer
+	buf[1] = 0
+
+	expected, err := ruuvi.ProcessAdvertisement(manufacturerData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var readings []ruuvi.Reading
+	for r := range out {
+		readings = append(readings, r)
+	}
+	if len(readings) != 2 {
+		t.Fatalf("expected 2 readings, got %d", len(readings))
+	}
+	for _, r := range readings {
+		if r.Timestamp != now || r.MAC != "C5:1A:2B:3C:4D:5E" || r.Receiver != "laptop" || r.RSSI != 0 {
+			t.Errorf("unexpected reading %+v", r)
+		}
+		if diff := cmp.Diff(ruuvi.MeasurementsOf(expected), ruuvi.MeasurementsOf(r.Data)); diff != "" {
+			t.Error(diff)
+		}
+	}
+}
+
+func TestSourceStops(t *testing.T) {
+	failure := errors.New("disconnected")
+	if err := NewSource(&fakeTag{err: failure}, "").Run(context.Background(), nil); !errors.Is(err, failure) {
+		t.Errorf("expected transport error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tag := &fakeTag{notifications: [][]byte{payload}, err: context.Canceled}
+	if err := NewSource(tag, "").Run(ctx, make(chan ruuvi.Reading)); err != nil {
+		t.Errorf("expected nil when ctx is done, got %v", err)
+	}
+}
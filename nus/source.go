@@ -0,0 +1,57 @@
+package nus
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// Source implements ruuvi.Source by decoding the data a connected tag sends as notifications.
+// RuuviTag firmware sends the same data as it broadcasts, but without the company ID, see ruuvi.ProcessPayload.
+// Other notifications, e.g. answers to requests of other clients, are skipped.
+type Source struct {
+	t   Transport
+	mac string
+
+	// Receiver is set as the receiver of the readings, empty by default
+	Receiver string
+
+	// now timestamps the readings
+	now func() time.Time
+}
+
+var _ ruuvi.Source = (*Source)(nil)
+
+// NewSource returns a Source producing readings of the tag with given BLE address from connection t
+func NewSource(t Transport, mac string) *Source {
+	return &Source{t: t, mac: mac, now: time.Now}
+}
+
+// Run implements ruuvi.Source. The readings have no RSSI, as there is no advertisement to measure it from.
+// Run returns nil when the connection is closed, which Transport reports with io.EOF.
+func (s *Source) Run(ctx context.Context, out chan<- ruuvi.Reading) error {
+	for {
+		b, err := s.t.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		data, err := ruuvi.ProcessPayload(b)
+		if err != nil {
+			continue
+		}
+		// the notification buffer may be reused by the transport
+		data.Copy()
+
+		select {
+		case out <- ruuvi.Reading{Timestamp: s.now(), MAC: s.mac, Receiver: s.Receiver, Data: data}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
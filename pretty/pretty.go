@@ -0,0 +1,147 @@
+// Package pretty renders ruuvi data for humans: as a labelled block of fields,
+// or as a table of all tags updating in place in a terminal.
+package pretty
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// labelWidth is wide enough for the longest label
+const labelWidth = 28
+
+// line is a single rendered field
+type line struct {
+	label string
+	value string
+}
+
+// status returns the placeholder shown instead of a value when err is not nil
+func status(err error) string {
+	switch {
+	case errors.Is(err, ruuvi.ErrUnsupportedField):
+		return "(unsupported)"
+	case errors.Is(err, ruuvi.ErrInvalidValue):
+		return "(invalid)"
+	default:
+		return "(error: " + err.Error() + ")"
+	}
+}
+
+func formatName(f int8) string {
+	switch f {
+	case 3:
+		return "3 (RAWv1)"
+	case 5:
+		return "5 (RAWv2)"
+	default:
+		return fmt.Sprint(f)
+	}
+}
+
+func fields(d ruuvi.AdvertisementData) []line {
+	float := func(format string, v float64, err error) string {
+		if err != nil {
+			return status(err)
+		}
+		return fmt.Sprintf(format, v)
+	}
+	integer := func(format string, v int, err error) string {
+		if err != nil {
+			return status(err)
+		}
+		return fmt.Sprintf(format, v)
+	}
+
+	lines := []line{{"Data format", formatName(d.DataFormat())}}
+
+	v, err := d.Temperature()
+	lines = append(lines, line{"Temperature", float("%.3f °C", v, err)})
+	v, err = d.Humidity()
+	lines = append(lines, line{"Humidity", float("%.4f %%", v, err)})
+	i, err := d.Pressure()
+	lines = append(lines, line{"Pressure", integer("%d Pa", i, err)})
+	v, err = d.AccelerationX()
+	lines = append(lines, line{"Acceleration X", float("%.3f G", v, err)})
+	v, err = d.AccelerationY()
+	lines = append(lines, line{"Acceleration Y", float("%.3f G", v, err)})
+	v, err = d.AccelerationZ()
+	lines = append(lines, line{"Acceleration Z", float("%.3f G", v, err)})
+	v, err = d.BatteryVoltage()
+	lines = append(lines, line{"Battery voltage", float("%.3f V", v, err)})
+	v, err = d.TransmissionPower()
+	lines = append(lines, line{"TX power", float("%.0f dBm", v, err)})
+	i, err = d.MovementCounter()
+	lines = append(lines, line{"Movement counter", integer("%d", i, err)})
+	i, err = d.MeasurementSequenceNumber()
+	lines = append(lines, line{"Measurement sequence number", integer("%d", i, err)})
+	if mac, err := d.MACAddress(); err != nil {
+		lines = append(lines, line{"MAC address", status(err)})
+	} else {
+		lines = append(lines, line{"MAC address", mac.String()})
+	}
+
+	return lines
+}
+
+// Write writes every field of d as an aligned, labelled line with unit.
+// Fields the data format does not have are shown as "(unsupported)",
+// and fields the tag reported as invalid as "(invalid)".
+func Write(w io.Writer, d ruuvi.AdvertisementData) error {
+	for _, l := range fields(d) {
+		if _, err := fmt.Fprintf(w, "%-*s %s\n", labelWidth, l.label, l.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Format returns d rendered as by Write
+func Format(d ruuvi.AdvertisementData) string {
+	var sb strings.Builder
+	_ = Write(&sb, d)
+	return sb.String()
+}
+
+// WriteReading writes a header line with the reception details of r, followed by its fields indented.
+// If r has tag metadata, the name and location of the tag are shown in the header.
+func WriteReading(w io.Writer, r ruuvi.Reading) error {
+	if _, err := fmt.Fprintf(w, "%s  %s%s  RSSI %d dBm%s\n", r.Timestamp.Format("2006-01-02 15:04:05.000"), r.Address(), tagName(r.Tag), r.RSSI, receivedBy(r.Receiver)); err != nil {
+		return err
+	}
+	if r.Data == nil {
+		return nil
+	}
+	for _, l := range fields(r.Data) {
+		if _, err := fmt.Fprintf(w, "  %-*s %s\n", labelWidth, l.label, l.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// receivedBy returns the receiver prefixed with "via", or nothing if not known
+func receivedBy(receiver string) string {
+	if receiver == "" {
+		return ""
+	}
+	return "  via " + receiver
+}
+
+// tagName returns the name and location of t in parentheses, or nothing if t has neither
+func tagName(t *ruuvi.TagInfo) string {
+	switch {
+	case t == nil || (t.Name == "" && t.Location == ""):
+		return ""
+	case t.Location == "":
+		return " (" + t.Name + ")"
+	case t.Name == "":
+		return " (" + t.Location + ")"
+	default:
+		return " (" + t.Name + ", " + t.Location + ")"
+	}
+}
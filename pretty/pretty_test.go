@@ -0,0 +1,102 @@
+package pretty
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/fixture"
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+var update = flag.Bool("update", false, "Update golden files")
+
+var now = time.Date(2021, 3, 31, 9, 31, 31, 0, time.UTC)
+
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatal("Failed to update golden file:", err)
+		}
+	}
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal("Failed to read golden file:", err)
+	}
+	if diff := cmp.Diff(string(expected), string(got)); diff != "" {
+		t.Errorf("Output differs from %s (-want +got):\n%s", path, diff)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	for name, b := range map[string][]byte{
+		"rawv2":         fixture.RAWv2,
+		"rawv2_invalid": fixture.RAWv2Invalid,
+		"rawv1":         fixture.RAWv1,
+	} {
+		t.Run(name, func(t *testing.T) {
+			golden(t, name, []byte(Format(fixture.Process(t, b))))
+		})
+	}
+}
+
+func TestWriteReading(t *testing.T) {
+	var buf bytes.Buffer
+	r := ruuvi.Reading{
+		Timestamp: now, MAC: "D1:2A:3B:4C:5D:6E", RSSI: -70, Data: fixture.Process(t, fixture.RAWv1),
+		Tag: &ruuvi.TagInfo{Name: "Sauna", Location: "Basement"},
+	}
+	if err := WriteReading(&buf, r); err != nil {
+		t.Fatal("WriteReading() returned error:", err)
+	}
+	golden(t, "reading", buf.Bytes())
+}
+
+func testTable(t *testing.T) *Table {
+	table := NewTable()
+	table.Update(ruuvi.Reading{Timestamp: now.Add(-2 * time.Second), MAC: "D1:2A:3B:4C:5D:6E", RSSI: -70, Data: fixture.Process(t, fixture.RAWv1)})
+	table.Update(ruuvi.Reading{Timestamp: now.Add(-5 * time.Second), MAC: "CB:B8:33:4C:88:4F", RSSI: -60, Data: fixture.Process(t, fixture.RAWv2)})
+	// newer reading replaces older one of the same tag
+	table.Update(ruuvi.Reading{
+		Timestamp: now.Add(-1500 * time.Millisecond), MAC: "CB:B8:33:4C:88:4F", RSSI: -53, Data: fixture.Process(t, fixture.RAWv2),
+		Tag: &ruuvi.TagInfo{Name: "Freezer 2"},
+	})
+	table.Update(ruuvi.Reading{Timestamp: now, MAC: "EE:00:00:00:00:01", RSSI: -90, Data: fixture.Process(t, fixture.RAWv2Invalid)})
+	table.Update(ruuvi.Reading{Timestamp: now, MAC: "EE:00:00:00:00:02"}) // no data, ignored
+	return table
+}
+
+func TestTableRender(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testTable(t).Render(&buf, now); err != nil {
+		t.Fatal("Render() returned error:", err)
+	}
+	golden(t, "table", buf.Bytes())
+}
+
+func TestTableLive(t *testing.T) {
+	table := testTable(t)
+	ch := make(chan ruuvi.Reading)
+	close(ch)
+
+	var buf bytes.Buffer
+	if err := table.Live(context.Background(), ch, &buf, time.Hour); err != nil {
+		t.Fatal("Live() returned error:", err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, cursorHome) || !strings.HasSuffix(out, clearLineAfter+"\n"+clearScreen) {
+		t.Fatalf("Live output does not redraw in place: %q", out)
+	}
+	if strings.Count(out, "\n") != 4 {
+		t.Fatalf("Expected header and 3 rows: %q", out)
+	}
+}
@@ -0,0 +1,170 @@
+package pretty
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// ANSI escape sequences to move the cursor home, clear the rest of the screen and the rest of a line
+const (
+	cursorHome     = "\x1b[H"
+	clearScreen    = "\x1b[J"
+	clearLineAfter = "\x1b[K"
+)
+
+type column struct {
+	title string
+	width int
+	value func(r ruuvi.Reading, now time.Time) string
+
+	// left aligns the column to the left, numeric columns are aligned to the right
+	left bool
+}
+
+// placeholder is shown in table cells which have no value
+const placeholder = "-"
+
+func tableFloat(format string) func(v float64, err error) string {
+	return func(v float64, err error) string {
+		if err != nil {
+			return placeholder
+		}
+		return fmt.Sprintf(format, v)
+	}
+}
+
+var columns = []column{
+	{"MAC", 17, func(r ruuvi.Reading, _ time.Time) string { return r.Address() }, true},
+	{"NAME", 16, func(r ruuvi.Reading, _ time.Time) string {
+		if r.Tag == nil || r.Tag.Name == "" {
+			return placeholder
+		}
+		return r.Tag.Name
+	}, true},
+	{"FMT", 3, func(r ruuvi.Reading, _ time.Time) string { return fmt.Sprint(r.Data.DataFormat()) }, false},
+	{"TEMP °C", 8, func(r ruuvi.Reading, _ time.Time) string { return tableFloat("%.2f")(r.Data.Temperature()) }, false},
+	{"HUM %", 6, func(r ruuvi.Reading, _ time.Time) string { return tableFloat("%.2f")(r.Data.Humidity()) }, false},
+	{"PRES hPa", 8, func(r ruuvi.Reading, _ time.Time) string {
+		p, err := r.Data.Pressure()
+		return tableFloat("%.2f")(float64(p)/100, err)
+	}, false},
+	{"BATT V", 6, func(r ruuvi.Reading, _ time.Time) string { return tableFloat("%.3f")(r.Data.BatteryVoltage()) }, false},
+	{"MOVES", 5, func(r ruuvi.Reading, _ time.Time) string {
+		c, err := r.Data.MovementCounter()
+		if err != nil {
+			return placeholder
+		}
+		return fmt.Sprint(c)
+	}, false},
+	{"SEQ", 5, func(r ruuvi.Reading, _ time.Time) string {
+		s, err := r.Data.MeasurementSequenceNumber()
+		if err != nil {
+			return placeholder
+		}
+		return fmt.Sprint(s)
+	}, false},
+	{"RSSI", 4, func(r ruuvi.Reading, _ time.Time) string { return fmt.Sprint(r.RSSI) }, false},
+	{"AGE", 6, func(r ruuvi.Reading, now time.Time) string {
+		return now.Sub(r.Timestamp).Truncate(100 * time.Millisecond).String()
+	}, false},
+}
+
+// Table keeps the latest reading of each tag and renders them as a table, one row per tag sorted by MAC.
+// Table is safe for concurrent use.
+type Table struct {
+	mu     sync.Mutex
+	latest map[string]ruuvi.Reading
+}
+
+// NewTable returns an empty Table
+func NewTable() *Table {
+	return &Table{latest: make(map[string]ruuvi.Reading)}
+}
+
+// Update stores r as the latest reading of its tag. Readings without data are ignored.
+func (t *Table) Update(r ruuvi.Reading) {
+	if r.Data == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.latest[r.Address()] = r
+}
+
+// Render writes the table, with ages of readings relative to now
+func (t *Table) Render(w io.Writer, now time.Time) error {
+	t.mu.Lock()
+	rows := make([]ruuvi.Reading, 0, len(t.latest))
+	for _, r := range t.latest {
+		rows = append(rows, r)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Address() < rows[j].Address() })
+
+	var sb strings.Builder
+	for i, c := range columns {
+		writeCell(&sb, i, c.title, c.width, c.left)
+	}
+	sb.WriteString("\n")
+	for _, r := range rows {
+		for i, c := range columns {
+			writeCell(&sb, i, c.value(r, now), c.width, c.left)
+		}
+		sb.WriteString("\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeCell writes the i'th cell of a row, separated from the previous cell by two spaces
+func writeCell(sb *strings.Builder, i int, s string, width int, left bool) {
+	if i > 0 {
+		sb.WriteString("  ")
+	}
+	if left {
+		fmt.Fprintf(sb, "%-*s", width, s)
+		return
+	}
+	fmt.Fprintf(sb, "%*s", width, s)
+}
+
+// Live renders the table to a terminal every interval, updating it in place,
+// with readings received from the channel. It returns when ctx is done or the channel is closed.
+func (t *Table) Live(ctx context.Context, readings <-chan ruuvi.Reading, w io.Writer, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	redraw := func() error {
+		var sb strings.Builder
+		if err := t.Render(&sb, time.Now()); err != nil {
+			return err
+		}
+		out := cursorHome + strings.ReplaceAll(sb.String(), "\n", clearLineAfter+"\n") + clearScreen
+		_, err := io.WriteString(w, out)
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case r, ok := <-readings:
+			if !ok {
+				return redraw()
+			}
+			t.Update(r)
+		case <-ticker.C:
+			if err := redraw(); err != nil {
+				return err
+			}
+		}
+	}
+}
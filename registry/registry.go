@@ -0,0 +1,218 @@
+// Package registry maps tag MAC addresses to friendly names, locations and labels.
+//
+// A registry is loaded from a JSON config file:
+//
+//	{
+//		"tags": [
+//			{
+//				"mac": "CB:B8:33:4C:88:4F",
+//				"name": "Freezer 2",
+//				"location": "Kitchen",
+//				"labels": {"floor": "1"},
+//				"dataFormat": 5
+//			}
+//		]
+//	}
+//
+// Readings passing through the registry are enriched with the metadata of their tag,
+// and tags not in the registry are reported so they can be onboarded.
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// Tag is a known tag
+type Tag struct {
+	// MAC address of the tag, e.g. "CB:B8:33:4C:88:4F"
+	MAC      ruuvi.MAC         `json:"mac"`
+	Name     string            `json:"name"`
+	Location string            `json:"location,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+
+	// DataFormat is the data format the tag is expected to broadcast, zero if any
+	DataFormat int8 `json:"dataFormat,omitempty"`
+}
+
+// Info returns the metadata of the tag in the form attached to readings
+func (t Tag) Info() *ruuvi.TagInfo {
+	return &ruuvi.TagInfo{Name: t.Name, Location: t.Location, Labels: t.Labels}
+}
+
+// Unknown describes a tag which has been seen but is not in the registry,
+// or which broadcast a different data format than expected
+type Unknown struct {
+	MAC        string
+	DataFormat int8
+	FirstSeen  time.Time
+	LastSeen   time.Time
+	Count      int
+
+	// UnexpectedFormat is true if the tag is in the registry, but broadcast a data format other than expected
+	UnexpectedFormat bool
+}
+
+// Registry is a set of known tags. Registry is safe for concurrent use.
+type Registry struct {
+	tags map[ruuvi.MAC]Tag
+
+	mu      sync.Mutex
+	unknown map[string]*Unknown
+}
+
+type config struct {
+	Tags []Tag `json:"tags"`
+}
+
+// New returns a Registry containing given tags
+func New(tags ...Tag) (*Registry, error) {
+	r := &Registry{
+		tags:    make(map[ruuvi.MAC]Tag, len(tags)),
+		unknown: make(map[string]*Unknown),
+	}
+	for _, t := range tags {
+		if _, exists := r.tags[t.MAC]; exists {
+			return nil, fmt.Errorf("Tag %s is listed more than once", t.MAC)
+		}
+		r.tags[t.MAC] = t
+	}
+	return r, nil
+}
+
+// Parse reads a registry config from r
+func Parse(r io.Reader) (*Registry, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var c config
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("Invalid registry config: %w", err)
+	}
+	return New(c.Tags...)
+}
+
+// Load reads a registry config from the file at path
+func Load(path string) (*Registry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Lookup returns the tag with given MAC address
+func (r *Registry) Lookup(mac ruuvi.MAC) (Tag, bool) {
+	t, ok := r.tags[mac]
+	return t, ok
+}
+
+// Tags returns all tags in the registry, sorted by MAC
+func (r *Registry) Tags() []Tag {
+	tags := make([]Tag, 0, len(r.tags))
+	for _, t := range r.tags {
+		tags = append(tags, t)
+	}
+	sort.Slice(tags, func(i, j int) bool { return bytes.Compare(tags[i].MAC[:], tags[j].MAC[:]) < 0 })
+	return tags
+}
+
+// lookupReading finds the tag of a reading by its BLE address, or by the MAC address in its payload
+// The returned address is the MAC address of the tag if found, otherwise the BLE address in canonical form if it is a MAC address.
+func (r *Registry) lookupReading(reading ruuvi.Reading) (Tag, string, bool) {
+	bleMAC, err := ruuvi.ParseMAC(reading.MAC)
+	if err == nil {
+		if t, ok := r.Lookup(bleMAC); ok {
+			return t, t.MAC.String(), true
+		}
+	}
+	if reading.Data != nil {
+		if mac, err := reading.Data.MACAddress(); err == nil {
+			if t, ok := r.Lookup(mac); ok {
+				return t, t.MAC.String(), true
+			}
+		}
+	}
+	if err != nil {
+		return Tag{}, reading.MAC, false
+	}
+	return Tag{}, bleMAC.String(), false
+}
+
+// Enrich attaches the metadata of the tag to the reading, if the tag is known.
+// Unknown tags, and known tags broadcasting an unexpected data format, are recorded and reported by Unknown.
+func (r *Registry) Enrich(reading *ruuvi.Reading) bool {
+	t, mac, ok := r.lookupReading(*reading)
+
+	var format int8
+	if reading.Data != nil {
+		format = reading.Data.DataFormat()
+	}
+	unexpected := ok && t.DataFormat != 0 && reading.Data != nil && format != t.DataFormat
+	if !ok || unexpected {
+		r.observe(mac, format, reading.Timestamp, unexpected)
+	}
+	if ok {
+		reading.Tag = t.Info()
+	}
+	return ok
+}
+
+func (r *Registry) observe(mac string, format int8, ts time.Time, unexpected bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.unknown[mac]
+	if !ok {
+		u = &Unknown{MAC: mac, FirstSeen: ts}
+		r.unknown[mac] = u
+	}
+	u.DataFormat = format
+	u.LastSeen = ts
+	u.Count++
+	u.UnexpectedFormat = unexpected
+}
+
+// Unknown returns tags seen by Enrich which are not in the registry or broadcast an unexpected data format, sorted by MAC
+func (r *Registry) Unknown() []Unknown {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	unknown := make([]Unknown, 0, len(r.unknown))
+	for _, u := range r.unknown {
+		unknown = append(unknown, *u)
+	}
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i].MAC < unknown[j].MAC })
+	return unknown
+}
+
+// EnrichAll enriches readings received from in and sends them to out, until in is closed or ctx is done.
+// Readings of unknown tags are passed through unchanged. out is closed on return.
+func (r *Registry) EnrichAll(ctx context.Context, in <-chan ruuvi.Reading, out chan<- ruuvi.Reading) {
+	defer close(out)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case reading, ok := <-in:
+			if !ok {
+				return
+			}
+			r.Enrich(&reading)
+			select {
+			case out <- reading:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
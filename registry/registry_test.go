@@ -0,0 +1,160 @@
+package registry
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/fixture"
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+const testConfig = `{
+	"tags": [
+		{
+			"mac": "cb:b8:33:4c:88:4f",
+			"name": "Freezer 2",
+			"location": "Kitchen",
+			"labels": {"floor": "1"},
+			"dataFormat": 5
+		},
+		{"mac": "D1-2A-3B-4C-5D-6E", "name": "Sauna"}
+	]
+}`
+
+func mustParse(t *testing.T) *Registry {
+	t.Helper()
+	r, err := Parse(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatal("Parse() returned error:", err)
+	}
+	return r
+}
+
+func TestParse(t *testing.T) {
+	r := mustParse(t)
+	expected := []Tag{
+		{MAC: ruuvi.MAC{0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F}, Name: "Freezer 2", Location: "Kitchen", Labels: map[string]string{"floor": "1"}, DataFormat: 5},
+		{MAC: ruuvi.MAC{0xD1, 0x2A, 0x3B, 0x4C, 0x5D, 0x6E}, Name: "Sauna"},
+	}
+	if diff := cmp.Diff(expected, r.Tags()); diff != "" {
+		t.Fatal("Unexpected tags (-want +got):\n", diff)
+	}
+
+	for _, s := range []string{"CB:B8:33:4C:88:4F", "cb:b8:33:4c:88:4f", "CB-B8-33-4C-88-4F", "CBB8334C884F"} {
+		mac, err := ruuvi.ParseMAC(s)
+		if err != nil {
+			t.Errorf("ParseMAC(%q) failed: %v", s, err)
+			continue
+		}
+		if tag, ok := r.Lookup(mac); !ok || tag.Name != "Freezer 2" {
+			t.Errorf("Lookup(%q) = %v, %v", s, tag, ok)
+		}
+	}
+	if _, ok := r.Lookup(ruuvi.MAC{}); ok {
+		t.Error("Lookup of unknown MAC should fail")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for name, input := range map[string]string{
+		"not json":      `tags:`,
+		"unknown field": `{"tags": [{"mac": "CB:B8:33:4C:88:4F", "colour": "red"}]}`,
+		"invalid mac":   `{"tags": [{"mac": "CB:B8:33:4C:88"}]}`,
+		"duplicate":     `{"tags": [{"mac": "CB:B8:33:4C:88:4F"}, {"mac": "cb:b8:33:4c:88:4f"}]}`,
+	} {
+		if _, err := Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tags.json")
+	if err := ioutil.WriteFile(path, []byte(testConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Load(path)
+	if err != nil {
+		t.Fatal("Load() returned error:", err)
+	}
+	if len(r.Tags()) != 2 {
+		t.Fatal("Expected 2 tags, got", r.Tags())
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatal("Expected error for missing file")
+	}
+}
+
+func TestEnrich(t *testing.T) {
+	r := mustParse(t)
+	ts := time.Date(2021, 3, 31, 9, 31, 31, 0, time.UTC)
+
+	// known by BLE address
+	reading := ruuvi.Reading{Timestamp: ts, MAC: "d1:2a:3b:4c:5d:6e", Data: fixture.Process(t, fixture.RAWv1)}
+	if !r.Enrich(&reading) {
+		t.Fatal("Expected tag to be known by BLE address")
+	}
+	if diff := cmp.Diff(&ruuvi.TagInfo{Name: "Sauna"}, reading.Tag); diff != "" {
+		t.Fatal("Unexpected tag info (-want +got):\n", diff)
+	}
+
+	// known by MAC address in payload, e.g. when BLE address is random
+	reading = ruuvi.Reading{Timestamp: ts, MAC: "11:22:33:44:55:66", Data: fixture.Process(t, fixture.RAWv2)}
+	if !r.Enrich(&reading) {
+		t.Fatal("Expected tag to be known by payload MAC address")
+	}
+	if reading.Tag == nil || reading.Tag.Location != "Kitchen" {
+		t.Fatal("Unexpected tag info:", reading.Tag)
+	}
+
+	// unknown tag
+	for i := 0; i < 2; i++ {
+		reading = ruuvi.Reading{Timestamp: ts.Add(time.Duration(i) * time.Second), MAC: "ee:00:00:00:00:01", Data: fixture.Process(t, fixture.RAWv1)}
+		if r.Enrich(&reading) || reading.Tag != nil {
+			t.Fatal("Expected tag to be unknown")
+		}
+	}
+
+	// known tag broadcasting another data format than expected
+	reading = ruuvi.Reading{Timestamp: ts, MAC: "CB:B8:33:4C:88:4F", Data: fixture.Process(t, fixture.RAWv1)}
+	if !r.Enrich(&reading) {
+		t.Fatal("Expected tag to be known")
+	}
+
+	expected := []Unknown{
+		{MAC: "CB:B8:33:4C:88:4F", DataFormat: 3, FirstSeen: ts, LastSeen: ts, Count: 1, UnexpectedFormat: true},
+		{MAC: "EE:00:00:00:00:01", DataFormat: 3, FirstSeen: ts, LastSeen: ts.Add(time.Second), Count: 2},
+	}
+	if diff := cmp.Diff(expected, r.Unknown()); diff != "" {
+		t.Fatal("Unexpected unknown tags (-want +got):\n", diff)
+	}
+}
+
+func TestEnrichAll(t *testing.T) {
+	r := mustParse(t)
+	in := make(chan ruuvi.Reading, 2)
+	out := make(chan ruuvi.Reading, 2)
+	in <- ruuvi.Reading{MAC: "CB:B8:33:4C:88:4F", Data: fixture.Process(t, fixture.RAWv2)}
+	in <- ruuvi.Reading{MAC: "EE:00:00:00:00:01", Data: fixture.Process(t, fixture.RAWv1)}
+	close(in)
+
+	r.EnrichAll(context.Background(), in, out)
+
+	var names []string
+	for reading := range out {
+		if reading.Tag != nil {
+			names = append(names, reading.Tag.Name)
+		} else {
+			names = append(names, "")
+		}
+	}
+	if diff := cmp.Diff([]string{"Freezer 2", ""}, names); diff != "" {
+		t.Fatal("Unexpected readings (-want +got):\n", diff)
+	}
+}
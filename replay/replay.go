@@ -0,0 +1,189 @@
+// Package replay records reading streams into files and replays them back.
+//
+// Recordings are JSON lines, one advertisement per line:
+//
+//	{"timestamp":"2021-03-31T09:31:31.5Z","mac":"CB:B8:33:4C:88:4F","rssi":-53,"data":"99040512fc..."}
+//
+// where data is the hex encoded manufacturer data, including the company ID.
+// The company ID is always the one of Ruuvi Innovations Ltd, so only readings of data formats registered for it can be recorded.
+// Readings with tag metadata have it in a "tag" object, e.g. {"name":"Freezer 2","location":"Kitchen"}.
+// The BLE address type and the receiver are recorded as "addressType" and "receiver", if known.
+package replay
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// companyID is the little endian Ruuvi Innovations Ltd company ID prefixing manufacturer data
+var companyID = []byte{0x99, 0x04}
+
+type line struct {
+	Timestamp time.Time `json:"timestamp"`
+	MAC       string    `json:"mac"`
+	RSSI      int       `json:"rssi"`
+	Data      string    `json:"data"`
+
+	AddressType ruuvi.AddressType `json:"addressType,omitempty"`
+	Receiver    string            `json:"receiver,omitempty"`
+
+	Tag *ruuvi.TagInfo `json:"tag,omitempty"`
+}
+
+// Recorder writes readings into a recording
+type Recorder struct {
+	enc *json.Encoder
+}
+
+// NewRecorder returns a Recorder writing to w
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// Record writes a single reading.
+// An error is returned if the data format of the reading is not registered for the Ruuvi Innovations Ltd company ID
+// in ruuvi.DefaultFormats, since the reading could not be replayed.
+func (r *Recorder) Record(reading ruuvi.Reading) error {
+	l := line{
+		Timestamp: reading.Timestamp.UTC(),
+		MAC:       reading.MAC,
+		RSSI:      reading.RSSI,
+		Tag:       reading.Tag,
+
+		AddressType: reading.AddressType,
+		Receiver:    reading.Receiver,
+	}
+	if reading.Data != nil {
+		f := byte(reading.Data.DataFormat())
+		if _, ok := ruuvi.DefaultFormats.Lookup(ruuvi.RUUVI_INNOVATIONS_LTD_TAG, f); !ok {
+			return fmt.Errorf("Data format %d is not registered for the Ruuvi Innovations Ltd company ID", f)
+		}
+		l.Data = hex.EncodeToString(append(append([]byte{}, companyID...), reading.Data.RawData()...))
+	}
+	return r.enc.Encode(&l)
+}
+
+// RecordAll writes readings received from the channel until it is closed or ctx is cancelled
+func (r *Recorder) RecordAll(ctx context.Context, readings <-chan ruuvi.Reading) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case reading, ok := <-readings:
+			if !ok {
+				return nil
+			}
+			if err := r.Record(reading); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Replayer implements ruuvi.Source by replaying a recording.
+// Advertisements are decoded with ruuvi.ProcessAdvertisement, and ones it rejects are skipped, like a live scanner would.
+type Replayer struct {
+	r io.Reader
+
+	// Speed controls pacing: 1 replays in real time, 2 twice as fast, etc.
+	// Zero or negative replays as fast as possible.
+	Speed float64
+
+	// Retime replaces recorded timestamps with the time each reading is replayed,
+	// so readings look like they were received just now
+	Retime bool
+
+	// sleep waits for given duration to pace the replay, returning the error of ctx if it is done first
+	sleep func(ctx context.Context, d time.Duration) error
+	// now returns the current time, which pacing is measured from and Retime stamps readings with
+	now func() time.Time
+}
+
+var _ ruuvi.Source = (*Replayer)(nil)
+
+// NewReplayer returns a Replayer reading the recording from r, replaying in real time
+func NewReplayer(r io.Reader) *Replayer {
+	return &Replayer{r: r, Speed: 1, sleep: sleep, now: time.Now}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Run implements ruuvi.Source. The recording can only be replayed once.
+func (p *Replayer) Run(ctx context.Context, out chan<- ruuvi.Reading) error {
+	s := bufio.NewScanner(p.r)
+	s.Buffer(make([]byte, 0, 4096), 1024*1024)
+
+	var (
+		first      time.Time
+		replayFrom = p.now()
+		lineNumber int
+	)
+
+	for s.Scan() {
+		lineNumber++
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		var l line
+		if err := json.Unmarshal(s.Bytes(), &l); err != nil {
+			return fmt.Errorf("Line %d: %w", lineNumber, err)
+		}
+		b, err := hex.DecodeString(l.Data)
+		if err != nil {
+			return fmt.Errorf("Line %d: invalid data: %w", lineNumber, err)
+		}
+
+		if first.IsZero() {
+			first = l.Timestamp
+		}
+		offset := l.Timestamp.Sub(first)
+		if p.Speed > 0 {
+			wait := time.Duration(float64(offset)/p.Speed) - p.now().Sub(replayFrom)
+			if wait > 0 {
+				if err := p.sleep(ctx, wait); err != nil {
+					return nil
+				}
+			}
+		}
+
+		data, err := ruuvi.ProcessAdvertisement(b)
+		if err != nil {
+			continue
+		}
+		reading := ruuvi.Reading{
+			Timestamp:   l.Timestamp,
+			MAC:         l.MAC,
+			AddressType: l.AddressType,
+			RSSI:        l.RSSI,
+			Receiver:    l.Receiver,
+			Data:        data,
+			Tag:         l.Tag,
+		}
+		if p.Retime {
+			reading.Timestamp = p.now()
+		}
+
+		select {
+		case out <- reading:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return s.Err()
+}
@@ -0,0 +1,191 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+var start = time.Date(2021, 3, 31, 9, 31, 31, 500000000, time.UTC)
+
+const recording = `{"timestamp":"2021-03-31T09:31:31.5Z","mac":"CB:B8:33:4C:88:4F","rssi":-53,"data":"99040512fc5394c37c0004fffc040cac364200cdcbb8334c884f"}
+{"timestamp":"2021-03-31T09:31:32.5Z","mac":"D1:2A:3B:4C:5D:6E","rssi":-70,"data":"990403291a1ece1efc18f94202ca0b53","addressType":"random","receiver":"gw1"}
+{"timestamp":"2021-03-31T09:31:35.5Z","mac":"CB:B8:33:4C:88:4F","rssi":-54,"data":"99040512fc5394c37c0004fffc040cac364200cdcbb8334c884f"}
+`
+
+// fakeClock advances only when slept on
+type fakeClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.slept = append(c.slept, d)
+	c.now = c.now.Add(d)
+	return nil
+}
+
+func newTestReplayer(input string, speed float64) (*Replayer, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	p := NewReplayer(strings.NewReader(input))
+	p.Speed = speed
+	p.now = clock.Now
+	p.sleep = clock.Sleep
+	return p, clock
+}
+
+func collect(t *testing.T, src ruuvi.Source) []ruuvi.Reading {
+	t.Helper()
+	out := make(chan ruuvi.Reading, 100)
+	if err := src.Run(context.Background(), out); err != nil {
+		t.Fatal("Run() returned error:", err)
+	}
+	close(out)
+	var readings []ruuvi.Reading
+	for r := range out {
+		readings = append(readings, r)
+	}
+	return readings
+}
+
+func TestRecordReplayRoundTrip(t *testing.T) {
+	p, _ := newTestReplayer(recording, 0)
+	readings := collect(t, p)
+	if len(readings) != 3 {
+		t.Fatal("Expected 3 readings, got", len(readings))
+	}
+	if r := readings[1]; r.AddressType != ruuvi.AddressRandom || r.Receiver != "gw1" {
+		t.Fatalf("Receive metadata not replayed: %v, %q", r.AddressType, r.Receiver)
+	}
+
+	var buf bytes.Buffer
+	ch := make(chan ruuvi.Reading, len(readings))
+	for _, r := range readings {
+		ch <- r
+	}
+	close(ch)
+	if err := NewRecorder(&buf).RecordAll(context.Background(), ch); err != nil {
+		t.Fatal("RecordAll() returned error:", err)
+	}
+
+	if diff := cmp.Diff(recording, buf.String()); diff != "" {
+		t.Fatal("Recording differs after round trip (-want +got):\n", diff)
+	}
+}
+
+// otherFormat is data of a format not registered for the Ruuvi Innovations Ltd company ID
+type otherFormat struct {
+	ruuvi.AdvertisementData
+}
+
+func (otherFormat) DataFormat() int8 { return 0x12 }
+
+func TestRecordRejectsOtherFormats(t *testing.T) {
+	p, _ := newTestReplayer(recording, 0)
+	r := collect(t, p)[0]
+	r.Data = otherFormat{r.Data}
+	var buf bytes.Buffer
+	if err := NewRecorder(&buf).Record(r); err == nil {
+		t.Fatal("Expected error for data format of another company")
+	}
+	if buf.Len() != 0 {
+		t.Fatal("Expected nothing to be recorded, got", buf.String())
+	}
+}
+
+func TestReplayDecodes(t *testing.T) {
+	p, _ := newTestReplayer(recording, 0)
+	readings := collect(t, p)
+
+	r := readings[1]
+	if !r.Timestamp.Equal(start.Add(time.Second)) || r.MAC != "D1:2A:3B:4C:5D:6E" || r.RSSI != -70 {
+		t.Fatal("Unexpected reading metadata:", r)
+	}
+	if r.Data.DataFormat() != 3 {
+		t.Fatal("Wrong data format:", r.Data.DataFormat())
+	}
+	if temp, err := r.Data.Temperature(); err != nil || temp != 26.3 {
+		t.Fatal("Wrong temperature:", temp, err)
+	}
+}
+
+func TestReplayPacing(t *testing.T) {
+	for _, tc := range []struct {
+		speed    float64
+		expected []time.Duration
+	}{
+		{0, nil},
+		{1, []time.Duration{time.Second, 3 * time.Second}},
+		{10, []time.Duration{100 * time.Millisecond, 300 * time.Millisecond}},
+	} {
+		p, clock := newTestReplayer(recording, tc.speed)
+		collect(t, p)
+		if !cmp.Equal(tc.expected, clock.slept) {
+			t.Errorf("Speed %v: expected sleeps %v, got %v", tc.speed, tc.expected, clock.slept)
+		}
+	}
+}
+
+func TestReplayRetime(t *testing.T) {
+	p, clock := newTestReplayer(recording, 1)
+	replayStart := clock.now
+	p.Retime = true
+	readings := collect(t, p)
+
+	expected := []time.Time{replayStart, replayStart.Add(time.Second), replayStart.Add(4 * time.Second)}
+	for i, r := range readings {
+		if !r.Timestamp.Equal(expected[i]) {
+			t.Errorf("Reading %d: expected timestamp %v, got %v", i, expected[i], r.Timestamp)
+		}
+	}
+}
+
+func TestReplaySkipsUnsupported(t *testing.T) {
+	input := `{"timestamp":"2021-03-31T09:31:31.5Z","mac":"E0:01:02:03:04:05","rssi":-80,"data":"4c000215"}
+{"timestamp":"2021-03-31T09:31:31.5Z","mac":"E0:01:02:03:04:05","rssi":-80,"data":"99040212"}
+` + recording
+	p, _ := newTestReplayer(input, 0)
+	if readings := collect(t, p); len(readings) != 3 {
+		t.Fatal("Expected 3 readings, got", len(readings))
+	}
+}
+
+func TestReplayMalformed(t *testing.T) {
+	for _, input := range []string{
+		"not json\n",
+		`{"timestamp":"2021-03-31T09:31:31.5Z","mac":"CB:B8:33:4C:88:4F","rssi":-53,"data":"zz"}` + "\n",
+	} {
+		p, _ := newTestReplayer(input, 0)
+		if err := p.Run(context.Background(), make(chan ruuvi.Reading, 1)); err == nil {
+			t.Errorf("Expected error for input %q", input)
+		}
+	}
+}
+
+func TestReplayCancel(t *testing.T) {
+	p := NewReplayer(strings.NewReader(recording))
+	ctx, cancel := context.WithCancel(context.Background())
+	out := make(chan ruuvi.Reading)
+
+	done := make(chan error)
+	go func() { done <- p.Run(ctx, out) }()
+	<-out
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal("Run() returned error after cancel:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run() did not return after cancel")
+	}
+}
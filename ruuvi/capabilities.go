@@ -0,0 +1,55 @@
+package ruuvi
+
+import (
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/measurement"
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/rawv1"
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/rawv2"
+)
+
+// FieldInfo describes a field as supported by a data format: its name, unit, resolution and range of valid values
+type FieldInfo = measurement.FieldInfo
+
+// Capabilities lists the fields supported by a data format
+type Capabilities = measurement.Capabilities
+
+// Fields returns every field in a fixed order, which is also the order of Capabilities.Fields
+func Fields() []Field {
+	return measurement.Fields()
+}
+
+// CapabilityReporter is implemented by AdvertisementData which reports the capabilities of its data format.
+// AdvertisementData of the built-in data formats implements it, and so should that of formats added with RegisterFormat.
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
+
+// FormatCapabilities returns the capabilities of a built-in data format
+func FormatCapabilities(dataFormat int8) (Capabilities, bool) {
+	switch dataFormat {
+	case 3:
+		return rawv1.Capabilities(), true
+	case 5:
+		return rawv2.Capabilities(), true
+	}
+	return Capabilities{}, false
+}
+
+// CapabilitiesOf returns the capabilities of the data format of d,
+// which is false if d does not implement CapabilityReporter and is not of a built-in data format
+func CapabilitiesOf(d AdvertisementData) (Capabilities, bool) {
+	if r, ok := d.(CapabilityReporter); ok {
+		return r.Capabilities(), true
+	}
+	return FormatCapabilities(d.DataFormat())
+}
+
+// MeasurementsOf returns the values of d, with the fields d returns without error marked valid
+func MeasurementsOf(d AdvertisementData) Measurements {
+	return measurement.Of(d)
+}
+
+// ReadField reads the value of a single field f of d into m, marking it valid if d returns it without error.
+// The error of d is returned, e.g. one wrapping ErrUnsupportedField.
+func ReadField(d AdvertisementData, f Field, m *Measurements) error {
+	return measurement.Read(d, f, m)
+}
@@ -0,0 +1,84 @@
+package ruuvi
+
+import (
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/measurement"
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/rawv1"
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/rawv2"
+)
+
+// maxRawLength is the length of the longest supported data format
+const maxRawLength = rawv2.Length
+
+// Decoded is a decoded advertisement held by value, filled in by Decode.
+// Unlike AdvertisementData, it holds a copy of the raw data, so it stays valid
+// after the buffer it was decoded from is reused, and it can be reused itself
+// for decoding the next advertisement.
+type Decoded struct {
+	Measurements
+
+	raw    [maxRawLength]byte
+	rawLen int
+}
+
+// RawData returns the raw bytes of the advertisement, starting with the data format byte.
+// Bytes after the end of the data format are not kept. The returned slice refers to d, and is overwritten when d is decoded into again.
+func (d *Decoded) RawData() []byte {
+	return d.raw[:d.rawLen]
+}
+
+// AppendJSON appends d as JSON to b and returns the extended buffer.
+// The output is the same as from MarshalJSON of AdvertisementData, except that the raw data
+// has no bytes after the end of the data format, see RawData.
+// Nothing is allocated if b has enough capacity.
+func (d *Decoded) AppendJSON(b []byte) []byte {
+	return measurement.AppendJSON(b, &d.Measurements, d.RawData())
+}
+
+// errors returned by Decode, preallocated so decoding does not allocate
+var (
+	errNotFromRuuviTag   = newUnsupportedData("Data is not from Ruuvi Innovations Ltd product")
+	errUnsupportedFormat = newUnsupportedData("Package does not support this data format (yet)")
+)
+
+// Decode decodes manufacturer data like ProcessAdvertisement, but into d instead of a new AdvertisementData.
+// Only the built-in data formats are supported, not formats added with RegisterFormat.
+// Decode does not allocate or panic, and d does not refer to data after Decode returns, so data can be reused right away.
+// Fields the data format does not support, or the tag reported as invalid, are left out of d.Valid.
+// On error d is left zeroed.
+func Decode(data []byte, d *Decoded) error {
+	*d = Decoded{}
+	if !IsAdvertisementFromRuuviTag(data) {
+		return errNotFromRuuviTag
+	}
+	return DecodePayload(data[2:], d)
+}
+
+// DecodePayload decodes payload, starting with the data format byte and without the company ID, like ProcessPayload,
+// but into d like Decode does.
+func DecodePayload(payload []byte, d *Decoded) error {
+	*d = Decoded{}
+	if len(payload) < 1 {
+		return errUnsupportedFormat
+	}
+
+	var (
+		err    error
+		length int
+	)
+	switch payload[0] {
+	case 0x3:
+		length = rawv1.Length
+		err = rawv1.Decode(payload, &d.Measurements)
+	case 0x5:
+		length = rawv2.Length
+		err = rawv2.Decode(payload, &d.Measurements)
+	default:
+		return errUnsupportedFormat
+	}
+	if err != nil {
+		d.Measurements = Measurements{}
+		return err
+	}
+	d.rawLen = copy(d.raw[:], payload[:length])
+	return nil
+}
@@ -0,0 +1,55 @@
+package ruuvi
+
+import (
+	"encoding/binary"
+
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/measurement"
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/rawv1"
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/rawv2"
+)
+
+// Measurements holds the values of a single advertisement, see Encode
+type Measurements = measurement.Measurements
+
+// Field identifies a single measured field. Fields can be combined into a set with bitwise or.
+type Field = measurement.Field
+
+const (
+	FieldTemperature               = measurement.Temperature
+	FieldHumidity                  = measurement.Humidity
+	FieldPressure                  = measurement.Pressure
+	FieldAccelerationX             = measurement.AccelerationX
+	FieldAccelerationY             = measurement.AccelerationY
+	FieldAccelerationZ             = measurement.AccelerationZ
+	FieldBatteryVoltage            = measurement.BatteryVoltage
+	FieldTransmissionPower         = measurement.TransmissionPower
+	FieldMovementCounter           = measurement.MovementCounter
+	FieldMeasurementSequenceNumber = measurement.MeasurementSequenceNumber
+	FieldMACAddress                = measurement.MACAddress
+)
+
+// Encode returns manufacturer data, prefixed with the Ruuvi Innovations Ltd company ID,
+// containing given measurements in the data format m.DataFormat.
+// The result can be given to ProcessAdvertisement.
+// Fields not marked valid in m.Valid are encoded as invalid, if the data format supports it.
+func Encode(m Measurements) ([]byte, error) {
+	var (
+		b   []byte
+		err error
+	)
+	switch m.DataFormat {
+	case 3:
+		b, err = rawv1.Encode(m)
+	case 5:
+		b, err = rawv2.Encode(m)
+	default:
+		return nil, newUnsupportedData("Package does not support encoding this data format (yet)")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 2, 2+len(b))
+	binary.LittleEndian.PutUint16(out, RUUVI_INNOVATIONS_LTD_TAG)
+	return append(out, b...), nil
+}
@@ -0,0 +1,213 @@
+package ruuvi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/rawv1"
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/rawv2"
+)
+
+// FormatDecoder decodes payload, starting with the data format byte and without the company ID, into AdvertisementData.
+// payload refers to the caller's buffer, so the returned AdvertisementData must copy it in Copy().
+// FormatDecoder must not panic on any input.
+type FormatDecoder func(payload []byte) (AdvertisementData, error)
+
+// Format identifies a data format by the company ID of the manufacturer data and the data format byte following it
+type Format struct {
+	CompanyID  uint16
+	DataFormat byte
+}
+
+func (f Format) String() string {
+	return fmt.Sprintf("data format %d of company ID 0x%04X", f.DataFormat, f.CompanyID)
+}
+
+// ErrFormatRegistered is wrapped by the error returned when registering a data format which already has a decoder
+var ErrFormatRegistered = errors.New("Data format is already registered")
+
+// FormatRegistry maps data formats to their decoders.
+// FormatRegistry is safe for concurrent use.
+type FormatRegistry struct {
+	mu        sync.RWMutex
+	decoders  map[Format]FormatDecoder
+	companies map[uint16]int
+}
+
+// NewFormatRegistry returns pointer to an empty FormatRegistry.
+// Most applications should register to DefaultFormats instead, which ProcessAdvertisement uses.
+func NewFormatRegistry() *FormatRegistry {
+	return &FormatRegistry{
+		decoders:  make(map[Format]FormatDecoder),
+		companies: make(map[uint16]int),
+	}
+}
+
+// DefaultFormats is the registry used by ProcessAdvertisement, with the built-in data formats registered
+var DefaultFormats = newDefaultFormats()
+
+func newDefaultFormats() *FormatRegistry {
+	r := NewFormatRegistry()
+	_ = r.Register(0x3, decodeRAWv1)
+	_ = r.Register(0x5, decodeRAWv2)
+	return r
+}
+
+// the constructors return typed nil pointers on error, which must not end up in a non-nil interface
+func decodeRAWv1(payload []byte) (AdvertisementData, error) {
+	d, err := rawv1.NewDataRAWv1(payload)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func decodeRAWv2(payload []byte) (AdvertisementData, error) {
+	d, err := rawv2.NewDataRAWv2(payload)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// RegisterFormat registers decode for Ruuvi Innovations Ltd data format dataFormat in DefaultFormats
+func RegisterFormat(dataFormat byte, decode FormatDecoder) error {
+	return DefaultFormats.Register(dataFormat, decode)
+}
+
+// RegisterCompanyFormat registers decode for data format dataFormat of given company ID in DefaultFormats
+func RegisterCompanyFormat(companyID uint16, dataFormat byte, decode FormatDecoder) error {
+	return DefaultFormats.RegisterCompany(companyID, dataFormat, decode)
+}
+
+// Register registers decode for Ruuvi Innovations Ltd data format dataFormat.
+// An error is returned if the data format already has a decoder.
+func (r *FormatRegistry) Register(dataFormat byte, decode FormatDecoder) error {
+	return r.RegisterCompany(RUUVI_INNOVATIONS_LTD_TAG, dataFormat, decode)
+}
+
+// RegisterCompany registers decode for data format dataFormat in manufacturer data with given company ID.
+// An error is returned if the data format already has a decoder.
+func (r *FormatRegistry) RegisterCompany(companyID uint16, dataFormat byte, decode FormatDecoder) error {
+	f := Format{CompanyID: companyID, DataFormat: dataFormat}
+	if decode == nil {
+		return fmt.Errorf("No decoder given for %v", f)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.decoders[f]; ok {
+		return fmt.Errorf("%w: %v", ErrFormatRegistered, f)
+	}
+	r.decoders[f] = decode
+	r.companies[companyID]++
+	return nil
+}
+
+// Lookup returns the decoder registered for given company ID and data format, if any
+func (r *FormatRegistry) Lookup(companyID uint16, dataFormat byte) (FormatDecoder, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	decode, ok := r.decoders[Format{CompanyID: companyID, DataFormat: dataFormat}]
+	return decode, ok
+}
+
+// Formats returns the registered data formats sorted by company ID and data format
+func (r *FormatRegistry) Formats() []Format {
+	r.mu.RLock()
+	formats := make([]Format, 0, len(r.decoders))
+	for f := range r.decoders {
+		formats = append(formats, f)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(formats, func(i, j int) bool {
+		if formats[i].CompanyID != formats[j].CompanyID {
+			return formats[i].CompanyID < formats[j].CompanyID
+		}
+		return formats[i].DataFormat < formats[j].DataFormat
+	})
+	return formats
+}
+
+// Process decodes manufacturer data, starting with the company ID, with the decoder registered for its data format
+func (r *FormatRegistry) Process(data []byte) (AdvertisementData, error) {
+	if len(data) < 2 {
+		return nil, newUnsupportedData("Data is not from Ruuvi Innovations Ltd product")
+	}
+	companyID := binary.LittleEndian.Uint16(data[0:2])
+
+	r.mu.RLock()
+	known := r.companies[companyID] > 0
+	r.mu.RUnlock()
+	if !known {
+		if companyID == RUUVI_INNOVATIONS_LTD_TAG {
+			return nil, newUnsupportedData("Package does not support this data format (yet)")
+		}
+		return nil, newUnsupportedData("Data is not from Ruuvi Innovations Ltd product")
+	}
+	if len(data) < 3 {
+		return nil, newUnsupportedData("Data does not contain data format")
+	}
+
+	decode, ok := r.Lookup(companyID, data[2])
+	if !ok {
+		return nil, newUnsupportedData("Package does not support this data format (yet)")
+	}
+	return decode(data[2:])
+}
+
+// ProcessPayload decodes payload, starting with the data format byte, with the decoder registered for
+// the Ruuvi Innovations Ltd data format
+func (r *FormatRegistry) ProcessPayload(payload []byte) (AdvertisementData, error) {
+	if len(payload) < 1 {
+		return nil, newUnsupportedData("Data does not contain data format")
+	}
+	decode, ok := r.Lookup(RUUVI_INNOVATIONS_LTD_TAG, payload[0])
+	if !ok {
+		return nil, newUnsupportedData("Package does not support this data format (yet)")
+	}
+	return decode(payload)
+}
+
+// payloadLengths are the lengths of payloads of the built-in data formats
+var payloadLengths = map[byte]int{
+	0x3: rawv1.Length,
+	0x5: rawv2.Length,
+}
+
+// ProcessAuto decodes data which is either manufacturer data starting with the company ID, or a payload
+// starting with a Ruuvi Innovations Ltd data format byte.
+//
+// The two cannot always be told apart: manufacturer data of another company, e.g. 05 01 for company ID 0x0105,
+// can start like a payload. Data is therefore taken as manufacturer data if it starts with the Ruuvi Innovations Ltd
+// company ID or another company ID with registered data formats, and as a payload only if its first byte is
+// a registered Ruuvi Innovations Ltd data format and, for the built-in data formats, it has exactly the length
+// of a payload of that format. Anything else is manufacturer data, which is rejected unless its data format is registered.
+// Manufacturer data of an unregistered company which happens to look like a complete payload is still decoded as one,
+// so use ProcessPayload or Process when the form of the data is known.
+func (r *FormatRegistry) ProcessAuto(data []byte) (AdvertisementData, error) {
+	if len(data) >= 2 && r.hasCompany(binary.LittleEndian.Uint16(data[0:2])) {
+		return r.Process(data)
+	}
+	if len(data) >= 1 {
+		n, fixed := payloadLengths[data[0]]
+		if _, ok := r.Lookup(RUUVI_INNOVATIONS_LTD_TAG, data[0]); ok && (!fixed || len(data) == n) {
+			return r.ProcessPayload(data)
+		}
+	}
+	return r.Process(data)
+}
+
+// hasCompany reports whether data formats of given company ID are registered
+func (r *FormatRegistry) hasCompany(companyID uint16) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.companies[companyID] > 0
+}
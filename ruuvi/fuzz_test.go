@@ -0,0 +1,58 @@
+//go:build go1.18
+// +build go1.18
+
+package ruuvi
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// FuzzProcessAdvertisement checks that no input makes ProcessAdvertisement, Decode or
+// the methods of the returned AdvertisementData panic, and that both decoders agree
+func FuzzProcessAdvertisement(f *testing.F) {
+	for _, b := range [][]byte{testRAWv2, testRAWv2Invalid, testRAWv1, {}, {0x99}, {0x99, 0x04}, {0x99, 0x04, 0x05}, {0x99, 0x04, 0x03}} {
+		f.Add(b)
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var decoded Decoded
+		decodeErr := Decode(b, &decoded)
+
+		d, err := ProcessAdvertisement(b)
+		if (err == nil) != (decodeErr == nil) {
+			t.Fatalf("ProcessAdvertisement() returned %v but Decode() returned %v", err, decodeErr)
+		}
+		if err != nil {
+			return
+		}
+
+		if d.DataFormat() != decoded.DataFormat {
+			t.Errorf("DataFormat() = %d, Decode() returned %d", d.DataFormat(), decoded.DataFormat)
+		}
+		_, _ = d.Temperature()
+		_, _ = d.Humidity()
+		_, _ = d.Pressure()
+		_, _ = d.AccelerationX()
+		_, _ = d.AccelerationY()
+		_, _ = d.AccelerationZ()
+		_, _ = d.BatteryVoltage()
+		_, _ = d.TransmissionPower()
+		_, _ = d.MovementCounter()
+		_, _ = d.MeasurementSequenceNumber()
+		_, _ = d.MACAddress()
+		_ = d.RawData()
+
+		j, err := d.MarshalJSON()
+		if err != nil {
+			t.Fatal("MarshalJSON() returned error:", err)
+		}
+		if !json.Valid(j) {
+			t.Fatalf("MarshalJSON() returned invalid JSON: %s", j)
+		}
+		if a := decoded.AppendJSON(nil); !json.Valid(a) {
+			t.Fatalf("AppendJSON() returned invalid JSON: %s", a)
+		}
+		d.Copy()
+	})
+}
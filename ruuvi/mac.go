@@ -0,0 +1,15 @@
+package ruuvi
+
+import "github.com/LassiHeikkila/go-ruuvi/internal/pkg/measurement"
+
+// MAC is a 48 bit MAC address, e.g. as returned by AdvertisementData.MACAddress().
+// MAC is a comparable value type which can be used as a map key.
+// It is formatted, and marshalled as text and JSON, in canonical upper case colon separated form, e.g. "CB:B8:33:4C:88:4F".
+type MAC = measurement.MAC
+
+// ParseMAC parses a MAC address in canonical form, in lower case, separated with '-' or without separators.
+// For compatibility with JSON written by earlier versions of this package, bytes without zero padding
+// such as "cb:b8:33:4c:88:f" are accepted too.
+func ParseMAC(s string) (MAC, error) {
+	return measurement.ParseMAC(s)
+}
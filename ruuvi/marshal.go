@@ -0,0 +1,141 @@
+package ruuvi
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Advertisement holds AdvertisementData so that it can be stored and loaded directly with the
+// encoding.BinaryMarshaler, encoding.TextMarshaler, json.Marshaler and database/sql interfaces,
+// and their counterparts for loading.
+//
+// The stored form is the raw data, starting with the data format byte, as binary or as lower case hex encoded text.
+// Loading goes through DefaultFormats like ProcessAdvertisement, so any data format registered for
+// the Ruuvi Innovations Ltd company ID can be loaded. Loaded data does not refer to the input.
+// A nil AdvertisementData is stored as SQL NULL and JSON null.
+type Advertisement struct {
+	AdvertisementData
+}
+
+// HexAdvertisement is Advertisement stored into SQL as hex encoded text instead of binary, e.g. for text columns.
+// Scan accepts both.
+type HexAdvertisement struct {
+	Advertisement
+}
+
+var errNoData = errors.New("Advertisement has no data")
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (a Advertisement) MarshalBinary() ([]byte, error) {
+	if a.AdvertisementData == nil {
+		return nil, errNoData
+	}
+	raw := a.RawData()
+	b := make([]byte, len(raw))
+	copy(b, raw)
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler
+func (a *Advertisement) UnmarshalBinary(b []byte) error {
+	data := make([]byte, 2, 2+len(b))
+	data[0], data[1] = 0x99, 0x04
+	d, err := ProcessAdvertisement(append(data, b...))
+	if err != nil {
+		return err
+	}
+	a.AdvertisementData = d
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (a Advertisement) MarshalText() ([]byte, error) {
+	if a.AdvertisementData == nil {
+		return nil, errNoData
+	}
+	raw := a.RawData()
+	b := make([]byte, hex.EncodedLen(len(raw)))
+	hex.Encode(b, raw)
+	return b, nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (a *Advertisement) UnmarshalText(text []byte) error {
+	b := make([]byte, hex.DecodedLen(len(text)))
+	if _, err := hex.Decode(b, text); err != nil {
+		return fmt.Errorf("Invalid hex data: %w", err)
+	}
+	return a.UnmarshalBinary(b)
+}
+
+// MarshalJSON outputs the data like AdvertisementData does, or null if there is none
+func (a Advertisement) MarshalJSON() ([]byte, error) {
+	if a.AdvertisementData == nil {
+		return []byte("null"), nil
+	}
+	return a.AdvertisementData.MarshalJSON()
+}
+
+// UnmarshalJSON reconstructs the data like UnmarshalAdvertisementData does.
+// If the stored fields do not agree with the raw data, the data is loaded and a *MismatchError is returned.
+func (a *Advertisement) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		a.AdvertisementData = nil
+		return nil
+	}
+	d, err := UnmarshalAdvertisementData(b)
+	if d != nil {
+		a.AdvertisementData = d
+	}
+	return err
+}
+
+// Value implements driver.Valuer, storing the raw data as binary
+func (a Advertisement) Value() (driver.Value, error) {
+	if a.AdvertisementData == nil {
+		return nil, nil
+	}
+	return a.MarshalBinary()
+}
+
+// Scan implements sql.Scanner, loading binary or hex encoded raw data
+func (a *Advertisement) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		a.AdvertisementData = nil
+		return nil
+	case []byte:
+		// text columns may be returned as []byte too
+		err := a.UnmarshalBinary(v)
+		if err != nil && isHex(v) {
+			return a.UnmarshalText(v)
+		}
+		return err
+	case string:
+		return a.UnmarshalText([]byte(v))
+	}
+	return fmt.Errorf("Cannot scan %T into Advertisement", src)
+}
+
+// Value implements driver.Valuer, storing the raw data as hex encoded text
+func (a HexAdvertisement) Value() (driver.Value, error) {
+	if a.AdvertisementData == nil {
+		return nil, nil
+	}
+	b, err := a.MarshalText()
+	return string(b), err
+}
+
+func isHex(b []byte) bool {
+	if len(b) == 0 || len(b)%2 != 0 {
+		return false
+	}
+	for _, c := range b {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,242 @@
+package ruuvi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reading is AdvertisementData together with information about when, from whom and by whom it was received
+type Reading struct {
+	// Timestamp is the time the advertisement was received
+	Timestamp time.Time
+
+	// MAC is the BLE address of the broadcasting ruuvitag, as reported by the receiver.
+	// Outputs write it in canonical form, see Address.
+	MAC string
+
+	// AddressType is the type of the BLE address in MAC, AddressUnknown if the receiver did not report it
+	AddressType AddressType
+
+	// RSSI is the received signal strength with unit dBm
+	RSSI int
+
+	// Receiver identifies the scanner or gateway which received the advertisement, e.g. the MAC address of a gateway.
+	// Empty if not known.
+	Receiver string
+
+	// Data is the decoded advertisement
+	Data AdvertisementData
+
+	// Tag is user provided metadata of the broadcasting tag, nil if not known
+	Tag *TagInfo
+}
+
+// ID returns the identity of the broadcasting tag: the MAC address in the payload if the data format has one,
+// otherwise the BLE address. MAC addresses are returned in canonical form, see MAC.String.
+func (r Reading) ID() string {
+	if r.Data != nil {
+		if mac, err := r.Data.MACAddress(); err == nil {
+			return mac.String()
+		}
+	}
+	return r.Address()
+}
+
+// Address returns the BLE address in canonical form, see MAC.String,
+// or as reported if it is not a MAC address
+func (r Reading) Address() string {
+	if mac, err := ParseMAC(r.MAC); err == nil {
+		return mac.String()
+	}
+	return r.MAC
+}
+
+// MarshalJSON outputs the decoded data as JSON, like AdvertisementData does,
+// merged with "id", "timestamp", "address", "address-type", "rssi" and "receiver" of the reading,
+// and "name", "location" and "labels" of the tag. Empty receive metadata is left out.
+// Keys are sorted, like encoding/json sorts map keys.
+func (r Reading) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]json.RawMessage)
+	if r.Data != nil {
+		b, err := r.Data.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &fields); err != nil {
+			return nil, err
+		}
+	}
+	if r.Tag != nil {
+		b, err := json.Marshal(r.Tag)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &fields); err != nil {
+			return nil, err
+		}
+	}
+
+	set := func(key string, v interface{}) error {
+		b, err := json.Marshal(v)
+		fields[key] = b
+		return err
+	}
+	if err := set("id", r.ID()); err != nil {
+		return nil, err
+	}
+	if !r.Timestamp.IsZero() {
+		if err := set("timestamp", r.Timestamp.UTC()); err != nil {
+			return nil, err
+		}
+	}
+	if r.MAC != "" {
+		if err := set("address", r.Address()); err != nil {
+			return nil, err
+		}
+	}
+	if r.AddressType != AddressUnknown {
+		if err := set("address-type", r.AddressType); err != nil {
+			return nil, err
+		}
+	}
+	if err := set("rssi", r.RSSI); err != nil {
+		return nil, err
+	}
+	if r.Receiver != "" {
+		if err := set("receiver", r.Receiver); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// MarshalText outputs the reading as a single line of space separated key=value pairs,
+// with the receive metadata first and then the valid fields of the decoded data, e.g.
+//
+//	id=CB:B8:33:4C:88:4F timestamp=2021-03-31T09:31:31.5Z address=CB:B8:33:4C:88:4F rssi=-53 format=5 temperature=24.3 ...
+//
+// Values containing spaces, quotes or '=' are quoted.
+func (r Reading) MarshalText() ([]byte, error) {
+	var sb strings.Builder
+	pair := func(key, value string) {
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(key)
+		sb.WriteByte('=')
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		sb.WriteString(value)
+	}
+
+	pair("id", r.ID())
+	if !r.Timestamp.IsZero() {
+		pair("timestamp", r.Timestamp.UTC().Format(time.RFC3339Nano))
+	}
+	if r.MAC != "" {
+		pair("address", r.Address())
+	}
+	if r.AddressType != AddressUnknown {
+		pair("address-type", r.AddressType.String())
+	}
+	pair("rssi", strconv.Itoa(r.RSSI))
+	if r.Receiver != "" {
+		pair("receiver", r.Receiver)
+	}
+	if r.Tag != nil {
+		if r.Tag.Name != "" {
+			pair("name", r.Tag.Name)
+		}
+		if r.Tag.Location != "" {
+			pair("location", r.Tag.Location)
+		}
+		for _, k := range sortedKeys(r.Tag.Labels) {
+			pair(k, r.Tag.Labels[k])
+		}
+	}
+	if r.Data != nil {
+		m := MeasurementsOf(r.Data)
+		pair("format", strconv.Itoa(int(m.DataFormat)))
+		for _, f := range Fields() {
+			switch {
+			case !m.Valid.Has(f):
+			case f == FieldMACAddress:
+				pair(f.String(), m.MACAddress.String())
+			default:
+				// round away floating point noise from decoding
+				pair(f.String(), strconv.FormatFloat(math.Round(m.Value(f)*1e6)/1e6, 'f', -1, 64))
+			}
+		}
+	}
+	return []byte(sb.String()), nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// AddressType is the type of a BLE address
+type AddressType int
+
+const (
+	// AddressUnknown is used when the receiver does not report the address type
+	AddressUnknown AddressType = iota
+	// AddressPublic is a public device address
+	AddressPublic
+	// AddressRandom is a random device address. Ruuvitags use random static addresses.
+	AddressRandom
+)
+
+func (t AddressType) String() string {
+	switch t {
+	case AddressUnknown:
+		return "unknown"
+	case AddressPublic:
+		return "public"
+	case AddressRandom:
+		return "random"
+	}
+	return fmt.Sprintf("AddressType(%d)", int(t))
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (t AddressType) MarshalText() ([]byte, error) {
+	if t < AddressUnknown || t > AddressRandom {
+		return nil, fmt.Errorf("Invalid address type %d", int(t))
+	}
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (t *AddressType) UnmarshalText(text []byte) error {
+	for _, v := range []AddressType{AddressUnknown, AddressPublic, AddressRandom} {
+		if strings.EqualFold(string(text), v.String()) {
+			*t = v
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid address type %q", text)
+}
+
+// TagInfo is user provided metadata of a tag, e.g. from a registry of known tags
+type TagInfo struct {
+	// Name is a friendly name, e.g. "Freezer 2"
+	Name string `json:"name,omitempty"`
+
+	// Location describes where the tag is, e.g. "Kitchen"
+	Location string `json:"location,omitempty"`
+
+	// Labels are arbitrary key-value pairs
+	Labels map[string]string `json:"labels,omitempty"`
+}
@@ -4,8 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 
-	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/rawv1"
-	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/rawv2"
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/measurement"
 )
 
 const RUUVI_INNOVATIONS_LTD_TAG = 0x0499
@@ -48,7 +47,7 @@ type AdvertisementData interface {
 	MeasurementSequenceNumber() (int, error)
 
 	// MACAddress returns MAC address of broadcasting ruuvitag, if supported by data format
-	MACAddress() ([]byte, error)
+	MACAddress() (MAC, error)
 
 	// RawData returns the raw bytes. Make sure to copy the data, or it may be overwritten by the next broadcast.
 	RawData() []byte
@@ -64,17 +63,24 @@ type AdvertisementData interface {
 // ProcessAdvertisement processes the given bytes and returns AdvertisementData or error
 // error will be nil if AdvertisementData is valid (given data was valid and of a supported format)
 // error will be non-nil if given data was invalid or of an unsupported format.
+// Data formats are decoded by the decoders registered in DefaultFormats, see RegisterFormat.
+// ProcessAdvertisement does not panic on any input, and neither do the methods of the returned AdvertisementData of built-in formats.
 func ProcessAdvertisement(data []byte) (AdvertisementData, error) {
-	if !IsAdvertisementFromRuuviTag(data) {
-		return nil, newUnsupportedData("Data is not from Ruuvi Innovations Ltd product")
-	}
-	switch data[2] {
-	case 0x3:
-		return rawv1.NewDataRAWv1(data[2:])
-	case 0x5:
-		return rawv2.NewDataRAWv2(data[2:])
-	}
-	return nil, newUnsupportedData("Package does not support this data format (yet)")
+	return DefaultFormats.Process(data)
+}
+
+// ProcessPayload decodes payload, which starts with the data format byte without the Ruuvi Innovations Ltd company ID
+// before it, like RawData returns it. RuuviTag firmware sends data in this form in GATT notifications when connected.
+// Data formats are decoded by the decoders registered in DefaultFormats, like ProcessAdvertisement does.
+func ProcessPayload(payload []byte) (AdvertisementData, error) {
+	return DefaultFormats.ProcessPayload(payload)
+}
+
+// ProcessAuto decodes data which is either manufacturer data, like ProcessAdvertisement takes,
+// or a payload without the company ID, like ProcessPayload takes, detecting which one it is.
+// See FormatRegistry.ProcessAuto for how, and when the two cannot be told apart.
+func ProcessAuto(data []byte) (AdvertisementData, error) {
+	return DefaultFormats.ProcessAuto(data)
 }
 
 func IsAdvertisementFromRuuviTag(data []byte) bool {
@@ -84,6 +90,16 @@ func IsAdvertisementFromRuuviTag(data []byte) bool {
 	return binary.LittleEndian.Uint16(data[0:2]) == RUUVI_INNOVATIONS_LTD_TAG
 }
 
+var (
+	// ErrUnsupportedField is wrapped by errors returned from AdvertisementData methods
+	// when the data format does not contain the requested field
+	ErrUnsupportedField = measurement.ErrUnsupported
+
+	// ErrInvalidValue is wrapped by errors returned from AdvertisementData methods
+	// when the tag reported the requested field as invalid
+	ErrInvalidValue = measurement.ErrInvalid
+)
+
 // UnsupportedData is an error returned when package does not know how to handle given data
 type UnsupportedData struct {
 	description string
@@ -0,0 +1,717 @@
+package ruuvi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var (
+	testRAWv2 = []byte{
+		0x99, 0x04,
+		0x05, 0x12, 0xFC, 0x53, 0x94, 0xC3, 0x7C, 0x00,
+		0x04, 0xFF, 0xFC, 0x04, 0x0C, 0xAC, 0x36, 0x42,
+		0x00, 0xCD, 0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F,
+	}
+	testRAWv2Invalid = []byte{
+		0x99, 0x04,
+		0x05, 0x80, 0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0x80,
+		0x00, 0x80, 0x00, 0x80, 0x00, 0xFF, 0xFF, 0xFF,
+		0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+	}
+	testRAWv1 = []byte{
+		0x99, 0x04,
+		0x03, 0x29, 0x1A, 0x1E, 0xCE, 0x1E, 0xFC,
+		0x18, 0xF9, 0x42, 0x02, 0xCA, 0x0B, 0x53,
+	}
+)
+
+func TestDecode(t *testing.T) {
+	for name, b := range map[string][]byte{"rawv2": testRAWv2, "rawv2 invalid": testRAWv2Invalid, "rawv1": testRAWv1} {
+		t.Run(name, func(t *testing.T) {
+			data, err := ProcessAdvertisement(b)
+			if err != nil {
+				t.Fatal("ProcessAdvertisement() returned error:", err)
+			}
+			expectedJSON, err := data.MarshalJSON()
+			if err != nil {
+				t.Fatal("MarshalJSON() returned error:", err)
+			}
+
+			buf := append([]byte{}, b...)
+			var d Decoded
+			if err := Decode(buf, &d); err != nil {
+				t.Fatal("Decode() returned error:", err)
+			}
+			// decoded value must not refer to the input
+			for i := range buf {
+				buf[i] = 0
+			}
+
+			if d.DataFormat != data.DataFormat() {
+				t.Error("Wrong data format:", d.DataFormat)
+			}
+			if v, err := data.Temperature(); (err == nil) != d.Valid.Has(FieldTemperature) || v != d.Temperature {
+				t.Error("Temperature differs:", v, err, d.Temperature)
+			}
+			if v, err := data.Pressure(); (err == nil) != d.Valid.Has(FieldPressure) || v != d.Pressure {
+				t.Error("Pressure differs:", v, err, d.Pressure)
+			}
+			if v, err := data.MeasurementSequenceNumber(); (err == nil) != d.Valid.Has(FieldMeasurementSequenceNumber) || v != d.MeasurementSequenceNumber {
+				t.Error("Measurement sequence number differs:", v, err, d.MeasurementSequenceNumber)
+			}
+			if v, err := data.MACAddress(); (err == nil) != d.Valid.Has(FieldMACAddress) || v != d.MACAddress {
+				t.Error("MAC address differs:", v, err, d.MACAddress)
+			}
+			if diff := cmp.Diff(b[2:], d.RawData()); diff != "" {
+				t.Error("Raw data differs (-want +got):\n", diff)
+			}
+			if diff := cmp.Diff(string(expectedJSON), string(d.AppendJSON(nil))); diff != "" {
+				t.Error("JSON differs (-want +got):\n", diff)
+			}
+		})
+	}
+}
+
+func TestDecodeTrailingBytes(t *testing.T) {
+	b := append(append([]byte{}, testRAWv2...), 0xAB, 0xCD)
+	data, err := ProcessAdvertisement(b)
+	if err != nil {
+		t.Fatal("ProcessAdvertisement() returned error:", err)
+	}
+	if diff := cmp.Diff(b[2:], data.RawData()); diff != "" {
+		t.Error("Trailing bytes not kept by ProcessAdvertisement (-want +got):\n", diff)
+	}
+
+	var d Decoded
+	if err := Decode(b, &d); err != nil {
+		t.Fatal("Decode() returned error:", err)
+	}
+	if diff := cmp.Diff(testRAWv2[2:], d.RawData()); diff != "" {
+		t.Error("Trailing bytes kept by Decode (-want +got):\n", diff)
+	}
+	withoutTrailing, err := ProcessAdvertisement(testRAWv2)
+	if err != nil {
+		t.Fatal("ProcessAdvertisement() returned error:", err)
+	}
+	expectedJSON, err := withoutTrailing.MarshalJSON()
+	if err != nil {
+		t.Fatal("MarshalJSON() returned error:", err)
+	}
+	if diff := cmp.Diff(string(expectedJSON), string(d.AppendJSON(nil))); diff != "" {
+		t.Error("JSON differs from data without trailing bytes (-want +got):\n", diff)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for name, b := range map[string][]byte{
+		"empty":          {},
+		"other company":  {0x4C, 0x00, 0x05},
+		"company only":   {0x99},
+		"no format":      {0x99, 0x04},
+		"unknown format": {0x99, 0x04, 0x02, 0x00},
+		"short rawv2":    testRAWv2[:10],
+		"short rawv1":    testRAWv1[:10],
+	} {
+		if data, err := ProcessAdvertisement(b); err == nil || data != nil {
+			t.Errorf("%s: expected only error from ProcessAdvertisement(), got %v, %v", name, data, err)
+		}
+		d := Decoded{Measurements: Measurements{DataFormat: 5, Valid: FieldTemperature}}
+		if err := Decode(b, &d); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+		if d != (Decoded{}) {
+			t.Errorf("%s: expected zeroed result on error, got %+v", name, d)
+		}
+	}
+}
+
+// testFormatData is AdvertisementData of a private data format, only DataFormat and RawData are implemented
+type testFormatData struct {
+	AdvertisementData
+	raw []byte
+}
+
+func (d testFormatData) DataFormat() int8 { return int8(d.raw[0]) }
+func (d testFormatData) RawData() []byte  { return d.raw }
+
+func decodeTestFormat(payload []byte) (AdvertisementData, error) {
+	return testFormatData{raw: payload}, nil
+}
+
+func TestFormatRegistry(t *testing.T) {
+	r := NewFormatRegistry()
+	if err := r.Register(0xC0, decodeTestFormat); err != nil {
+		t.Fatal("Register() returned error:", err)
+	}
+	if err := r.RegisterCompany(0x0059, 0x01, decodeTestFormat); err != nil {
+		t.Fatal("RegisterCompany() returned error:", err)
+	}
+
+	if err := r.Register(0xC0, decodeTestFormat); !errors.Is(err, ErrFormatRegistered) {
+		t.Error("Expected ErrFormatRegistered for duplicate, got", err)
+	}
+	if err := r.Register(0xC1, nil); err == nil {
+		t.Error("Expected error for nil decoder")
+	}
+
+	expected := []Format{{CompanyID: 0x0059, DataFormat: 0x01}, {CompanyID: RUUVI_INNOVATIONS_LTD_TAG, DataFormat: 0xC0}}
+	if diff := cmp.Diff(expected, r.Formats()); diff != "" {
+		t.Error("Unexpected formats:", diff)
+	}
+
+	for name, tt := range map[string]struct {
+		data   []byte
+		format int8
+	}{
+		"ruuvi private format": {data: []byte{0x99, 0x04, 0xC0, 0x01}, format: -64},
+		"other company":        {data: []byte{0x59, 0x00, 0x01, 0x02}, format: 1},
+	} {
+		d, err := r.Process(tt.data)
+		if err != nil {
+			t.Errorf("%s: Process() returned error: %v", name, err)
+			continue
+		}
+		if d.DataFormat() != tt.format || !bytes.Equal(d.RawData(), tt.data[2:]) {
+			t.Errorf("%s: decoded to format %d with data %x", name, d.DataFormat(), d.RawData())
+		}
+	}
+
+	for name, data := range map[string][]byte{
+		"builtin not registered": testRAWv2,
+		"unknown company":        {0x4C, 0x00, 0xC0},
+		"unknown format":         {0x59, 0x00, 0x02},
+		"no format":              {0x59, 0x00},
+	} {
+		if d, err := r.Process(data); err == nil {
+			t.Errorf("%s: expected error, got %v", name, d)
+		}
+	}
+}
+
+func TestDefaultFormats(t *testing.T) {
+	expected := []Format{{CompanyID: RUUVI_INNOVATIONS_LTD_TAG, DataFormat: 3}, {CompanyID: RUUVI_INNOVATIONS_LTD_TAG, DataFormat: 5}}
+	if diff := cmp.Diff(expected, DefaultFormats.Formats()); diff != "" {
+		t.Error("Unexpected default formats:", diff)
+	}
+	if err := RegisterFormat(5, decodeTestFormat); !errors.Is(err, ErrFormatRegistered) {
+		t.Error("Expected ErrFormatRegistered when replacing built-in format, got", err)
+	}
+}
+
+func TestProcessPayload(t *testing.T) {
+	for name, b := range map[string][]byte{"rawv2": testRAWv2, "rawv1": testRAWv1, "rawv2 invalid": testRAWv2Invalid} {
+		expected, err := ProcessAdvertisement(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for form, process := range map[string]func() (AdvertisementData, error){
+			"payload":                     func() (AdvertisementData, error) { return ProcessPayload(b[2:]) },
+			"auto with manufacturer data": func() (AdvertisementData, error) { return ProcessAuto(b) },
+			"auto with payload":           func() (AdvertisementData, error) { return ProcessAuto(b[2:]) },
+		} {
+			d, err := process()
+			if err != nil {
+				t.Fatalf("%s %s: %v", name, form, err)
+			}
+			if diff := cmp.Diff(MeasurementsOf(expected), MeasurementsOf(d)); diff != "" {
+				t.Errorf("%s %s: %s", name, form, diff)
+			}
+			if !bytes.Equal(b[2:], d.RawData()) {
+				t.Errorf("%s %s: expected raw data % X, got % X", name, form, b[2:], d.RawData())
+			}
+		}
+
+		var decoded Decoded
+		if err := DecodePayload(b[2:], &decoded); err != nil {
+			t.Fatalf("%s DecodePayload: %v", name, err)
+		}
+		if diff := cmp.Diff(MeasurementsOf(expected), decoded.Measurements); diff != "" {
+			t.Errorf("%s DecodePayload: %s", name, diff)
+		}
+		if allocs := testing.AllocsPerRun(100, func() { _ = DecodePayload(b[2:], &decoded) }); allocs != 0 {
+			t.Errorf("%s: DecodePayload allocated %v times per run", name, allocs)
+		}
+	}
+
+	for name, b := range map[string][]byte{
+		"empty":          {},
+		"unknown format": {0x04, 0x01, 0x02},
+		"short":          testRAWv2[2:10],
+		"company ID":     testRAWv2,
+	} {
+		if d, err := ProcessPayload(b); err == nil || d != nil {
+			t.Errorf("ProcessPayload %s: expected error, got %v, %v", name, d, err)
+		}
+		var decoded Decoded
+		if err := DecodePayload(b, &decoded); err == nil {
+			t.Errorf("DecodePayload %s: expected error", name)
+		}
+	}
+	for name, b := range map[string][]byte{
+		"empty":          {},
+		"unknown format": {0x04, 0x01, 0x02},
+		"short":          testRAWv2[2:10],
+		"other company":  {0x59, 0x00, 0x01},
+		// company IDs 0x0105 and 0x0003 start like RAWv2 and RAWv1 payloads
+		"other company starting with 0x05": append([]byte{0x05, 0x01}, testRAWv2[2:]...),
+		"other company starting with 0x03": append([]byte{0x03, 0x00}, testRAWv1[2:]...),
+	} {
+		if d, err := ProcessAuto(b); err == nil || d != nil {
+			t.Errorf("ProcessAuto %s: expected error, got %v, %v", name, d, err)
+		}
+	}
+
+	// manufacturer data of other registered companies is detected too
+	r := NewFormatRegistry()
+	if err := r.RegisterCompany(0x0059, 0x01, decodeTestFormat); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(0x05, decodeRAWv2); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := r.ProcessAuto([]byte{0x59, 0x00, 0x01, 0x02}); err != nil || d.DataFormat() != 0x01 {
+		t.Errorf("expected other company data format, got %v, %v", d, err)
+	}
+	if d, err := r.ProcessAuto(testRAWv2[2:]); err != nil || d.DataFormat() != 5 {
+		t.Errorf("expected RAWv2 payload, got %v, %v", d, err)
+	}
+
+	// registered company IDs take precedence over payloads they look like
+	if err := r.RegisterCompany(0x0105, 0x12, decodeTestFormat); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := r.ProcessAuto(append([]byte{0x05, 0x01, 0x12}, testRAWv2[5:]...)); err != nil || d.DataFormat() != 0x12 {
+		t.Errorf("expected data format of company 0x0105, got %v, %v", d, err)
+	}
+}
+
+func TestFormatRegistryConcurrent(t *testing.T) {
+	r := NewFormatRegistry()
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(format byte) {
+			defer wg.Done()
+			if err := r.Register(format, decodeTestFormat); err != nil {
+				t.Error(err)
+			}
+			for j := 0; j < 100; j++ {
+				if _, err := r.Process([]byte{0x99, 0x04, format}); err != nil {
+					t.Error(err)
+					return
+				}
+				_ = r.Formats()
+			}
+		}(byte(0xE0 + i))
+	}
+	wg.Wait()
+
+	if n := len(r.Formats()); n != 16 {
+		t.Errorf("Expected 16 formats, got %d", n)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	for name, b := range map[string][]byte{"rawv2": testRAWv2, "rawv1": testRAWv1} {
+		d, err := ProcessAdvertisement(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, ok := CapabilitiesOf(d)
+		if !ok {
+			t.Fatalf("%s: no capabilities", name)
+		}
+		if f, _ := FormatCapabilities(d.DataFormat()); !cmp.Equal(c, f) {
+			t.Errorf("%s: CapabilitiesOf() and FormatCapabilities() differ", name)
+		}
+
+		// supported fields must decode without ErrUnsupportedField, and unsupported fields must return it
+		m := MeasurementsOf(d)
+		for _, f := range Fields() {
+			if c.Supports(f) != m.Valid.Has(f) {
+				t.Errorf("%s: %v supported %v, but decoded valid %v", name, f, c.Supports(f), m.Valid.Has(f))
+			}
+		}
+	}
+
+	c, _ := FormatCapabilities(5)
+	info, ok := c.Info(FieldTemperature)
+	expected := FieldInfo{Field: FieldTemperature, Name: "temperature", Label: "Temperature", Unit: "°C", Resolution: 0.005, Min: -163.835, Max: 163.835}
+	if !ok || info != expected {
+		t.Errorf("Unexpected temperature info %+v", info)
+	}
+	// callers get their own copy of the field metadata
+	c.Fields[0].Max = 0
+	if c, _ := FormatCapabilities(5); c.Fields[0].Max != 163.835 {
+		t.Error("Modifying returned capabilities changed those of the data format")
+	}
+	d, _ := ProcessAdvertisement(testRAWv2)
+	c, _ = CapabilitiesOf(d)
+	c.Fields[0].Max = 0
+	if c, _ := CapabilitiesOf(d); c.Fields[0].Max != 163.835 {
+		t.Error("Modifying returned capabilities changed those of the data")
+	}
+	if _, ok := FormatCapabilities(2); ok {
+		t.Error("Expected no capabilities for unsupported data format")
+	}
+}
+
+func TestDecodeDoesNotAllocate(t *testing.T) {
+	var d Decoded
+	buf := make([]byte, 0, 512)
+	for name, b := range map[string][]byte{"rawv2": testRAWv2, "rawv1": testRAWv1} {
+		allocs := testing.AllocsPerRun(100, func() {
+			if err := Decode(b, &d); err != nil {
+				t.Fatal("Decode() returned error:", err)
+			}
+			buf = d.AppendJSON(buf[:0])
+		})
+		if allocs != 0 {
+			t.Errorf("%s: Decode and AppendJSON allocated %v times per run", name, allocs)
+		}
+	}
+}
+
+func benchmarkFormats(b *testing.B, f func(b *testing.B, data []byte)) {
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{"RAWv1", testRAWv1},
+		{"RAWv2", testRAWv2},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			f(b, tc.data)
+		})
+	}
+}
+
+func BenchmarkProcessAdvertisement(b *testing.B) {
+	benchmarkFormats(b, func(b *testing.B, data []byte) {
+		for i := 0; i < b.N; i++ {
+			d, err := ProcessAdvertisement(data)
+			if err != nil {
+				b.Fatal(err)
+			}
+			d.Copy()
+		}
+	})
+}
+
+func BenchmarkDecode(b *testing.B) {
+	benchmarkFormats(b, func(b *testing.B, data []byte) {
+		var d Decoded
+		for i := 0; i < b.N; i++ {
+			if err := Decode(data, &d); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkMarshalJSON(b *testing.B) {
+	benchmarkFormats(b, func(b *testing.B, data []byte) {
+		d, err := ProcessAdvertisement(data)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := d.MarshalJSON(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkAppendJSON(b *testing.B) {
+	benchmarkFormats(b, func(b *testing.B, data []byte) {
+		var d Decoded
+		if err := Decode(data, &d); err != nil {
+			b.Fatal(err)
+		}
+		buf := make([]byte, 0, 512)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			buf = d.AppendJSON(buf[:0])
+		}
+	})
+}
+
+func TestReadingID(t *testing.T) {
+	rawv2, _ := ProcessAdvertisement(testRAWv2)
+	rawv1, _ := ProcessAdvertisement(testRAWv1)
+	for _, tt := range []struct {
+		reading  Reading
+		expected string
+	}{
+		{Reading{MAC: "d1:2a:3b:4c:5d:6e", Data: rawv2}, "CB:B8:33:4C:88:4F"},
+		{Reading{MAC: "d1:2a:3b:4c:5d:6e", Data: rawv1}, "D1:2A:3B:4C:5D:6E"},
+		{Reading{MAC: "d1:2a:3b:4c:5d:6e"}, "D1:2A:3B:4C:5D:6E"},
+		{Reading{MAC: "hci0/dev_1"}, "hci0/dev_1"},
+	} {
+		if id := tt.reading.ID(); id != tt.expected {
+			t.Errorf("ID() of %v = %q, expected %q", tt.reading.MAC, id, tt.expected)
+		}
+	}
+}
+
+func TestReadingMarshal(t *testing.T) {
+	rawv1, _ := ProcessAdvertisement(testRAWv1)
+	r := Reading{
+		Timestamp:   time.Date(2021, 3, 31, 9, 31, 31, 500000000, time.UTC),
+		MAC:         "D1:2A:3B:4C:5D:6E",
+		AddressType: AddressRandom,
+		RSSI:        -70,
+		Receiver:    "gw 1",
+		Data:        rawv1,
+		Tag:         &TagInfo{Name: "Sauna", Labels: map[string]string{"floor": "1"}},
+	}
+
+	b, err := r.MarshalJSON()
+	if err != nil {
+		t.Fatal("MarshalJSON() returned error:", err)
+	}
+	expected := `{"accel-x":-1,"accel-y":-1.726,"accel-z":0.714,"address":"D1:2A:3B:4C:5D:6E","address-type":"random",` +
+		`"format":3,"humidity":20.5,"id":"D1:2A:3B:4C:5D:6E","labels":{"floor":"1"},"name":"Sauna","pressure":102766,` +
+		`"raw":"03291a1ece1efc18f94202ca0b53","receiver":"gw 1","rssi":-70,"temperature":26.3,` +
+		`"timestamp":"2021-03-31T09:31:31.5Z","voltage":2.899}`
+	if diff := cmp.Diff(expected, string(b)); diff != "" {
+		t.Error("Unexpected JSON:", diff)
+	}
+
+	b, err = r.MarshalText()
+	if err != nil {
+		t.Fatal("MarshalText() returned error:", err)
+	}
+	expected = `id=D1:2A:3B:4C:5D:6E timestamp=2021-03-31T09:31:31.5Z address=D1:2A:3B:4C:5D:6E address-type=random ` +
+		`rssi=-70 receiver="gw 1" name=Sauna floor=1 format=3 temperature=26.3 humidity=20.5 pressure=102766 ` +
+		`accel-x=-1 accel-y=-1.726 accel-z=0.714 voltage=2.899`
+	if diff := cmp.Diff(expected, string(b)); diff != "" {
+		t.Error("Unexpected text:", diff)
+	}
+
+	// receive metadata only, address in canonical form
+	b, err = Reading{MAC: "d1:2a:3b:4c:5d:6e", RSSI: -70}.MarshalJSON()
+	if err != nil || string(b) != `{"address":"D1:2A:3B:4C:5D:6E","id":"D1:2A:3B:4C:5D:6E","rssi":-70}` {
+		t.Errorf("Unexpected JSON without data: %s, %v", b, err)
+	}
+}
+
+func TestAddressType(t *testing.T) {
+	for _, a := range []AddressType{AddressUnknown, AddressPublic, AddressRandom} {
+		b, err := a.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var u AddressType
+		if err := u.UnmarshalText(b); err != nil || u != a {
+			t.Errorf("Round trip of %v gave %v, %v", a, u, err)
+		}
+	}
+	var u AddressType
+	if err := u.UnmarshalText([]byte("static")); err == nil {
+		t.Error("Expected error for unknown address type")
+	}
+	if _, err := AddressType(7).MarshalText(); err == nil {
+		t.Error("Expected error for invalid address type")
+	}
+}
+
+func TestUnmarshalAdvertisementData(t *testing.T) {
+	for name, b := range map[string][]byte{"rawv2": testRAWv2, "rawv2 invalid": testRAWv2Invalid, "rawv1": testRAWv1} {
+		d, _ := ProcessAdvertisement(b)
+		stored, _ := d.MarshalJSON()
+		u, err := UnmarshalAdvertisementData(stored)
+		if err != nil {
+			t.Errorf("%s: UnmarshalAdvertisementData() returned error: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(u.RawData(), d.RawData()) {
+			t.Errorf("%s: reconstructed %x, expected %x", name, u.RawData(), d.RawData())
+		}
+	}
+
+	// written by earlier versions, with MAC address without padding
+	old := `{"accel-x":0.004,"accel-y":-0.004,"accel-z":1.036,"format":5,"humidity":53.49,"mac":"cb:b8:33:4c:88:4f",` +
+		`"meas-seq":205,"movement-count":66,"pressure":100044,"raw":"0512fc5394c37c0004fffc040cac364200cdcbb8334c884f",` +
+		`"temperature":24.3,"tx-power":4,"voltage":2.977}`
+	if _, err := UnmarshalAdvertisementData([]byte(old)); err != nil {
+		t.Error("Unexpected error for JSON of earlier version:", err)
+	}
+
+	tampered := strings.Replace(strings.Replace(old, `"temperature":24.3`, `"temperature":25`, 1), `"tx-power":4,`, "", 1)
+	d, err := UnmarshalAdvertisementData([]byte(tampered))
+	var mismatch *MismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatal("Expected MismatchError, got", err)
+	}
+	expected := []Mismatch{
+		{Field: "temperature", Stored: "25", Decoded: "24.3"},
+		{Field: "tx-power", Decoded: "4"},
+	}
+	if diff := cmp.Diff(expected, mismatch.Mismatches); diff != "" {
+		t.Error("Unexpected mismatches:", diff)
+	}
+	if v, _ := d.Temperature(); v != 24.3 {
+		t.Error("Expected data reconstructed from raw data, got temperature", v)
+	}
+
+	for name, s := range map[string]string{
+		"not json":    `{`,
+		"no raw":      `{"format":5}`,
+		"invalid hex": `{"raw":"05zz"}`,
+		"too short":   `{"raw":"0512"}`,
+	} {
+		if _, err := UnmarshalAdvertisementData([]byte(s)); err == nil || errors.As(err, &mismatch) {
+			t.Errorf("%s: expected decoding error, got %v", name, err)
+		}
+	}
+}
+
+func TestReadingUnmarshalJSON(t *testing.T) {
+	rawv1, _ := ProcessAdvertisement(testRAWv1)
+	r := Reading{
+		Timestamp:   time.Date(2021, 3, 31, 9, 31, 31, 500000000, time.UTC),
+		MAC:         "D1:2A:3B:4C:5D:6E",
+		AddressType: AddressRandom,
+		RSSI:        -70,
+		Receiver:    "gw1",
+		Data:        rawv1,
+		Tag:         &TagInfo{Name: "Sauna", Labels: map[string]string{"floor": "1"}},
+	}
+	b, _ := json.Marshal(r)
+
+	var u Reading
+	if err := json.Unmarshal(b, &u); err != nil {
+		t.Fatal("Unmarshal returned error:", err)
+	}
+	if diff := cmp.Diff(r, u, cmp.Comparer(func(a, b AdvertisementData) bool { return bytes.Equal(a.RawData(), b.RawData()) })); diff != "" {
+		t.Error("Reading differs after round trip:", diff)
+	}
+
+	// RAWv1 has no MAC in the payload, so the stored id must match the address
+	tampered := strings.Replace(string(b), `"id":"D1:2A:3B:4C:5D:6E"`, `"id":"CB:B8:33:4C:88:4F"`, 1)
+	var mismatch *MismatchError
+	if err := json.Unmarshal([]byte(tampered), &u); !errors.As(err, &mismatch) || mismatch.Mismatches[0].Field != "id" {
+		t.Error("Expected id mismatch, got", err)
+	}
+	if u.MAC != r.MAC || u.Data == nil {
+		t.Error("Expected reading filled in despite mismatch")
+	}
+
+	// receive metadata only, address in canonical form
+	if err := json.Unmarshal([]byte(`{"address":"D1:2A:3B:4C:5D:6E","rssi":-70}`), &u); err != nil || u.Data != nil || u.RSSI != -70 {
+		t.Errorf("Unexpected reading %+v, %v", u, err)
+	}
+	if err := json.Unmarshal([]byte(`{"address-type":"static"}`), &u); err == nil {
+		t.Error("Expected error for invalid address type")
+	}
+}
+
+func TestAdvertisementMarshal(t *testing.T) {
+	d, _ := ProcessAdvertisement(testRAWv2)
+	a := Advertisement{d}
+	raw := testRAWv2[2:]
+
+	b, err := a.MarshalBinary()
+	if err != nil || !bytes.Equal(b, raw) {
+		t.Fatalf("MarshalBinary() = %x, %v", b, err)
+	}
+	text, err := a.MarshalText()
+	if err != nil || string(text) != "0512fc5394c37c0004fffc040cac364200cdcbb8334c884f" {
+		t.Fatalf("MarshalText() = %s, %v", text, err)
+	}
+	v, err := HexAdvertisement{a}.Value()
+	if err != nil || v != string(text) {
+		t.Fatalf("Value() of HexAdvertisement = %v, %v", v, err)
+	}
+	js, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal("json.Marshal() returned error:", err)
+	}
+
+	for name, load := range map[string]func(*Advertisement) error{
+		"binary":        func(u *Advertisement) error { return u.UnmarshalBinary(b) },
+		"text":          func(u *Advertisement) error { return u.UnmarshalText(text) },
+		"json":          func(u *Advertisement) error { return json.Unmarshal(js, u) },
+		"sql binary":    func(u *Advertisement) error { return u.Scan(b) },
+		"sql text":      func(u *Advertisement) error { return u.Scan(string(text)) },
+		"sql hex bytes": func(u *Advertisement) error { return u.Scan(text) },
+	} {
+		var u Advertisement
+		if err := load(&u); err != nil {
+			t.Errorf("%s: loading returned error: %v", name, err)
+			continue
+		}
+		if u.DataFormat() != 5 || !bytes.Equal(u.RawData(), raw) {
+			t.Errorf("%s: loaded %x", name, u.RawData())
+		}
+	}
+
+	// loaded data must not refer to the input
+	var u Advertisement
+	input := append([]byte(nil), raw...)
+	if err := u.UnmarshalBinary(input); err != nil {
+		t.Fatal(err)
+	}
+	input[1] = 0
+	if v, _ := u.Temperature(); v != 24.3 {
+		t.Error("Loaded data changed with input, temperature", v)
+	}
+
+	// NULL
+	if v, err := (Advertisement{}).Value(); v != nil || err != nil {
+		t.Errorf("Expected NULL for no data, got %v, %v", v, err)
+	}
+	if err := u.Scan(nil); err != nil || u.AdvertisementData != nil {
+		t.Errorf("Expected no data after scanning NULL, got %v, %v", u.AdvertisementData, err)
+	}
+	if js, err := json.Marshal(Advertisement{}); err != nil || string(js) != "null" {
+		t.Errorf("Expected null JSON for no data, got %s, %v", js, err)
+	}
+	if _, err := (Advertisement{}).MarshalBinary(); err == nil {
+		t.Error("Expected error marshalling no data")
+	}
+
+	for name, load := range map[string]func(*Advertisement) error{
+		"unsupported format": func(u *Advertisement) error { return u.UnmarshalBinary([]byte{0x02, 0x00}) },
+		"invalid hex":        func(u *Advertisement) error { return u.UnmarshalText([]byte("05zz")) },
+		"too short":          func(u *Advertisement) error { return u.Scan(raw[:10]) },
+		"wrong type":         func(u *Advertisement) error { return u.Scan(42) },
+	} {
+		if err := load(&Advertisement{}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestScanIntoProcessedAdvertisement(t *testing.T) {
+	text := "0512fc5394c37c0004fffc040cac364200cdcbb8334c884f"
+	for name, src := range map[string]interface{}{
+		"hex string": text,
+		"hex bytes":  []byte(text),
+	} {
+		// the scanned data decides the data format, not the data held before
+		d, err := ProcessAdvertisement(testRAWv1)
+		if err != nil {
+			t.Fatal("ProcessAdvertisement() returned error:", err)
+		}
+		a := Advertisement{d}
+		if err := a.Scan(src); err != nil {
+			t.Errorf("%s: Scan() returned error: %v", name, err)
+			continue
+		}
+		if a.DataFormat() != 5 || !bytes.Equal(a.RawData(), testRAWv2[2:]) {
+			t.Errorf("%s: scanned %x", name, a.RawData())
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package ruuvi
+
+import "context"
+
+// Source produces Readings, e.g. a live BLE scanner or a replayed recording.
+// Downstream code should only depend on this interface, so that sources are interchangeable.
+type Source interface {
+	// Run sends readings to out until ctx is cancelled or the source is exhausted.
+	// Run returns nil when stopped by ctx or exhausted. out is not closed by Run.
+	Run(ctx context.Context, out chan<- Reading) error
+}
@@ -0,0 +1,207 @@
+package ruuvi
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Mismatch is a field stored in JSON which does not agree with the value decoded from the stored raw data
+type Mismatch struct {
+	// Field is the JSON key of the field
+	Field string
+	// Stored is the stored JSON value, empty if the field was not stored
+	Stored string
+	// Decoded is the JSON value decoded from the raw data, empty if the raw data does not have the field
+	Decoded string
+}
+
+func (m Mismatch) String() string {
+	stored, decoded := m.Stored, m.Decoded
+	if stored == "" {
+		stored = "nothing"
+	}
+	if decoded == "" {
+		decoded = "nothing"
+	}
+	return fmt.Sprintf("%s: stored %s, decoded %s", m.Field, stored, decoded)
+}
+
+// MismatchError is returned when reconstructed data does not agree with the stored fields.
+// The data is reconstructed anyway, from the raw bytes.
+type MismatchError struct {
+	Mismatches []Mismatch
+}
+
+func (e *MismatchError) Error() string {
+	s := make([]string, len(e.Mismatches))
+	for i, m := range e.Mismatches {
+		s[i] = m.String()
+	}
+	return "Stored fields do not match raw data: " + strings.Join(s, "; ")
+}
+
+// UnmarshalAdvertisementData reconstructs AdvertisementData from JSON produced by its MarshalJSON,
+// or by Reading.MarshalJSON, by decoding the stored "raw" data again.
+// The stored fields are compared with the decoded ones, and if they do not agree, the reconstructed data
+// is returned with a *MismatchError listing the differences. MAC addresses in the unpadded form
+// written by earlier versions are accepted.
+func UnmarshalAdvertisementData(b []byte) (AdvertisementData, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	return reconstruct(fields)
+}
+
+// reconstruct decodes the raw data in fields and compares the result with the other stored fields
+func reconstruct(fields map[string]json.RawMessage) (AdvertisementData, error) {
+	stored, ok := fields["raw"]
+	if !ok {
+		return nil, errors.New("No raw data stored")
+	}
+	var rawHex string
+	if err := json.Unmarshal(stored, &rawHex); err != nil {
+		return nil, fmt.Errorf("Invalid raw data: %w", err)
+	}
+	raw, err := hex.DecodeString(rawHex)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid raw data: %w", err)
+	}
+
+	data := make([]byte, 2, 2+len(raw))
+	data[0], data[1] = 0x99, 0x04
+	d, err := ProcessAdvertisement(append(data, raw...))
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := d.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var decoded map[string]json.RawMessage
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return nil, err
+	}
+
+	var mismatches []Mismatch
+	keys := []string{"format"}
+	for _, f := range Fields() {
+		keys = append(keys, f.String())
+	}
+	for _, k := range keys {
+		s, sok := fields[k]
+		v, dok := decoded[k]
+		if !sok && !dok {
+			continue
+		}
+		if sok != dok || !sameValue(k, s, v) {
+			mismatches = append(mismatches, Mismatch{Field: k, Stored: string(s), Decoded: string(v)})
+		}
+	}
+	if len(mismatches) > 0 {
+		return d, &MismatchError{Mismatches: mismatches}
+	}
+	return d, nil
+}
+
+// sameValue reports whether stored and decoded JSON values of field key agree
+func sameValue(key string, stored, decoded json.RawMessage) bool {
+	if key == FieldMACAddress.String() {
+		var s, d string
+		if json.Unmarshal(stored, &s) != nil || json.Unmarshal(decoded, &d) != nil {
+			return false
+		}
+		sm, err := ParseMAC(s)
+		if err != nil {
+			return false
+		}
+		dm, err := ParseMAC(d)
+		return err == nil && sm == dm
+	}
+
+	var s, d float64
+	if json.Unmarshal(stored, &s) != nil || json.Unmarshal(decoded, &d) != nil {
+		return false
+	}
+	// allow for rounding by tools which have processed the stored JSON
+	return math.Abs(s-d) <= 1e-9*math.Max(1, math.Abs(d))
+}
+
+// UnmarshalJSON reconstructs a reading from JSON produced by MarshalJSON.
+// Data is reconstructed like UnmarshalAdvertisementData does, if raw data is stored.
+// If the stored fields, including "id", do not agree with the decoded data,
+// r is filled in anyway and a *MismatchError is returned.
+func (r *Reading) UnmarshalJSON(b []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+
+	var (
+		reading Reading
+		tag     TagInfo
+	)
+	for key, dst := range map[string]interface{}{
+		"timestamp":    &reading.Timestamp,
+		"address":      &reading.MAC,
+		"address-type": &reading.AddressType,
+		"rssi":         &reading.RSSI,
+		"receiver":     &reading.Receiver,
+		"name":         &tag.Name,
+		"location":     &tag.Location,
+		"labels":       &tag.Labels,
+	} {
+		if v, ok := fields[key]; ok {
+			if err := json.Unmarshal(v, dst); err != nil {
+				return fmt.Errorf("Invalid %s: %w", key, err)
+			}
+		}
+	}
+	if tag.Name != "" || tag.Location != "" || len(tag.Labels) > 0 {
+		reading.Tag = &tag
+	}
+
+	var mismatch *MismatchError
+	if _, ok := fields["raw"]; ok {
+		d, err := reconstruct(fields)
+		if err != nil && !errors.As(err, &mismatch) {
+			return err
+		}
+		reading.Data = d
+	}
+
+	if v, ok := fields["id"]; ok {
+		var id string
+		if err := json.Unmarshal(v, &id); err != nil {
+			return fmt.Errorf("Invalid id: %w", err)
+		}
+		if !sameID(id, reading.ID()) {
+			if mismatch == nil {
+				mismatch = &MismatchError{}
+			}
+			decoded, _ := json.Marshal(reading.ID())
+			mismatch.Mismatches = append(mismatch.Mismatches, Mismatch{Field: "id", Stored: string(v), Decoded: string(decoded)})
+		}
+	}
+
+	*r = reading
+	if mismatch != nil {
+		return mismatch
+	}
+	return nil
+}
+
+// sameID reports whether IDs a and b are the same, comparing MAC addresses in any form
+func sameID(a, b string) bool {
+	ma, errA := ParseMAC(a)
+	mb, errB := ParseMAC(b)
+	if errA == nil && errB == nil {
+		return ma == mb
+	}
+	return a == b
+}
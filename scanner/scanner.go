@@ -0,0 +1,67 @@
+// Package scanner implements ruuvi.Source by scanning for BLE advertisements using the host's Bluetooth adapter
+package scanner
+
+import (
+	"context"
+	"time"
+
+	"github.com/paypal/gatt"
+	"github.com/paypal/gatt/examples/option"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// Scanner is a live BLE scanner producing readings from ruuvitag advertisements.
+// Advertisements of data formats not registered in ruuvi.DefaultFormats are ignored.
+type Scanner struct {
+	opts []gatt.Option
+}
+
+var _ ruuvi.Source = (*Scanner)(nil)
+
+// New returns a Scanner using given gatt device options, or platform defaults if none are given
+func New(opts ...gatt.Option) *Scanner {
+	if len(opts) == 0 {
+		opts = option.DefaultClientOptions
+	}
+	return &Scanner{opts: opts}
+}
+
+// Run implements ruuvi.Source
+func (s *Scanner) Run(ctx context.Context, out chan<- ruuvi.Reading) error {
+	d, err := gatt.NewDevice(s.opts...)
+	if err != nil {
+		return err
+	}
+
+	d.Handle(gatt.PeripheralDiscovered(func(p gatt.Peripheral, a *gatt.Advertisement, rssi int) {
+		// not checking the company ID here, so that formats registered for other companies get through
+		data, err := ruuvi.ProcessAdvertisement(a.ManufacturerData)
+		if err != nil {
+			return
+		}
+		// advertisement buffer is reused by gatt
+		data.Copy()
+
+		select {
+		case out <- ruuvi.Reading{Timestamp: time.Now(), MAC: p.ID(), RSSI: rssi, Data: data}:
+		case <-ctx.Done():
+		}
+	}))
+
+	err = d.Init(func(d gatt.Device, s gatt.State) {
+		switch s {
+		case gatt.StatePoweredOn:
+			d.Scan([]gatt.UUID{}, true) // report duplicates since we want to keep receiving adverts from sensors
+		default:
+			d.StopScanning()
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	<-ctx.Done()
+	d.StopScanning()
+	return nil
+}
@@ -0,0 +1,267 @@
+// Package simulator generates advertisements of virtual ruuvitags, for development without hardware.
+//
+// Simulator implements ruuvi.Source, producing readings which look like they were received
+// by a live scanner. Generated bytes are encoded with ruuvi.Encode and decoded with
+// ruuvi.ProcessAdvertisement, so they go through the same code paths as real advertisements.
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// Profile describes how a measurement varies over time:
+// a sine wave around Base with given Amplitude and Period, plus normally distributed noise
+type Profile struct {
+	Base      float64
+	Amplitude float64
+	Period    time.Duration
+	Noise     float64 // standard deviation
+}
+
+func (p Profile) value(elapsed time.Duration, rng *rand.Rand) float64 {
+	v := p.Base
+	if p.Period > 0 {
+		v += p.Amplitude * math.Sin(2*math.Pi*float64(elapsed)/float64(p.Period))
+	}
+	if p.Noise > 0 {
+		v += rng.NormFloat64() * p.Noise
+	}
+	return v
+}
+
+// TagConfig describes a single virtual tag
+type TagConfig struct {
+	// MAC is the address of the tag, also broadcast in the payload if the data format supports it
+	MAC ruuvi.MAC
+
+	// DataFormat is either 3 (RAWv1) or 5 (RAWv2)
+	DataFormat int8
+
+	// Temperature in degrees Celsius, Humidity in percent and Pressure in Pa.
+	// Values are limited to what the data format can encode, and humidity to 0-100 %.
+	Temperature Profile
+	Humidity    Profile
+	Pressure    Profile
+
+	// BatteryVoltage is the voltage at start, which drains by BatteryDrain volts per 24 hours
+	BatteryVoltage float64
+	BatteryDrain   float64
+
+	// TransmissionPower in dBm
+	TransmissionPower float64
+
+	// MovementProbability is the probability of the tag being moved between two advertisements
+	MovementProbability float64
+
+	// RebootProbability is the probability of the tag rebooting between two advertisements,
+	// which resets its sequence and movement counters
+	RebootProbability float64
+}
+
+// DefaultTag returns a typical indoor RAWv2 tag configuration with given MAC
+func DefaultTag(mac ruuvi.MAC) TagConfig {
+	return TagConfig{
+		MAC:                 mac,
+		DataFormat:          5,
+		Temperature:         Profile{Base: 21.0, Amplitude: 2.0, Period: 24 * time.Hour, Noise: 0.05},
+		Humidity:            Profile{Base: 40.0, Amplitude: 5.0, Period: 24 * time.Hour, Noise: 0.2},
+		Pressure:            Profile{Base: 101325, Amplitude: 500, Period: 72 * time.Hour, Noise: 5},
+		BatteryVoltage:      3.0,
+		BatteryDrain:        0.0005,
+		TransmissionPower:   4,
+		MovementProbability: 0.001,
+	}
+}
+
+// DefaultTags returns configurations for n tags, alternating between RAWv2 and RAWv1 formats,
+// with MAC addresses and baselines derived from their index
+func DefaultTags(n int) []TagConfig {
+	tags := make([]TagConfig, n)
+	for i := range tags {
+		t := DefaultTag(ruuvi.MAC{0xEE, 0x00, 0x00, 0x00, byte(i >> 8), byte(i)})
+		if i%2 == 1 {
+			t.DataFormat = 3
+		}
+		t.Temperature.Base += float64(i % 10)
+		tags[i] = t
+	}
+	return tags
+}
+
+// Config contains settings for Simulator
+type Config struct {
+	Tags []TagConfig
+
+	// Interval between advertisements of each tag, defaults to one second
+	Interval time.Duration
+
+	// PacketLoss is the probability of an advertisement not being received
+	PacketLoss float64
+
+	// RSSI is the average signal strength reported, with some random variation
+	RSSI int
+
+	// Seed for the random number generator, same seed produces same readings
+	Seed int64
+}
+
+type tagState struct {
+	cfg             TagConfig
+	sequence        int
+	movementCounter int
+	orientation     [3]float64
+}
+
+// Simulator generates readings of virtual tags. Simulator is safe for concurrent use.
+type Simulator struct {
+	cfg   Config
+	start time.Time
+
+	mu   sync.Mutex
+	rng  *rand.Rand
+	tags []*tagState
+}
+
+var _ ruuvi.Source = (*Simulator)(nil)
+
+// New returns a Simulator. Simulated time starts at start, e.g. time.Now().
+func New(cfg Config, start time.Time) *Simulator {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.RSSI == 0 {
+		cfg.RSSI = -70
+	}
+	s := &Simulator{
+		cfg:   cfg,
+		start: start,
+		rng:   rand.New(rand.NewSource(cfg.Seed)),
+	}
+	for _, t := range cfg.Tags {
+		s.tags = append(s.tags, &tagState{cfg: t, orientation: [3]float64{0, 0, 1}})
+	}
+	return s
+}
+
+// Step generates one advertisement per tag at simulated time now, leaving out lost packets
+func (s *Simulator) Step(now time.Time) ([]ruuvi.Reading, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elapsed := now.Sub(s.start)
+	readings := make([]ruuvi.Reading, 0, len(s.tags))
+	for _, t := range s.tags {
+		b, err := s.advertise(t, elapsed)
+		if err != nil {
+			return nil, err
+		}
+		if s.rng.Float64() < s.cfg.PacketLoss {
+			continue
+		}
+		d, err := ruuvi.ProcessAdvertisement(b)
+		if err != nil {
+			return nil, err
+		}
+		readings = append(readings, ruuvi.Reading{
+			Timestamp:   now,
+			MAC:         t.cfg.MAC.String(),
+			AddressType: ruuvi.AddressRandom,
+			RSSI:        s.cfg.RSSI + s.rng.Intn(11) - 5,
+			Data:        d,
+		})
+	}
+	return readings, nil
+}
+
+// advertise updates tag state and returns its next advertisement
+func (s *Simulator) advertise(t *tagState, elapsed time.Duration) ([]byte, error) {
+	if s.rng.Float64() < t.cfg.RebootProbability {
+		t.sequence = 0
+		t.movementCounter = 0
+	}
+	if s.rng.Float64() < t.cfg.MovementProbability {
+		// movement counter skips 255, which is reserved for invalid value
+		t.movementCounter = (t.movementCounter + 1) % 255
+		t.orientation = randomOrientation(s.rng)
+	}
+
+	temperature := t.cfg.Temperature.value(elapsed, s.rng)
+	if c, ok := ruuvi.FormatCapabilities(t.cfg.DataFormat); ok {
+		if info, ok := c.Info(ruuvi.FieldTemperature); ok {
+			temperature = clamp(temperature, info.Min, info.Max)
+		}
+	}
+
+	m := ruuvi.Measurements{
+		DataFormat: t.cfg.DataFormat,
+		Valid: ruuvi.FieldTemperature | ruuvi.FieldHumidity | ruuvi.FieldPressure |
+			ruuvi.FieldAccelerationX | ruuvi.FieldAccelerationY | ruuvi.FieldAccelerationZ |
+			ruuvi.FieldBatteryVoltage | ruuvi.FieldTransmissionPower | ruuvi.FieldMovementCounter |
+			ruuvi.FieldMeasurementSequenceNumber | ruuvi.FieldMACAddress,
+		Temperature:               temperature,
+		Humidity:                  clamp(t.cfg.Humidity.value(elapsed, s.rng), 0, 100),
+		Pressure:                  int(math.Round(clamp(t.cfg.Pressure.value(elapsed, s.rng), 50000, 115534))),
+		AccelerationX:             t.orientation[0] + s.rng.NormFloat64()*0.004,
+		AccelerationY:             t.orientation[1] + s.rng.NormFloat64()*0.004,
+		AccelerationZ:             t.orientation[2] + s.rng.NormFloat64()*0.004,
+		BatteryVoltage:            clamp(t.cfg.BatteryVoltage-t.cfg.BatteryDrain*elapsed.Hours()/24, 1.6, 3.646),
+		TransmissionPower:         t.cfg.TransmissionPower,
+		MovementCounter:           t.movementCounter,
+		MeasurementSequenceNumber: t.sequence,
+		MACAddress:                t.cfg.MAC,
+	}
+	// sequence number skips 65535, which is reserved for invalid value
+	t.sequence = (t.sequence + 1) % 65535
+
+	b, err := ruuvi.Encode(m)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to encode advertisement of tag %s: %w", t.cfg.MAC, err)
+	}
+	return b, nil
+}
+
+// randomOrientation returns a gravity vector of 1 G pointing in a random direction
+func randomOrientation(rng *rand.Rand) [3]float64 {
+	x, y, z := rng.NormFloat64(), rng.NormFloat64(), rng.NormFloat64()
+	n := math.Sqrt(x*x + y*y + z*z)
+	if n == 0 {
+		return [3]float64{0, 0, 1}
+	}
+	return [3]float64{x / n, y / n, z / n}
+}
+
+func clamp(v, min, max float64) float64 {
+	return math.Max(min, math.Min(max, v))
+}
+
+// Run implements ruuvi.Source, generating advertisements of all tags every interval in real time
+func (s *Simulator) Run(ctx context.Context, out chan<- ruuvi.Reading) error {
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			readings, err := s.Step(now)
+			if err != nil {
+				return err
+			}
+			for _, r := range readings {
+				select {
+				case out <- r:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		}
+	}
+}
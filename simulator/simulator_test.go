@@ -0,0 +1,208 @@
+package simulator
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+var start = time.Date(2021, 3, 31, 0, 0, 0, 0, time.UTC)
+
+func TestRoundTrip(t *testing.T) {
+	s := New(Config{Tags: DefaultTags(4), Seed: 1}, start)
+
+	readings, err := s.Step(start.Add(6 * time.Hour))
+	if err != nil {
+		t.Fatal("Step() returned error:", err)
+	}
+	if len(readings) != 4 {
+		t.Fatal("Expected 4 readings, got", len(readings))
+	}
+
+	for i, r := range readings {
+		expectedFormat := int8(5)
+		if i%2 == 1 {
+			expectedFormat = 3
+		}
+		if r.Data.DataFormat() != expectedFormat {
+			t.Errorf("Tag %d: wrong data format %d", i, r.Data.DataFormat())
+		}
+
+		// bytes survive a second trip through the decoder unchanged
+		d, err := ruuvi.ProcessAdvertisement(append([]byte{0x99, 0x04}, r.Data.RawData()...))
+		if err != nil {
+			t.Fatal("ProcessAdvertisement() returned error:", err)
+		}
+		if !cmp.Equal(d.RawData(), r.Data.RawData()) {
+			t.Error("Raw data changed in round trip")
+		}
+
+		// at 6 hours daily sine wave is at its peak
+		temp, err := d.Temperature()
+		if err != nil {
+			t.Fatal("Temperature() returned error:", err)
+		}
+		if expected := 23.0 + float64(i); math.Abs(temp-expected) > 0.5 {
+			t.Errorf("Tag %d: temperature %v too far from %v", i, temp, expected)
+		}
+		if h, err := d.Humidity(); err != nil || h < 40 || h > 50 {
+			t.Errorf("Tag %d: implausible humidity %v", i, h)
+		}
+		if p, err := d.Pressure(); err != nil || p < 100000 || p > 102000 {
+			t.Errorf("Tag %d: implausible pressure %v", i, p)
+		}
+		if z, err := d.AccelerationZ(); err != nil || math.Abs(z-1.0) > 0.05 {
+			t.Errorf("Tag %d: implausible acceleration %v", i, z)
+		}
+	}
+
+	if mac, err := readings[0].Data.MACAddress(); err != nil || mac != (ruuvi.MAC{0xEE, 0, 0, 0, 0, 0}) {
+		t.Error("Wrong MAC in payload:", mac, err)
+	}
+	if readings[1].MAC != "EE:00:00:00:00:01" {
+		t.Error("Wrong MAC in reading:", readings[1].MAC)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	run := func() [][]byte {
+		s := New(Config{Tags: DefaultTags(3), Seed: 42, PacketLoss: 0.3}, start)
+		var out [][]byte
+		for i := 0; i < 20; i++ {
+			readings, err := s.Step(start.Add(time.Duration(i) * time.Second))
+			if err != nil {
+				t.Fatal("Step() returned error:", err)
+			}
+			for _, r := range readings {
+				out = append(out, r.Data.RawData())
+			}
+		}
+		return out
+	}
+	if !cmp.Equal(run(), run()) {
+		t.Fatal("Same seed produced different advertisements")
+	}
+}
+
+func TestSequenceMovementAndReboot(t *testing.T) {
+	tag := DefaultTag([6]byte{1, 2, 3, 4, 5, 6})
+	tag.MovementProbability = 1
+	s := New(Config{Tags: []TagConfig{tag}}, start)
+
+	for i := 0; i < 5; i++ {
+		readings, err := s.Step(start.Add(time.Duration(i) * time.Second))
+		if err != nil {
+			t.Fatal("Step() returned error:", err)
+		}
+		d := readings[0].Data
+		if seq, _ := d.MeasurementSequenceNumber(); seq != i {
+			t.Fatalf("Expected sequence number %d, got %d", i, seq)
+		}
+		if mov, _ := d.MovementCounter(); mov != i+1 {
+			t.Fatalf("Expected movement counter %d, got %d", i+1, mov)
+		}
+	}
+
+	s.tags[0].cfg.RebootProbability = 1
+	s.tags[0].cfg.MovementProbability = 0
+	readings, err := s.Step(start.Add(10 * time.Second))
+	if err != nil {
+		t.Fatal("Step() returned error:", err)
+	}
+	d := readings[0].Data
+	if seq, _ := d.MeasurementSequenceNumber(); seq != 0 {
+		t.Fatal("Sequence number not reset by reboot:", seq)
+	}
+	if mov, _ := d.MovementCounter(); mov != 0 {
+		t.Fatal("Movement counter not reset by reboot:", mov)
+	}
+}
+
+func TestBatteryDrain(t *testing.T) {
+	tag := DefaultTag([6]byte{1, 2, 3, 4, 5, 6})
+	tag.BatteryVoltage = 3.0
+	tag.BatteryDrain = 0.1
+	s := New(Config{Tags: []TagConfig{tag}}, start)
+
+	for _, tc := range []struct {
+		at       time.Duration
+		expected float64
+	}{
+		{0, 3.0},
+		{5 * 24 * time.Hour, 2.5},
+		{365 * 24 * time.Hour, 1.6},
+	} {
+		readings, err := s.Step(start.Add(tc.at))
+		if err != nil {
+			t.Fatal("Step() returned error:", err)
+		}
+		if v, _ := readings[0].Data.BatteryVoltage(); math.Abs(v-tc.expected) > 0.001 {
+			t.Errorf("After %v: expected %v V, got %v V", tc.at, tc.expected, v)
+		}
+	}
+}
+
+func TestTemperatureClamped(t *testing.T) {
+	for _, tc := range []struct {
+		dataFormat int8
+		base       float64
+		expected   float64
+	}{
+		{3, 150, 127.99},
+		{3, -150, -127.99},
+		{5, 200, 163.835},
+		{5, -200, -163.835},
+	} {
+		tag := DefaultTag([6]byte{1, 2, 3, 4, 5, 6})
+		tag.DataFormat = tc.dataFormat
+		tag.Temperature = Profile{Base: tc.base}
+		readings, err := New(Config{Tags: []TagConfig{tag}}, start).Step(start)
+		if err != nil {
+			t.Fatalf("Step() returned error for %v °C in data format %d: %v", tc.base, tc.dataFormat, err)
+		}
+		if v, _ := readings[0].Data.Temperature(); math.Abs(v-tc.expected) > 0.001 {
+			t.Errorf("Data format %d: expected %v °C, got %v °C", tc.dataFormat, tc.expected, v)
+		}
+	}
+}
+
+func TestPacketLoss(t *testing.T) {
+	s := New(Config{Tags: DefaultTags(10), PacketLoss: 0.25, Seed: 7}, start)
+	received := 0
+	for i := 0; i < 100; i++ {
+		readings, err := s.Step(start.Add(time.Duration(i) * time.Second))
+		if err != nil {
+			t.Fatal("Step() returned error:", err)
+		}
+		received += len(readings)
+	}
+	if received < 700 || received > 800 {
+		t.Fatal("Expected about 750 of 1000 packets, got", received)
+	}
+}
+
+func TestRun(t *testing.T) {
+	s := New(Config{Tags: DefaultTags(2), Interval: time.Millisecond}, time.Now())
+	ctx, cancel := context.WithCancel(context.Background())
+	out := make(chan ruuvi.Reading)
+
+	done := make(chan error)
+	go func() { done <- s.Run(ctx, out) }()
+
+	for i := 0; i < 4; i++ {
+		select {
+		case <-out:
+		case <-time.After(time.Second):
+			t.Fatal("No reading received")
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal("Run() returned error:", err)
+	}
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Stats contains minimum, average and maximum of a measurement within a rollup bucket.
+// Stats is nil if there were no valid values within the bucket.
+type Stats struct {
+	Min float64
+	Avg float64
+	Max float64
+}
+
+// Rollup contains aggregated measurements of a tag over one bucket of time
+type Rollup struct {
+	MAC            string
+	Resolution     Resolution
+	Start          time.Time
+	Count          int
+	Temperature    *Stats
+	Humidity       *Stats
+	Pressure       *Stats
+	BatteryVoltage *Stats
+}
+
+// Rollup aggregates data within [from, to) into buckets of given resolution.
+// Minute rollups are computed from stored readings and hour rollups from minute rollups,
+// so raw readings can be pruned once minute rollups exist.
+// Only buckets fully within the time range should be requested, partial buckets are overwritten by later calls.
+func (s *Store) Rollup(ctx context.Context, res Resolution, from, to time.Time) error {
+	var query string
+	var args []interface{}
+
+	switch res {
+	case Minute:
+		query = `INSERT OR REPLACE INTO rollups
+		SELECT mac, ?1, (ts / 1000000000 / ?1) * ?1 AS b, COUNT(*),
+			MIN(temperature), AVG(temperature), MAX(temperature),
+			MIN(humidity), AVG(humidity), MAX(humidity),
+			MIN(pressure), AVG(pressure), MAX(pressure),
+			MIN(battery_voltage), AVG(battery_voltage), MAX(battery_voltage)
+		FROM readings WHERE ts >= ?2 AND ts < ?3 GROUP BY mac, b`
+		args = []interface{}{res.seconds(), from.UnixNano(), to.UnixNano()}
+	case Hour:
+		// averages are weighted by the number of readings within each minute
+		query = `INSERT OR REPLACE INTO rollups
+		SELECT mac, ?1, (bucket / ?1) * ?1 AS b, SUM(count),
+			MIN(temperature_min), SUM(temperature_avg * count) / SUM(CASE WHEN temperature_avg IS NULL THEN 0 ELSE count END), MAX(temperature_max),
+			MIN(humidity_min), SUM(humidity_avg * count) / SUM(CASE WHEN humidity_avg IS NULL THEN 0 ELSE count END), MAX(humidity_max),
+			MIN(pressure_min), SUM(pressure_avg * count) / SUM(CASE WHEN pressure_avg IS NULL THEN 0 ELSE count END), MAX(pressure_max),
+			MIN(voltage_min), SUM(voltage_avg * count) / SUM(CASE WHEN voltage_avg IS NULL THEN 0 ELSE count END), MAX(voltage_max)
+		FROM rollups WHERE resolution = ?2 AND bucket >= ?3 AND bucket < ?4 GROUP BY mac, b`
+		args = []interface{}{res.seconds(), Minute.seconds(), from.Unix(), to.Unix()}
+	default:
+		return errors.New("Unsupported rollup resolution")
+	}
+
+	_, err := s.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// QueryRollups returns rollups of tag with given MAC and resolution starting within [from, to), ordered by time
+func (s *Store) QueryRollups(ctx context.Context, mac string, res Resolution, from, to time.Time) ([]Rollup, error) {
+	mac = canonicalMAC(mac)
+	rows, err := s.db.QueryContext(ctx, `SELECT bucket, count,
+		temperature_min, temperature_avg, temperature_max,
+		humidity_min, humidity_avg, humidity_max,
+		pressure_min, pressure_avg, pressure_max,
+		voltage_min, voltage_avg, voltage_max
+		FROM rollups WHERE mac = ? AND resolution = ? AND bucket >= ? AND bucket < ? ORDER BY bucket`,
+		mac, res.seconds(), from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rollups []Rollup
+	for rows.Next() {
+		var (
+			bucket int64
+			r      = Rollup{MAC: mac, Resolution: res}
+			stats  [12]sql.NullFloat64
+		)
+		dest := []interface{}{&bucket, &r.Count}
+		for i := range stats {
+			dest = append(dest, &stats[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		r.Start = time.Unix(bucket, 0)
+		r.Temperature = toStats(stats[0:3])
+		r.Humidity = toStats(stats[3:6])
+		r.Pressure = toStats(stats[6:9])
+		r.BatteryVoltage = toStats(stats[9:12])
+		rollups = append(rollups, r)
+	}
+	return rollups, rows.Err()
+}
+
+func toStats(v []sql.NullFloat64) *Stats {
+	if !v[0].Valid || !v[1].Valid || !v[2].Valid {
+		return nil
+	}
+	return &Stats{Min: v[0].Float64, Avg: v[1].Float64, Max: v[2].Float64}
+}
+
+// RetentionPolicy defines how long data is kept. Zero duration keeps data forever.
+type RetentionPolicy struct {
+	Readings      time.Duration
+	MinuteRollups time.Duration
+	HourRollups   time.Duration
+}
+
+// Prune deletes data older than allowed by the retention policy, relative to now
+func (s *Store) Prune(ctx context.Context, policy RetentionPolicy, now time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if policy.Readings > 0 {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM readings WHERE ts < ?`,
+			now.Add(-policy.Readings).UnixNano()); err != nil {
+			return err
+		}
+	}
+	for res, keep := range map[Resolution]time.Duration{Minute: policy.MinuteRollups, Hour: policy.HourRollups} {
+		if keep <= 0 {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM rollups WHERE resolution = ? AND bucket < ?`,
+			res.seconds(), now.Add(-keep).Unix()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Maintain computes rollups for completed buckets within the last lookback duration and then prunes old data.
+// It is meant to be called periodically, with lookback longer than the period and shorter than readings retention.
+func (s *Store) Maintain(ctx context.Context, policy RetentionPolicy, now time.Time, lookback time.Duration) error {
+	for _, res := range []Resolution{Minute, Hour} {
+		d := time.Duration(res)
+		to := now.Truncate(d)
+		from := now.Add(-lookback).Truncate(d)
+		if err := s.Rollup(ctx, res, from, to); err != nil {
+			return err
+		}
+	}
+	return s.Prune(ctx, policy, now)
+}
@@ -0,0 +1,262 @@
+// Package storage persists ruuvi readings into a local SQLite database.
+//
+// Readings are stored together with their raw bytes so they can be re-decoded later.
+// Long-term data can be kept as per minute and per hour rollups (min/avg/max),
+// while older raw readings are removed according to a retention policy.
+//
+// The SQLite driver used requires cgo.
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	// register sqlite3 driver
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS readings (
+	mac                  TEXT    NOT NULL,
+	ts                   INTEGER NOT NULL, -- unix time in nanoseconds
+	rssi                 INTEGER NOT NULL,
+	data_format          INTEGER NOT NULL,
+	temperature          REAL,
+	humidity             REAL,
+	pressure             INTEGER,
+	acceleration_x       REAL,
+	acceleration_y       REAL,
+	acceleration_z       REAL,
+	battery_voltage      REAL,
+	tx_power             REAL,
+	movement_counter     INTEGER,
+	measurement_sequence INTEGER,
+	raw                  BLOB    NOT NULL,
+	PRIMARY KEY (mac, ts)
+);
+CREATE INDEX IF NOT EXISTS readings_ts ON readings (ts);
+
+CREATE TABLE IF NOT EXISTS rollups (
+	mac             TEXT    NOT NULL,
+	resolution      INTEGER NOT NULL, -- bucket length in seconds
+	bucket          INTEGER NOT NULL, -- bucket start as unix time in seconds
+	count           INTEGER NOT NULL,
+	temperature_min REAL,
+	temperature_avg REAL,
+	temperature_max REAL,
+	humidity_min    REAL,
+	humidity_avg    REAL,
+	humidity_max    REAL,
+	pressure_min    REAL,
+	pressure_avg    REAL,
+	pressure_max    REAL,
+	voltage_min     REAL,
+	voltage_avg     REAL,
+	voltage_max     REAL,
+	PRIMARY KEY (mac, resolution, bucket)
+);
+CREATE INDEX IF NOT EXISTS rollups_bucket ON rollups (resolution, bucket);
+`
+
+// Resolution is the length of a rollup bucket
+type Resolution time.Duration
+
+const (
+	Minute = Resolution(time.Minute)
+	Hour   = Resolution(time.Hour)
+)
+
+func (r Resolution) seconds() int64 {
+	return int64(time.Duration(r) / time.Second)
+}
+
+// Store is a SQLite backed store of readings. Store is safe for concurrent use.
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens (creating if needed) the SQLite database at path and makes sure the schema exists
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+	// sqlite allows only one writer at a time
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Failed to create schema: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Insert stores a single reading. A reading with the same MAC and timestamp as an already stored one is ignored.
+func (s *Store) Insert(ctx context.Context, r ruuvi.Reading) error {
+	return s.InsertBatch(ctx, []ruuvi.Reading{r})
+}
+
+// InsertBatch stores multiple readings in a single transaction.
+// Every reading must have data and a timestamp, otherwise an error is returned and none are stored.
+func (s *Store) InsertBatch(ctx context.Context, readings []ruuvi.Reading) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT OR IGNORE INTO readings (
+		mac, ts, rssi, data_format,
+		temperature, humidity, pressure,
+		acceleration_x, acceleration_y, acceleration_z,
+		battery_voltage, tx_power, movement_counter, measurement_sequence, raw
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, r := range readings {
+		if r.Data == nil {
+			return errors.New("Reading has no data")
+		}
+		if r.Timestamp.IsZero() {
+			return errors.New("Reading has no timestamp")
+		}
+		if _, err := stmt.ExecContext(ctx, values(r)...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// canonicalMAC returns mac in the canonical form readings are stored with, see ruuvi.Reading.Address
+func canonicalMAC(mac string) string {
+	return ruuvi.Reading{MAC: mac}.Address()
+}
+
+// values returns column values for a reading, NULL for unavailable or invalid fields.
+// The columns of measurement fields are in the order of ruuvi.Fields(), without the MAC address which is in the raw data.
+func values(r ruuvi.Reading) []interface{} {
+	d := r.Data
+	v := []interface{}{r.Address(), r.Timestamp.UnixNano(), r.RSSI, d.DataFormat()}
+	m := ruuvi.MeasurementsOf(d)
+	for _, f := range ruuvi.Fields() {
+		switch {
+		case f == ruuvi.FieldMACAddress:
+		case !m.Valid.Has(f):
+			v = append(v, nil)
+		case f.Integer():
+			v = append(v, int(m.Value(f)))
+		default:
+			v = append(v, m.Value(f))
+		}
+	}
+	return append(v, ruuvi.Advertisement{AdvertisementData: d})
+}
+
+// Consume stores readings received from the channel until it is closed or ctx is cancelled.
+// Readings are written in batches of up to batchSize readings, or at least once every flushInterval.
+func (s *Store) Consume(ctx context.Context, readings <-chan ruuvi.Reading, batchSize int, flushInterval time.Duration) error {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]ruuvi.Reading, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		// use background context so that last batch is still written after ctx is cancelled
+		err := s.InsertBatch(context.Background(), batch)
+		batch = batch[:0]
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return flush()
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		case r, ok := <-readings:
+			if !ok {
+				return flush()
+			}
+			if r.Data != nil {
+				r.Data.Copy()
+			}
+			batch = append(batch, r)
+			if len(batch) >= batchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// Query returns readings of tag with given MAC received in time range [from, to), ordered by time.
+// Readings are re-decoded from the stored raw bytes.
+func (s *Store) Query(ctx context.Context, mac string, from, to time.Time) ([]ruuvi.Reading, error) {
+	mac = canonicalMAC(mac)
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT ts, rssi, raw FROM readings WHERE mac = ? AND ts >= ? AND ts < ? ORDER BY ts`,
+		mac, from.UnixNano(), to.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var readings []ruuvi.Reading
+	for rows.Next() {
+		var (
+			ts   int64
+			rssi int
+			data ruuvi.Advertisement
+		)
+		if err := rows.Scan(&ts, &rssi, &data); err != nil {
+			return nil, fmt.Errorf("Failed to decode stored reading: %w", err)
+		}
+		readings = append(readings, ruuvi.Reading{
+			Timestamp: time.Unix(0, ts),
+			MAC:       mac,
+			RSSI:      rssi,
+			Data:      data.AdvertisementData,
+		})
+	}
+	return readings, rows.Err()
+}
+
+// MACs returns MAC addresses of all tags which have stored readings
+func (s *Store) MACs(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT mac FROM readings ORDER BY mac`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var macs []string
+	for rows.Next() {
+		var mac string
+		if err := rows.Scan(&mac); err != nil {
+			return nil, err
+		}
+		macs = append(macs, mac)
+	}
+	return macs, rows.Err()
+}
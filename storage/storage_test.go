@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+var float64FuzzyCompOpt = cmp.Comparer(func(x, y float64) bool {
+	delta := math.Abs(x - y)
+	mean := math.Abs(x+y) / 2.0
+	if mean == 0 {
+		return true
+	}
+	return (delta / mean) < 0.00001
+})
+
+var start = time.Date(2021, 3, 31, 9, 0, 0, 0, time.UTC)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "ruuvi.db"))
+	if err != nil {
+		t.Fatal("Open() returned error:", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// rawv2Reading returns a RAWv2 reading with given temperature in 0.005 degree steps
+func rawv2Reading(t *testing.T, ts time.Time, temp int16) ruuvi.Reading {
+	t.Helper()
+	b := []byte{
+		0x99, 0x04,
+		0x05, byte(uint16(temp) >> 8), byte(uint16(temp)), 0x53, 0x94, 0xC3, 0x7C, 0x00,
+		0x04, 0xFF, 0xFC, 0x04, 0x0C, 0xAC, 0x36, 0x42,
+		0x00, 0xCD, 0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F,
+	}
+	d, err := ruuvi.ProcessAdvertisement(b)
+	if err != nil {
+		t.Fatal("Error: ", err)
+	}
+	return ruuvi.Reading{Timestamp: ts, MAC: "CB:B8:33:4C:88:4F", RSSI: -60, Data: d}
+}
+
+func TestInsertAndQuery(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+
+	var readings []ruuvi.Reading
+	for i := 0; i < 10; i++ {
+		readings = append(readings, rawv2Reading(t, start.Add(time.Duration(i)*time.Second), int16(4000+i*200)))
+	}
+	if err := s.InsertBatch(ctx, readings); err != nil {
+		t.Fatal("InsertBatch() returned error:", err)
+	}
+	// duplicates are ignored
+	if err := s.Insert(ctx, readings[0]); err != nil {
+		t.Fatal("Insert() returned error:", err)
+	}
+
+	got, err := s.Query(ctx, "CB:B8:33:4C:88:4F", start.Add(2*time.Second), start.Add(5*time.Second))
+	if err != nil {
+		t.Fatal("Query() returned error:", err)
+	}
+	if len(got) != 3 {
+		t.Fatal("Expected 3 readings, got", len(got))
+	}
+	for i, r := range got {
+		if !r.Timestamp.Equal(readings[i+2].Timestamp) {
+			t.Error("Wrong timestamp:", r.Timestamp)
+		}
+		if !cmp.Equal(r.Data.RawData(), readings[i+2].Data.RawData()) {
+			t.Error("Raw data differs from inserted")
+		}
+		temp, err := r.Data.Temperature()
+		if err != nil {
+			t.Fatal("Temperature() returned error")
+		}
+		if !cmp.Equal(temp, float64(4000+(i+2)*200)*0.005, float64FuzzyCompOpt) {
+			t.Error("Wrong temperature:", temp)
+		}
+	}
+
+	if got, err := s.Query(ctx, "AA:AA:AA:AA:AA:AA", start, start.Add(time.Hour)); err != nil || len(got) != 0 {
+		t.Fatal("Expected no readings for unknown tag, got", len(got), err)
+	}
+
+	macs, err := s.MACs(ctx)
+	if err != nil {
+		t.Fatal("MACs() returned error:", err)
+	}
+	if !cmp.Equal(macs, []string{"CB:B8:33:4C:88:4F"}) {
+		t.Fatal("Unexpected MACs:", macs)
+	}
+}
+
+func TestInsertIncomplete(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+
+	valid := rawv2Reading(t, start, 4000)
+	noData := valid
+	noData.Data = nil
+	noTimestamp := valid
+	noTimestamp.Timestamp = time.Time{}
+	for name, r := range map[string]ruuvi.Reading{"no data": noData, "no timestamp": noTimestamp} {
+		if err := s.InsertBatch(ctx, []ruuvi.Reading{valid, r}); err == nil {
+			t.Errorf("Expected error for reading with %s", name)
+		}
+	}
+	if macs, err := s.MACs(ctx); err != nil || len(macs) != 0 {
+		t.Fatal("Expected nothing to be stored, got", macs, err)
+	}
+}
+
+func TestConsume(t *testing.T) {
+	s := openTestStore(t)
+
+	ch := make(chan ruuvi.Reading)
+	done := make(chan error)
+	go func() {
+		done <- s.Consume(context.Background(), ch, 4, time.Hour)
+	}()
+	for i := 0; i < 10; i++ {
+		ch <- rawv2Reading(t, start.Add(time.Duration(i)*time.Second), 4000)
+	}
+	close(ch)
+	if err := <-done; err != nil {
+		t.Fatal("Consume() returned error:", err)
+	}
+
+	got, err := s.Query(context.Background(), "CB:B8:33:4C:88:4F", start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal("Query() returned error:", err)
+	}
+	if len(got) != 10 {
+		t.Fatal("Expected 10 readings, got", len(got))
+	}
+}
+
+func TestRollupsAndRetention(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+
+	// two readings per minute for two hours, first at 20.0 and second at 22.0 degrees
+	var readings []ruuvi.Reading
+	for m := 0; m < 120; m++ {
+		ts := start.Add(time.Duration(m) * time.Minute)
+		readings = append(readings, rawv2Reading(t, ts, 4000))
+		readings = append(readings, rawv2Reading(t, ts.Add(30*time.Second), 4400))
+	}
+	// third reading in the very first minute
+	readings = append(readings, rawv2Reading(t, start.Add(45*time.Second), 4600))
+	if err := s.InsertBatch(ctx, readings); err != nil {
+		t.Fatal("InsertBatch() returned error:", err)
+	}
+
+	now := start.Add(2 * time.Hour)
+	policy := RetentionPolicy{Readings: 30 * time.Minute, MinuteRollups: 90 * time.Minute}
+	if err := s.Maintain(ctx, policy, now, 3*time.Hour); err != nil {
+		t.Fatal("Maintain() returned error:", err)
+	}
+
+	minutes, err := s.QueryRollups(ctx, "CB:B8:33:4C:88:4F", Minute, start, now)
+	if err != nil {
+		t.Fatal("QueryRollups() returned error:", err)
+	}
+	// minute rollups older than 90 minutes were pruned
+	if len(minutes) != 90 {
+		t.Fatal("Expected 90 minute rollups, got", len(minutes))
+	}
+	expected := Rollup{
+		MAC:            "CB:B8:33:4C:88:4F",
+		Resolution:     Minute,
+		Start:          start.Add(30 * time.Minute),
+		Count:          2,
+		Temperature:    &Stats{Min: 20.0, Avg: 21.0, Max: 22.0},
+		Humidity:       &Stats{Min: 53.49, Avg: 53.49, Max: 53.49},
+		Pressure:       &Stats{Min: 100044, Avg: 100044, Max: 100044},
+		BatteryVoltage: &Stats{Min: 2.977, Avg: 2.977, Max: 2.977},
+	}
+	if diff := cmp.Diff(expected, minutes[0], float64FuzzyCompOpt); diff != "" {
+		t.Fatal("Unexpected minute rollup (-want +got):\n", diff)
+	}
+
+	hours, err := s.QueryRollups(ctx, "CB:B8:33:4C:88:4F", Hour, start, now)
+	if err != nil {
+		t.Fatal("QueryRollups() returned error:", err)
+	}
+	if len(hours) != 2 {
+		t.Fatal("Expected 2 hour rollups, got", len(hours))
+	}
+	if hours[0].Count != 121 {
+		t.Fatal("Wrong count in hour rollup:", hours[0].Count)
+	}
+	expectedAvg := (60*20.0 + 60*22.0 + 23.0) / 121
+	if !cmp.Equal(*hours[0].Temperature, Stats{Min: 20.0, Avg: expectedAvg, Max: 23.0}, float64FuzzyCompOpt) {
+		t.Fatal("Unexpected hour rollup temperature:", *hours[0].Temperature)
+	}
+
+	// readings older than 30 minutes were pruned
+	remaining, err := s.Query(ctx, "CB:B8:33:4C:88:4F", start, now)
+	if err != nil {
+		t.Fatal("Query() returned error:", err)
+	}
+	if len(remaining) != 60 {
+		t.Fatal("Expected 60 readings after pruning, got", len(remaining))
+	}
+}
@@ -0,0 +1,193 @@
+// Package validate checks decoded values for plausibility.
+//
+// Every field is checked against the range of valid values of its data format specification,
+// see ruuvi.Capabilities, and against configurable physical limits. A RAWv1 tag can for example
+// encode a humidity of 127.5 %, which is valid for the data format but not physically possible.
+//
+// Validation reports an outcome per field, and can be used as a filter on a stream of readings.
+package validate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// Outcome is the result of validating a single field
+type Outcome int
+
+const (
+	// OK fields are within the valid range of the data format and the configured limits
+	OK Outcome = iota
+	// OutOfRange fields are outside the valid range of the data format or the configured limits
+	OutOfRange
+	// Invalid fields were reported as invalid by the tag
+	Invalid
+	// Unsupported fields are not in the data format
+	Unsupported
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OK:
+		return "ok"
+	case OutOfRange:
+		return "out of range"
+	case Invalid:
+		return "invalid"
+	case Unsupported:
+		return "unsupported"
+	}
+	return fmt.Sprintf("Outcome(%d)", int(o))
+}
+
+// Limit is an inclusive range of plausible values
+type Limit struct {
+	Min, Max float64
+}
+
+// Limits are physical limits per field, on top of the valid ranges of the data format.
+// Fields without a limit are only checked against the data format.
+type Limits map[ruuvi.Field]Limit
+
+// DefaultLimits returns limits based on the operating ranges of the sensors of a RuuviTag
+func DefaultLimits() Limits {
+	return Limits{
+		ruuvi.FieldTemperature:   {Min: -40, Max: 85},
+		ruuvi.FieldHumidity:      {Min: 0, Max: 100},
+		ruuvi.FieldPressure:      {Min: 30000, Max: 110000},
+		ruuvi.FieldAccelerationX: {Min: -16, Max: 16},
+		ruuvi.FieldAccelerationY: {Min: -16, Max: 16},
+		ruuvi.FieldAccelerationZ: {Min: -16, Max: 16},
+	}
+}
+
+// Config contains settings for Validator
+type Config struct {
+	// Limits are checked in addition to the valid ranges of the data format
+	Limits Limits
+
+	// RejectInvalid makes Filter also drop readings with fields the tag reported as invalid
+	RejectInvalid bool
+
+	// OnReject, if not nil, is called by Filter with every dropped reading and its validation result
+	OnReject func(ruuvi.Reading, Result)
+}
+
+// Validator validates AdvertisementData of any data format.
+// Validator is safe for concurrent use, as long as Config is not modified.
+type Validator struct {
+	cfg Config
+}
+
+// New returns pointer to a Validator using given config
+func New(cfg Config) *Validator {
+	return &Validator{cfg: cfg}
+}
+
+// FieldResult is the outcome of validating a single field
+type FieldResult struct {
+	Field   ruuvi.Field
+	Outcome Outcome
+	// Value is the decoded value, 0 for the MAC address and fields which are invalid or unsupported
+	Value float64
+}
+
+// Result lists the outcome of every field, in the order of ruuvi.Fields()
+type Result []FieldResult
+
+// Outcome returns the outcome of a single field
+func (r Result) Outcome(f ruuvi.Field) Outcome {
+	for _, fr := range r {
+		if fr.Field == f {
+			return fr.Outcome
+		}
+	}
+	return Unsupported
+}
+
+// With returns the set of fields with given outcome
+func (r Result) With(o Outcome) ruuvi.Field {
+	var fields ruuvi.Field
+	for _, fr := range r {
+		if fr.Outcome == o {
+			fields |= fr.Field
+		}
+	}
+	return fields
+}
+
+// OK reports whether no field is out of range
+func (r Result) OK() bool {
+	return r.With(OutOfRange) == 0
+}
+
+// Validate returns the outcome of every field of d
+func (v *Validator) Validate(d ruuvi.AdvertisementData) Result {
+	caps, hasCaps := ruuvi.CapabilitiesOf(d)
+
+	fields := ruuvi.Fields()
+	r := make(Result, len(fields))
+	var m ruuvi.Measurements
+	for i, f := range fields {
+		err := ruuvi.ReadField(d, f, &m)
+		value := m.Value(f)
+		fr := FieldResult{Field: f}
+		switch {
+		case errors.Is(err, ruuvi.ErrUnsupportedField):
+			fr.Outcome = Unsupported
+		case err != nil:
+			fr.Outcome = Invalid
+		default:
+			fr.Value = value
+			if info, ok := caps.Info(f); hasCaps && ok && info.Resolution > 0 && !within(value, info.Min, info.Max, info.Resolution/2) {
+				fr.Outcome = OutOfRange
+			} else if l, ok := v.cfg.Limits[f]; ok && !within(value, l.Min, l.Max, 0) {
+				fr.Outcome = OutOfRange
+			}
+		}
+		r[i] = fr
+	}
+	return r
+}
+
+// within reports whether v is in [min, max], allowing for floating point rounding up to tolerance
+func within(v, min, max, tolerance float64) bool {
+	return v >= min-tolerance && v <= max+tolerance
+}
+
+// accepts reports whether Filter passes a reading with validation result r
+func (v *Validator) accepts(r Result) bool {
+	return r.OK() && !(v.cfg.RejectInvalid && r.With(Invalid) != 0)
+}
+
+// Filter sends readings received from in to out, dropping readings with fields out of range,
+// until in is closed or ctx is done. Readings without data are passed through. out is closed on return.
+func (v *Validator) Filter(ctx context.Context, in <-chan ruuvi.Reading, out chan<- ruuvi.Reading) {
+	defer close(out)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case reading, ok := <-in:
+			if !ok {
+				return
+			}
+			if reading.Data != nil {
+				if r := v.Validate(reading.Data); !v.accepts(r) {
+					if v.cfg.OnReject != nil {
+						v.cfg.OnReject(reading, r)
+					}
+					continue
+				}
+			}
+			select {
+			case out <- reading:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
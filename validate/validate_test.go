@@ -0,0 +1,127 @@
+package validate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/LassiHeikkila/go-ruuvi/internal/pkg/fixture"
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// humidity 127.5 %, temperature 127.99 °C
+var rawv1Max = []byte{
+	0x99, 0x04,
+	0x03, 0xFF, 0x7F, 0x63, 0xFF, 0xFF, 0x7F, 0xFF,
+	0x7F, 0xFF, 0x7F, 0xFF, 0xFF, 0xFF,
+}
+
+func allFields() ruuvi.Field {
+	var all ruuvi.Field
+	for _, f := range ruuvi.Fields() {
+		all |= f
+	}
+	return all
+}
+
+func outcomes(r Result) map[string]Outcome {
+	m := make(map[string]Outcome, len(r))
+	for _, fr := range r {
+		m[fr.Field.String()] = fr.Outcome
+	}
+	return m
+}
+
+func TestValidate(t *testing.T) {
+	v := New(Config{Limits: DefaultLimits()})
+
+	r := v.Validate(fixture.Process(t, fixture.RAWv2))
+	if !r.OK() || r.With(OK) != allFields() {
+		t.Errorf("Expected every field to be ok, got %v", outcomes(r))
+	}
+	if r[0].Field != ruuvi.FieldTemperature || r[0].Value != 24.3 {
+		t.Errorf("Unexpected first field %+v", r[0])
+	}
+
+	r = v.Validate(fixture.Process(t, fixture.RAWv2Invalid))
+	if !r.OK() || r.With(Invalid) != allFields() {
+		t.Errorf("Expected every field to be invalid, got %v", outcomes(r))
+	}
+
+	r = v.Validate(fixture.Process(t, rawv1Max))
+	expected := map[string]Outcome{
+		"temperature":    OutOfRange,
+		"humidity":       OutOfRange,
+		"pressure":       OutOfRange,
+		"accel-x":        OutOfRange,
+		"accel-y":        OutOfRange,
+		"accel-z":        OutOfRange,
+		"voltage":        OK,
+		"tx-power":       Unsupported,
+		"movement-count": Unsupported,
+		"meas-seq":       Unsupported,
+		"mac":            Unsupported,
+	}
+	if diff := cmp.Diff(expected, outcomes(r)); diff != "" {
+		t.Error("Unexpected outcomes:", diff)
+	}
+	if r.OK() {
+		t.Error("Expected result not to be ok")
+	}
+
+	// without limits, values within the data format are ok
+	r = New(Config{}).Validate(fixture.Process(t, rawv1Max))
+	if !r.OK() {
+		t.Errorf("Expected values valid for the data format to be ok, got %v", outcomes(r))
+	}
+}
+
+// customData is AdvertisementData of a private data format reporting a temperature outside its own range
+type customData struct {
+	ruuvi.AdvertisementData
+}
+
+func (customData) DataFormat() int8              { return -64 }
+func (customData) Temperature() (float64, error) { return 42, nil }
+func (customData) Capabilities() ruuvi.Capabilities {
+	return ruuvi.Capabilities{DataFormat: -64, Fields: []ruuvi.FieldInfo{{Field: ruuvi.FieldTemperature, Resolution: 0.1, Min: -10, Max: 40}}}
+}
+
+func TestValidateCustomFormat(t *testing.T) {
+	var d ruuvi.AdvertisementData = customData{fixture.Process(t, rawv1Max)}
+	r := New(Config{}).Validate(d)
+	if o := r.Outcome(ruuvi.FieldTemperature); o != OutOfRange {
+		t.Errorf("Expected temperature out of range of the data format, got %v", o)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	var rejected []ruuvi.Reading
+	v := New(Config{
+		Limits:        DefaultLimits(),
+		RejectInvalid: true,
+		OnReject:      func(r ruuvi.Reading, _ Result) { rejected = append(rejected, r) },
+	})
+
+	in := make(chan ruuvi.Reading, 4)
+	out := make(chan ruuvi.Reading, 4)
+	in <- ruuvi.Reading{MAC: "ok", Data: fixture.Process(t, fixture.RAWv2)}
+	in <- ruuvi.Reading{MAC: "out of range", Data: fixture.Process(t, rawv1Max)}
+	in <- ruuvi.Reading{MAC: "invalid", Data: fixture.Process(t, fixture.RAWv2Invalid)}
+	in <- ruuvi.Reading{MAC: "no data"}
+	close(in)
+
+	v.Filter(context.Background(), in, out)
+
+	var passed []string
+	for r := range out {
+		passed = append(passed, r.MAC)
+	}
+	if diff := cmp.Diff([]string{"ok", "no data"}, passed); diff != "" {
+		t.Error("Unexpected readings passed:", diff)
+	}
+	if len(rejected) != 2 || rejected[0].MAC != "out of range" || rejected[1].MAC != "invalid" {
+		t.Errorf("Unexpected rejected readings %v", rejected)
+	}
+}
@@ -0,0 +1,560 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf8"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// CBOR major types
+const (
+	majorUint   = 0
+	majorNegInt = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+)
+
+// maxCBORDepth limits nesting of skipped unknown values
+const maxCBORDepth = 16
+
+// MarshalCBOR encodes r as a CBOR map keyed by the field numbers of the ruuvi.v1.Reading message,
+// see the package documentation. The encoding is deterministic as defined in RFC 8949 section 4.2.1:
+// integers and lengths use their shortest form, floats the shortest of half, single and double precision
+// which holds the value exactly, and map keys are sorted.
+// A reading without data is encoded with receive metadata only.
+func MarshalCBOR(r ruuvi.Reading) []byte {
+	return AppendCBOR(nil, r)
+}
+
+// AppendCBOR appends r encoded as by MarshalCBOR to b
+func AppendCBOR(b []byte, r ruuvi.Reading) []byte {
+	msg := fromReading(r)
+	return msg.appendCBOR(b)
+}
+
+func (msg *message) appendCBOR(b []byte) []byte {
+	n := 1 // version
+	count := func(present bool) {
+		if present {
+			n++
+		}
+	}
+	count(msg.hasTimestamp)
+	count(msg.address != "")
+	count(msg.addressType != ruuvi.AddressUnknown)
+	count(msg.rssi != 0)
+	count(msg.receiver != "")
+	count(msg.dataFormat != 0)
+	count(len(msg.raw) > 0)
+	for _, mf := range measurementFields {
+		count(msg.m.Valid.Has(mf.field))
+	}
+	count(msg.tag != nil)
+
+	b = appendHead(b, majorMap, uint64(n))
+	b = appendHead(b, majorUint, fieldVersion)
+	b = appendHead(b, majorUint, Version)
+	if msg.hasTimestamp {
+		b = appendHead(b, majorUint, fieldTimestamp)
+		b = appendInt(b, msg.timestamp)
+	}
+	if msg.address != "" {
+		b = appendHead(b, majorUint, fieldAddress)
+		b = appendText(b, msg.address)
+	}
+	if msg.addressType != ruuvi.AddressUnknown {
+		b = appendHead(b, majorUint, fieldAddressType)
+		b = appendInt(b, int64(msg.addressType))
+	}
+	if msg.rssi != 0 {
+		b = appendHead(b, majorUint, fieldRSSI)
+		b = appendInt(b, msg.rssi)
+	}
+	if msg.receiver != "" {
+		b = appendHead(b, majorUint, fieldReceiver)
+		b = appendText(b, msg.receiver)
+	}
+	if msg.dataFormat != 0 {
+		b = appendHead(b, majorUint, fieldDataFormat)
+		b = appendHead(b, majorUint, msg.dataFormat)
+	}
+	if len(msg.raw) > 0 {
+		b = appendHead(b, majorUint, fieldRaw)
+		b = appendHead(b, majorBytes, uint64(len(msg.raw)))
+		b = append(b, msg.raw...)
+	}
+
+	m := &msg.m
+	for _, mf := range measurementFields {
+		if !m.Valid.Has(mf.field) {
+			continue
+		}
+		b = appendHead(b, majorUint, mf.num)
+		switch mf.kind {
+		case kindFloat:
+			b = appendFloat(b, m.Value(mf.field))
+		case kindInt, kindUint:
+			b = appendInt(b, int64(intValue(m, mf.field)))
+		case kindMAC:
+			b = appendHead(b, majorBytes, uint64(len(m.MACAddress)))
+			b = append(b, m.MACAddress[:]...)
+		}
+	}
+
+	if msg.tag != nil {
+		b = appendHead(b, majorUint, fieldTag)
+		n := 0
+		if msg.tag.Name != "" {
+			n++
+		}
+		if msg.tag.Location != "" {
+			n++
+		}
+		if len(msg.tag.Labels) > 0 {
+			n++
+		}
+		b = appendHead(b, majorMap, uint64(n))
+		if msg.tag.Name != "" {
+			b = appendHead(b, majorUint, fieldTagName)
+			b = appendText(b, msg.tag.Name)
+		}
+		if msg.tag.Location != "" {
+			b = appendHead(b, majorUint, fieldTagLocation)
+			b = appendText(b, msg.tag.Location)
+		}
+		if len(msg.tag.Labels) > 0 {
+			b = appendHead(b, majorUint, fieldTagLabels)
+			b = appendHead(b, majorMap, uint64(len(msg.tag.Labels)))
+			for _, k := range sortedLabels(msg.tag.Labels) {
+				b = appendText(b, k)
+				b = appendText(b, msg.tag.Labels[k])
+			}
+		}
+	}
+	return b
+}
+
+// UnmarshalCBOR decodes a reading encoded as by MarshalCBOR and reconstructs its data, see the package documentation.
+// Any valid encoding of the values is accepted, not only the deterministic one, and float fields may be
+// given as integers. If the measurement fields do not agree with the raw data, the reading is returned
+// with a *ruuvi.MismatchError.
+func UnmarshalCBOR(b []byte) (ruuvi.Reading, error) {
+	d := cborDecoder{b: b}
+	var msg message
+	version := -1
+	err := d.readMap(func(key uint64) error {
+		var err error
+		switch key {
+		case fieldVersion:
+			var v uint64
+			v, err = d.readUint()
+			if err == nil && v != Version {
+				return fmt.Errorf("Unsupported schema version %d", v)
+			}
+			version = int(v)
+		case fieldTimestamp:
+			msg.hasTimestamp = true
+			msg.timestamp, err = d.readInt()
+		case fieldAddress:
+			msg.address, err = d.readText()
+		case fieldAddressType:
+			var v int64
+			v, err = d.readInt()
+			msg.addressType = ruuvi.AddressType(v)
+		case fieldRSSI:
+			msg.rssi, err = d.readInt()
+		case fieldReceiver:
+			msg.receiver, err = d.readText()
+		case fieldDataFormat:
+			msg.dataFormat, err = d.readUint()
+		case fieldRaw:
+			msg.raw, err = d.readBytes()
+		case fieldTag:
+			msg.tag, err = d.readTag()
+		default:
+			return d.readMeasurement(&msg.m, key)
+		}
+		return err
+	})
+	if err != nil {
+		return ruuvi.Reading{}, err
+	}
+	if len(d.b) > 0 {
+		return ruuvi.Reading{}, errors.New("Trailing data after CBOR map")
+	}
+	if version < 0 {
+		return ruuvi.Reading{}, errors.New("No schema version")
+	}
+	return msg.toReading()
+}
+
+// cborDecoder reads CBOR data items from the start of b
+type cborDecoder struct {
+	b []byte
+}
+
+// readHead reads the initial byte of a data item and its argument.
+// Indefinite lengths are not supported, as deterministic encoders do not produce them.
+func (d *cborDecoder) readHead() (major byte, arg uint64, err error) {
+	if len(d.b) == 0 {
+		return 0, 0, errTruncated
+	}
+	major, info := d.b[0]>>5, d.b[0]&0x1f
+	d.b = d.b[1:]
+	var n int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		n = 1
+	case info == 25:
+		n = 2
+	case info == 26:
+		n = 4
+	case info == 27:
+		n = 8
+	default:
+		return 0, 0, fmt.Errorf("Unsupported CBOR additional information %d", info)
+	}
+	if len(d.b) < n {
+		return 0, 0, errTruncated
+	}
+	for _, c := range d.b[:n] {
+		arg = arg<<8 | uint64(c)
+	}
+	d.b = d.b[n:]
+	return major, arg, nil
+}
+
+func (d *cborDecoder) readUint() (uint64, error) {
+	major, arg, err := d.readHead()
+	if err != nil {
+		return 0, err
+	}
+	if major != majorUint {
+		return 0, fmt.Errorf("Expected unsigned integer, got major type %d", major)
+	}
+	return arg, nil
+}
+
+func (d *cborDecoder) readInt() (int64, error) {
+	major, arg, err := d.readHead()
+	if err != nil {
+		return 0, err
+	}
+	return toInt(major, arg)
+}
+
+func toInt(major byte, arg uint64) (int64, error) {
+	if major != majorUint && major != majorNegInt {
+		return 0, fmt.Errorf("Expected integer, got major type %d", major)
+	}
+	if arg > math.MaxInt64 {
+		return 0, errors.New("Integer overflows int64")
+	}
+	if major == majorNegInt {
+		return -1 - int64(arg), nil
+	}
+	return int64(arg), nil
+}
+
+func (d *cborDecoder) readFloat() (float64, error) {
+	if len(d.b) > 0 && d.b[0]>>5 != majorSimple {
+		v, err := d.readInt()
+		return float64(v), err
+	}
+	var info byte
+	if len(d.b) > 0 {
+		info = d.b[0] & 0x1f
+	}
+	_, arg, err := d.readHead()
+	if err != nil {
+		return 0, err
+	}
+	switch info {
+	case 25:
+		return halfToFloat(uint16(arg)), nil
+	case 26:
+		return float64(math.Float32frombits(uint32(arg))), nil
+	case 27:
+		return math.Float64frombits(arg), nil
+	}
+	return 0, fmt.Errorf("Expected float, got simple value %d", arg)
+}
+
+// readString reads the content of a byte or text string of given major type
+func (d *cborDecoder) readString(want byte) ([]byte, error) {
+	major, arg, err := d.readHead()
+	if err != nil {
+		return nil, err
+	}
+	if major != want {
+		return nil, fmt.Errorf("Expected major type %d, got %d", want, major)
+	}
+	if arg > uint64(len(d.b)) {
+		return nil, errTruncated
+	}
+	s := d.b[:arg]
+	d.b = d.b[arg:]
+	return s, nil
+}
+
+func (d *cborDecoder) readText() (string, error) {
+	s, err := d.readString(majorText)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(s) {
+		return "", errors.New("Invalid UTF-8 in text string")
+	}
+	return string(s), nil
+}
+
+func (d *cborDecoder) readBytes() ([]byte, error) {
+	return d.readString(majorBytes)
+}
+
+// readMap reads a map with unsigned integer keys, calling fn to read the value of each key
+func (d *cborDecoder) readMap(fn func(key uint64) error) error {
+	major, n, err := d.readHead()
+	if err != nil {
+		return err
+	}
+	if major != majorMap {
+		return fmt.Errorf("Expected map, got major type %d", major)
+	}
+	for i := uint64(0); i < n; i++ {
+		key, err := d.readUint()
+		if err != nil {
+			return err
+		}
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skip skips a data item of any type
+func (d *cborDecoder) skip(depth int) error {
+	if depth > maxCBORDepth {
+		return errors.New("CBOR data nested too deep")
+	}
+	major, arg, err := d.readHead()
+	if err != nil {
+		return err
+	}
+	switch major {
+	case majorBytes, majorText:
+		if arg > uint64(len(d.b)) {
+			return errTruncated
+		}
+		d.b = d.b[arg:]
+	case majorArray, majorMap:
+		if major == majorMap {
+			if arg > math.MaxUint64/2 {
+				return errTruncated
+			}
+			arg *= 2
+		}
+		for i := uint64(0); i < arg; i++ {
+			if err := d.skip(depth + 1); err != nil {
+				return err
+			}
+		}
+	case majorTag:
+		return d.skip(depth + 1)
+	}
+	return nil
+}
+
+func (d *cborDecoder) readMeasurement(m *ruuvi.Measurements, key uint64) error {
+	for _, mf := range measurementFields {
+		if mf.num != key {
+			continue
+		}
+		var err error
+		switch mf.kind {
+		case kindFloat:
+			var v float64
+			if v, err = d.readFloat(); err == nil {
+				m.SetValue(mf.field, v)
+			}
+		case kindInt, kindUint:
+			var v int
+			if v, err = d.readInt32(); err == nil {
+				m.SetValue(mf.field, float64(v))
+			}
+		case kindMAC:
+			var mac []byte
+			if mac, err = d.readBytes(); err == nil && len(mac) != len(m.MACAddress) {
+				err = fmt.Errorf("Invalid MAC address length %d", len(mac))
+			}
+			if err == nil {
+				copy(m.MACAddress[:], mac)
+				m.Set(mf.field)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid %s: %w", mf.field, err)
+		}
+		return nil
+	}
+	return d.skip(0)
+}
+
+// readInt32 reads an integer which must fit in the int32 and uint32 types of the protobuf schema
+func (d *cborDecoder) readInt32() (int, error) {
+	v, err := d.readInt()
+	if err != nil {
+		return 0, err
+	}
+	if v < math.MinInt32 || v > math.MaxUint32 {
+		return 0, fmt.Errorf("Integer %d out of range", v)
+	}
+	return int(v), nil
+}
+
+func (d *cborDecoder) readTag() (*ruuvi.TagInfo, error) {
+	tag := &ruuvi.TagInfo{}
+	err := d.readMap(func(key uint64) error {
+		var err error
+		switch key {
+		case fieldTagName:
+			tag.Name, err = d.readText()
+		case fieldTagLocation:
+			tag.Location, err = d.readText()
+		case fieldTagLabels:
+			major, n, err := d.readHead()
+			if err != nil {
+				return err
+			}
+			if major != majorMap {
+				return fmt.Errorf("Expected map of labels, got major type %d", major)
+			}
+			tag.Labels = make(map[string]string)
+			for i := uint64(0); i < n; i++ {
+				k, err := d.readText()
+				if err != nil {
+					return err
+				}
+				if tag.Labels[k], err = d.readText(); err != nil {
+					return err
+				}
+			}
+		default:
+			err = d.skip(0)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// appendHead appends the initial byte of a data item of major type with argument v in shortest form
+func appendHead(b []byte, major byte, v uint64) []byte {
+	major <<= 5
+	switch {
+	case v < 24:
+		return append(b, major|byte(v))
+	case v <= math.MaxUint8:
+		return append(b, major|24, byte(v))
+	case v <= math.MaxUint16:
+		return append(b, major|25, byte(v>>8), byte(v))
+	case v <= math.MaxUint32:
+		return append(b, major|26, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(append(b, major|27), buf[:]...)
+}
+
+func appendInt(b []byte, v int64) []byte {
+	if v < 0 {
+		return appendHead(b, majorNegInt, uint64(-1-v))
+	}
+	return appendHead(b, majorUint, uint64(v))
+}
+
+func appendText(b []byte, s string) []byte {
+	b = appendHead(b, majorText, uint64(len(s)))
+	return append(b, s...)
+}
+
+// appendFloat appends v as a half, single or double precision float, whichever is shortest and exact
+func appendFloat(b []byte, v float64) []byte {
+	if h, ok := floatToHalf(v); ok {
+		return append(b, majorSimple<<5|25, byte(h>>8), byte(h))
+	}
+	if f := float32(v); float64(f) == v {
+		bits := math.Float32bits(f)
+		return append(b, majorSimple<<5|26, byte(bits>>24), byte(bits>>16), byte(bits>>8), byte(bits))
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], math.Float64bits(v))
+	return append(append(b, majorSimple<<5|27), buf[:]...)
+}
+
+// floatToHalf returns v as an IEEE 754 half precision float, if it can be represented exactly
+func floatToHalf(v float64) (uint16, bool) {
+	f := float32(v)
+	if float64(f) != v {
+		return 0, false
+	}
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23&0xff) - 127
+	mant := bits & 0x7fffff
+	switch {
+	case bits&0x7fffffff == 0:
+		return sign, true
+	case exp == 128 && mant == 0:
+		return sign | 0x7c00, true
+	case exp >= -14 && exp <= 15:
+		if mant&0x1fff != 0 {
+			return 0, false
+		}
+		return sign | uint16(exp+15)<<10 | uint16(mant>>13), true
+	case exp >= -24 && exp < -14:
+		// subnormal, value is full * 2^(exp-23) = (full >> shift) * 2^-24
+		full := mant | 1<<23
+		shift := uint(-1 - exp)
+		if full&(1<<shift-1) != 0 {
+			return 0, false
+		}
+		return sign | uint16(full>>shift), true
+	}
+	return 0, false
+}
+
+// halfToFloat converts an IEEE 754 half precision float, see RFC 8949 appendix D
+func halfToFloat(h uint16) float64 {
+	exp, mant := int(h>>10&0x1f), float64(h&0x3ff)
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -v
+	}
+	return v
+}
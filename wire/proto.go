@@ -0,0 +1,326 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf8"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// MarshalProto encodes r as a ruuvi.v1.Reading protobuf message.
+// A reading without data is encoded with receive metadata only.
+func MarshalProto(r ruuvi.Reading) []byte {
+	return AppendProto(nil, r)
+}
+
+// AppendProto appends r encoded as by MarshalProto to b
+func AppendProto(b []byte, r ruuvi.Reading) []byte {
+	msg := fromReading(r)
+	return msg.appendProto(b)
+}
+
+func (msg *message) appendProto(b []byte) []byte {
+	if msg.hasTimestamp {
+		b = appendTag(b, fieldTimestamp, wireVarint)
+		b = appendVarint(b, uint64(msg.timestamp))
+	}
+	b = appendString(b, fieldAddress, msg.address)
+	if msg.addressType != ruuvi.AddressUnknown {
+		b = appendTag(b, fieldAddressType, wireVarint)
+		b = appendVarint(b, uint64(msg.addressType))
+	}
+	if msg.rssi != 0 {
+		b = appendTag(b, fieldRSSI, wireVarint)
+		b = appendVarint(b, uint64(msg.rssi<<1)^uint64(msg.rssi>>63))
+	}
+	b = appendString(b, fieldReceiver, msg.receiver)
+	if msg.dataFormat != 0 {
+		b = appendTag(b, fieldDataFormat, wireVarint)
+		b = appendVarint(b, msg.dataFormat)
+	}
+	if len(msg.raw) > 0 {
+		b = appendTag(b, fieldRaw, wireBytes)
+		b = appendVarint(b, uint64(len(msg.raw)))
+		b = append(b, msg.raw...)
+	}
+
+	m := &msg.m
+	for _, mf := range measurementFields {
+		if !m.Valid.Has(mf.field) {
+			continue
+		}
+		switch mf.kind {
+		case kindFloat:
+			b = appendTag(b, mf.num, wireFixed64)
+			b = appendFixed64(b, math.Float64bits(m.Value(mf.field)))
+		case kindInt:
+			b = appendTag(b, mf.num, wireVarint)
+			b = appendVarint(b, uint64(int64(int32(intValue(m, mf.field)))))
+		case kindUint:
+			b = appendTag(b, mf.num, wireVarint)
+			b = appendVarint(b, uint64(uint32(intValue(m, mf.field))))
+		case kindMAC:
+			b = appendTag(b, mf.num, wireBytes)
+			b = appendVarint(b, uint64(len(m.MACAddress)))
+			b = append(b, m.MACAddress[:]...)
+		}
+	}
+
+	if msg.tag != nil {
+		var tag []byte
+		tag = appendString(tag, fieldTagName, msg.tag.Name)
+		tag = appendString(tag, fieldTagLocation, msg.tag.Location)
+		for _, k := range sortedLabels(msg.tag.Labels) {
+			var entry []byte
+			entry = appendString(entry, 1, k)
+			entry = appendString(entry, 2, msg.tag.Labels[k])
+			tag = appendTag(tag, fieldTagLabels, wireBytes)
+			tag = appendVarint(tag, uint64(len(entry)))
+			tag = append(tag, entry...)
+		}
+		b = appendTag(b, fieldTag, wireBytes)
+		b = appendVarint(b, uint64(len(tag)))
+		b = append(b, tag...)
+	}
+	return b
+}
+
+// UnmarshalProto decodes a ruuvi.v1.Reading protobuf message into a reading and reconstructs its data,
+// see the package documentation. If the measurement fields do not agree with the raw data,
+// the reading is returned with a *ruuvi.MismatchError.
+func UnmarshalProto(b []byte) (ruuvi.Reading, error) {
+	var msg message
+	err := walkProto(b, func(num, v uint64, data []byte) error {
+		switch num {
+		case fieldTimestamp:
+			msg.hasTimestamp = true
+			msg.timestamp = int64(v)
+		case fieldAddress:
+			return protoString(&msg.address, num, data)
+		case fieldAddressType:
+			msg.addressType = ruuvi.AddressType(int32(v))
+		case fieldRSSI:
+			msg.rssi = int64(int32(uint32(v>>1) ^ -uint32(v&1)))
+		case fieldReceiver:
+			return protoString(&msg.receiver, num, data)
+		case fieldDataFormat:
+			msg.dataFormat = uint64(uint32(v))
+		case fieldRaw:
+			msg.raw = data
+		case fieldTag:
+			tag, err := unmarshalTagProto(data)
+			if err != nil {
+				return err
+			}
+			msg.tag = tag
+		default:
+			return setMeasurementProto(&msg.m, num, v, data)
+		}
+		return nil
+	}, protoTypes)
+	if err != nil {
+		return ruuvi.Reading{}, err
+	}
+	return msg.toReading()
+}
+
+// protoTypes returns the wire type of known field num of the ruuvi.v1.Reading message, or -1 if not known
+func protoTypes(num uint64) int {
+	switch num {
+	case fieldTimestamp, fieldAddressType, fieldRSSI, fieldDataFormat:
+		return wireVarint
+	case fieldAddress, fieldReceiver, fieldRaw, fieldTag:
+		return wireBytes
+	}
+	for _, mf := range measurementFields {
+		if mf.num != num {
+			continue
+		}
+		switch mf.kind {
+		case kindFloat:
+			return wireFixed64
+		case kindMAC:
+			return wireBytes
+		default:
+			return wireVarint
+		}
+	}
+	return -1
+}
+
+func setMeasurementProto(m *ruuvi.Measurements, num, v uint64, data []byte) error {
+	for _, mf := range measurementFields {
+		if mf.num != num {
+			continue
+		}
+		switch mf.kind {
+		case kindFloat:
+			m.SetValue(mf.field, math.Float64frombits(v))
+		case kindInt:
+			m.SetValue(mf.field, float64(int32(v)))
+		case kindUint:
+			m.SetValue(mf.field, float64(uint32(v)))
+		case kindMAC:
+			if len(data) != len(m.MACAddress) {
+				return fmt.Errorf("Invalid MAC address length %d", len(data))
+			}
+			copy(m.MACAddress[:], data)
+			m.Set(mf.field)
+		}
+		return nil
+	}
+	return nil
+}
+
+func unmarshalTagProto(b []byte) (*ruuvi.TagInfo, error) {
+	tag := &ruuvi.TagInfo{}
+	err := walkProto(b, func(num, v uint64, data []byte) error {
+		switch num {
+		case fieldTagName:
+			return protoString(&tag.Name, num, data)
+		case fieldTagLocation:
+			return protoString(&tag.Location, num, data)
+		case fieldTagLabels:
+			var key, value string
+			err := walkProto(data, func(num, v uint64, data []byte) error {
+				if num == 1 {
+					return protoString(&key, num, data)
+				}
+				return protoString(&value, num, data)
+			}, func(num uint64) int {
+				if num == 1 || num == 2 {
+					return wireBytes
+				}
+				return -1
+			})
+			if err != nil {
+				return err
+			}
+			if tag.Labels == nil {
+				tag.Labels = make(map[string]string)
+			}
+			tag.Labels[key] = value
+		}
+		return nil
+	}, func(num uint64) int {
+		if num == fieldTagName || num == fieldTagLocation || num == fieldTagLabels {
+			return wireBytes
+		}
+		return -1
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// walkProto calls fn with each known field of protobuf message b. types returns the wire type of
+// known fields and -1 for unknown ones, which are skipped. Length delimited values are given as data,
+// which refers to b, and other values as v.
+func walkProto(b []byte, fn func(num, v uint64, data []byte) error, types func(num uint64) int) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errTruncated
+		}
+		b = b[n:]
+		num, typ := key>>3, int(key&7)
+		if num == 0 {
+			return errors.New("Invalid field number 0")
+		}
+
+		var (
+			v    uint64
+			data []byte
+		)
+		switch typ {
+		case wireVarint:
+			v, n = binary.Uvarint(b)
+			if n <= 0 {
+				return errTruncated
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return errTruncated
+			}
+			v = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return errTruncated
+			}
+			v = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || l > uint64(len(b)-n) {
+				return errTruncated
+			}
+			data = b[n : n+int(l)]
+			b = b[n+int(l):]
+		default:
+			return fmt.Errorf("Unsupported wire type %d of field %d", typ, num)
+		}
+
+		want := types(num)
+		if want < 0 {
+			continue
+		}
+		if typ != want {
+			return fmt.Errorf("Invalid wire type %d of field %d, expected %d", typ, num, want)
+		}
+		if err := fn(num, v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// protoString sets s to string field num, which proto3 requires to be valid UTF-8
+func protoString(s *string, num uint64, data []byte) error {
+	if !utf8.Valid(data) {
+		return fmt.Errorf("Invalid UTF-8 in field %d", num)
+	}
+	*s = string(data)
+	return nil
+}
+
+func appendTag(b []byte, num uint64, typ int) []byte {
+	return appendVarint(b, num<<3|uint64(typ))
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendFixed64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// appendString appends string field num, unless s is empty
+func appendString(b []byte, num uint64, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = appendTag(b, num, wireBytes)
+	b = appendVarint(b, uint64(len(s)))
+	return append(b, s...)
+}
@@ -0,0 +1,224 @@
+// Package wire encodes readings compactly for links where JSON is too large: as protobuf messages
+// of the ruuvi.v1.Reading schema in reading.proto, or as CBOR for constrained devices.
+//
+// Both encodings carry every measurement field of every supported data format as typed values,
+// the raw data, and the receive metadata of the reading. The CBOR encoding is a map with the protobuf
+// field numbers as keys, and key 0 holding the schema version:
+//
+//	{0: 1, 2: "C5:1A:2B:3C:4D:5E", 4: -60, 6: 5, 7: h'0512fc…', 8: 24.3, …}
+//
+// Fields are left out when they have no value, so that an invalid or unsupported measurement
+// is simply missing. Encodings are deterministic: the same reading always gives the same bytes.
+//
+// When decoding, the data is reconstructed from the raw data if it is present, and the data format and
+// measurement fields are compared with it like ruuvi.UnmarshalAdvertisementData does. To save space, senders
+// may leave out either the raw data, in which case the data is reconstructed from the measurement fields
+// with ruuvi.Encode, or the data format and all measurement fields, in which case nothing is compared.
+// Unknown fields are ignored, so that readers keep working when fields are added to the schema.
+package wire
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+// Version is the schema version, the CBOR encoding stores it under key 0
+const Version = 1
+
+// field numbers of the ruuvi.v1.Reading message, also used as CBOR map keys
+const (
+	fieldVersion     = 0 // CBOR only
+	fieldTimestamp   = 1
+	fieldAddress     = 2
+	fieldAddressType = 3
+	fieldRSSI        = 4
+	fieldReceiver    = 5
+	fieldDataFormat  = 6
+	fieldRaw         = 7
+	fieldTag         = 19
+)
+
+// field numbers of the ruuvi.v1.TagInfo message
+const (
+	fieldTagName     = 1
+	fieldTagLocation = 2
+	fieldTagLabels   = 3
+)
+
+// kind is how a measurement field is encoded
+type kind int
+
+const (
+	kindFloat kind = iota // protobuf double, CBOR float
+	kindInt               // protobuf int32, CBOR integer
+	kindUint              // protobuf uint32, CBOR unsigned integer
+	kindMAC               // protobuf bytes, CBOR byte string, 6 bytes
+)
+
+// measurementFields lists the field numbers of the measurement fields of the ruuvi.v1.Reading message
+var measurementFields = []struct {
+	num   uint64
+	field ruuvi.Field
+	kind  kind
+}{
+	{8, ruuvi.FieldTemperature, kindFloat},
+	{9, ruuvi.FieldHumidity, kindFloat},
+	{10, ruuvi.FieldPressure, kindInt},
+	{11, ruuvi.FieldAccelerationX, kindFloat},
+	{12, ruuvi.FieldAccelerationY, kindFloat},
+	{13, ruuvi.FieldAccelerationZ, kindFloat},
+	{14, ruuvi.FieldBatteryVoltage, kindFloat},
+	{15, ruuvi.FieldTransmissionPower, kindFloat},
+	{16, ruuvi.FieldMovementCounter, kindUint},
+	{17, ruuvi.FieldMeasurementSequenceNumber, kindUint},
+	{18, ruuvi.FieldMACAddress, kindMAC},
+}
+
+// message is the content of a ruuvi.v1.Reading message
+type message struct {
+	hasTimestamp bool
+	timestamp    int64
+	address      string
+	addressType  ruuvi.AddressType
+	rssi         int64
+	receiver     string
+	dataFormat   uint64
+	raw          []byte
+	m            ruuvi.Measurements
+	tag          *ruuvi.TagInfo
+}
+
+func fromReading(r ruuvi.Reading) message {
+	msg := message{
+		address:     r.Address(),
+		addressType: r.AddressType,
+		rssi:        int64(r.RSSI),
+		receiver:    r.Receiver,
+		tag:         r.Tag,
+	}
+	if !r.Timestamp.IsZero() {
+		msg.hasTimestamp = true
+		msg.timestamp = r.Timestamp.UnixNano()
+	}
+	if r.Data != nil {
+		msg.dataFormat = uint64(byte(r.Data.DataFormat()))
+		msg.raw = r.Data.RawData()
+		msg.m = ruuvi.MeasurementsOf(r.Data)
+	}
+	return msg
+}
+
+// toReading converts msg to a reading, reconstructing its data.
+// If the measurement fields do not agree with the raw data, the reading is returned with a *ruuvi.MismatchError.
+func (msg *message) toReading() (ruuvi.Reading, error) {
+	r := ruuvi.Reading{
+		MAC:         msg.address,
+		AddressType: msg.addressType,
+		RSSI:        int(msg.rssi),
+		Receiver:    msg.receiver,
+		Tag:         msg.tag,
+	}
+	if msg.hasTimestamp {
+		r.Timestamp = time.Unix(0, msg.timestamp).UTC()
+	}
+	if msg.dataFormat > math.MaxUint8 {
+		return ruuvi.Reading{}, fmt.Errorf("Invalid data format %d", msg.dataFormat)
+	}
+	msg.m.DataFormat = int8(msg.dataFormat)
+
+	switch {
+	case len(msg.raw) > 0:
+		data := make([]byte, 2, 2+len(msg.raw))
+		data[0], data[1] = 0x99, 0x04
+		d, err := ruuvi.ProcessAdvertisement(append(data, msg.raw...))
+		if err != nil {
+			return ruuvi.Reading{}, err
+		}
+		r.Data = d
+		if msg.dataFormat == 0 && msg.m.Valid == 0 {
+			// raw data only
+			break
+		}
+		if mismatches := compare(msg.m, ruuvi.MeasurementsOf(d)); len(mismatches) > 0 {
+			return r, &ruuvi.MismatchError{Mismatches: mismatches}
+		}
+	case msg.dataFormat != 0 || msg.m.Valid != 0:
+		b, err := ruuvi.Encode(msg.m)
+		if err != nil {
+			return ruuvi.Reading{}, err
+		}
+		d, err := ruuvi.ProcessAdvertisement(b)
+		if err != nil {
+			return ruuvi.Reading{}, err
+		}
+		r.Data = d
+	}
+	return r, nil
+}
+
+// compare returns the fields of stored which do not agree with decoded
+func compare(stored, decoded ruuvi.Measurements) []ruuvi.Mismatch {
+	var mismatches []ruuvi.Mismatch
+	if stored.DataFormat != decoded.DataFormat {
+		mismatches = append(mismatches, ruuvi.Mismatch{
+			Field:   "format",
+			Stored:  strconv.Itoa(int(stored.DataFormat)),
+			Decoded: strconv.Itoa(int(decoded.DataFormat)),
+		})
+	}
+	for _, f := range ruuvi.Fields() {
+		s, d := valueString(stored, f), valueString(decoded, f)
+		if s == d {
+			continue
+		}
+		if stored.Valid.Has(f) && decoded.Valid.Has(f) && f != ruuvi.FieldMACAddress {
+			// allow for rounding by senders which computed the values themselves
+			sv, dv := stored.Value(f), decoded.Value(f)
+			if math.Abs(sv-dv) <= 1e-9*math.Max(1, math.Abs(dv)) {
+				continue
+			}
+		}
+		mismatches = append(mismatches, ruuvi.Mismatch{Field: f.String(), Stored: s, Decoded: d})
+	}
+	return mismatches
+}
+
+// valueString returns field f of m formatted like JSON, or nothing if f is not valid
+func valueString(m ruuvi.Measurements, f ruuvi.Field) string {
+	if !m.Valid.Has(f) {
+		return ""
+	}
+	if f == ruuvi.FieldMACAddress {
+		return strconv.Quote(m.MACAddress.String())
+	}
+	return strconv.FormatFloat(m.Value(f), 'g', -1, 64)
+}
+
+// sortedLabels returns the keys of labels in the order of their CBOR encoding: shorter first, then lexically,
+// which is sorted order of the encoded keys as required for deterministic CBOR
+func sortedLabels(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) < len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+var errTruncated = errors.New("Truncated data")
+
+// intValue returns integer field f of m
+func intValue(m *ruuvi.Measurements, f ruuvi.Field) int {
+	return int(m.Value(f))
+}
@@ -0,0 +1,426 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/LassiHeikkila/go-ruuvi/ruuvi"
+)
+
+var compareData = cmp.Comparer(func(a, b ruuvi.AdvertisementData) bool {
+	return bytes.Equal(a.RawData(), b.RawData())
+})
+
+func decodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func reading(t *testing.T, raw string) ruuvi.Reading {
+	t.Helper()
+	d, err := ruuvi.ProcessAdvertisement(decodeHex(t, "9904"+raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ruuvi.Reading{
+		Timestamp:   time.Date(2021, 3, 4, 5, 6, 7, 8000000, time.UTC),
+		MAC:         "C5:1A:2B:3C:4D:5E",
+		AddressType: ruuvi.AddressRandom,
+		RSSI:        -60,
+		Receiver:    "gw1",
+		Data:        d,
+		Tag:         &ruuvi.TagInfo{Name: "Sauna", Location: "Home", Labels: map[string]string{"floor": "1", "a": "b"}},
+	}
+}
+
+// golden encodings lock the wire format: changing them breaks every reader and stored message
+var golden = []struct {
+	name  string
+	raw   string
+	proto string
+	cbor  string
+}{
+	{
+		name: "RAWv2",
+		raw:  "0512FC5394C37C0004FFFC040CAC364200CDCBB8334C884F",
+		proto: "088090eb84d1e9c2b416" + "121143353a31413a32423a33433a34443a3545" + "1802" + "2077" + "2a03677731" + "3005" +
+			"3a180512fc5394c37c0004fffc040cac364200cdcbb8334c884f" +
+			"41cdcccccccc4c3840" + "491f85eb51b8be4a40" + "50cc8d06" + "59fca9f1d24d62703f" + "61fca9f1d24d6270bf" +
+			"69fa7e6abc7493f03f" + "7138894160e5d00740" + "790000000000001040" + "800142" + "8801cd01" + "920106cbb8334c884f" +
+			"9a01210a055361756e611204486f6d651a060a01611201621a0a0a05666c6f6f72120131",
+		cbor: "b4" + "0001" + "011b16690b4d109ac800" + "027143353a31413a32423a33433a34443a3545" + "0302" + "04383b" + "0563677731" + "0605" +
+			"0758180512fc5394c37c0004fffc040cac364200cdcbb8334c884f" +
+			"08fb40384ccccccccccd" + "09fb404abeb851eb851f" + "0a1a000186cc" + "0bfb3f70624dd2f1a9fc" + "0cfbbf70624dd2f1a9fc" +
+			"0dfb3ff09374bc6a7efa" + "0efb4007d0e560418938" + "0ff94400" + "101842" + "1118cd" + "1246cbb8334c884f" +
+			"13a301655361756e610264486f6d6503a26161616265666c6f6f726131",
+	},
+	{
+		name: "RAWv1",
+		raw:  "03291A1ECE1EFC18F94202CA0B53",
+		proto: "088090eb84d1e9c2b416" + "121143353a31413a32423a33433a34443a3545" + "1802" + "2077" + "2a03677731" + "3003" +
+			"3a0e03291a1ece1efc18f94202ca0b53" +
+			"41cdcccccccc4c3a40" + "490000000000803440" + "50eea206" + "59000000000000f0bf" + "6104560e2db29dfbbf" +
+			"690c022b8716d9e63f" + "71fed478e926310740" +
+			"9a01210a055361756e611204486f6d651a060a01611201621a0a0a05666c6f6f72120131",
+		cbor: "b0" + "0001" + "011b16690b4d109ac800" + "027143353a31413a32423a33433a34443a3545" + "0302" + "04383b" + "0563677731" + "0603" +
+			"074e03291a1ece1efc18f94202ca0b53" +
+			"08fb403a4ccccccccccd" + "09f94d20" + "0a1a0001916e" + "0bf9bc00" + "0cfbbffb9db22d0e5604" +
+			"0dfb3fe6d916872b020c" + "0efb40073126e978d4fe" +
+			"13a301655361756e610264486f6d6503a26161616265666c6f6f726131",
+	},
+	{
+		name: "RAWv2 all invalid",
+		raw:  "058000FFFFFFFF800080008000FFFFFFFFFFFFFFFFFFFFFF",
+		proto: "088090eb84d1e9c2b416" + "121143353a31413a32423a33433a34443a3545" + "1802" + "2077" + "2a03677731" + "3005" +
+			"3a18058000ffffffff800080008000ffffffffffffffffffffff" +
+			"9a01210a055361756e611204486f6d651a060a01611201621a0a0a05666c6f6f72120131",
+		cbor: "a9" + "0001" + "011b16690b4d109ac800" + "027143353a31413a32423a33433a34443a3545" + "0302" + "04383b" + "0563677731" + "0605" +
+			"075818058000ffffffff800080008000ffffffffffffffffffffff" +
+			"13a301655361756e610264486f6d6503a26161616265666c6f6f726131",
+	},
+}
+
+func TestGolden(t *testing.T) {
+	for _, g := range golden {
+		t.Run(g.name, func(t *testing.T) {
+			r := reading(t, g.raw)
+
+			if got := hex.EncodeToString(MarshalProto(r)); got != g.proto {
+				t.Errorf("protobuf encoding changed:\nexpected %s\ngot      %s", g.proto, got)
+			}
+			if got := hex.EncodeToString(MarshalCBOR(r)); got != g.cbor {
+				t.Errorf("CBOR encoding changed:\nexpected %s\ngot      %s", g.cbor, got)
+			}
+
+			u, err := UnmarshalProto(decodeHex(t, g.proto))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(r, u, compareData); diff != "" {
+				t.Error("protobuf round trip:", diff)
+			}
+			u, err = UnmarshalCBOR(decodeHex(t, g.cbor))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(r, u, compareData); diff != "" {
+				t.Error("CBOR round trip:", diff)
+			}
+		})
+	}
+}
+
+func TestAppend(t *testing.T) {
+	r := reading(t, golden[0].raw)
+	prefix := []byte{1, 2, 3}
+	if b := AppendProto(prefix, r); !bytes.Equal(b[:3], prefix) || !bytes.Equal(b[3:], MarshalProto(r)) {
+		t.Error("AppendProto did not append to the given slice")
+	}
+	if b := AppendCBOR(prefix, r); !bytes.Equal(b[:3], prefix) || !bytes.Equal(b[3:], MarshalCBOR(r)) {
+		t.Error("AppendCBOR did not append to the given slice")
+	}
+}
+
+func TestWithoutData(t *testing.T) {
+	for _, r := range []ruuvi.Reading{
+		{},
+		{MAC: "C5:1A:2B:3C:4D:5E", RSSI: 10},
+		{Timestamp: time.Unix(0, 0).UTC(), Tag: &ruuvi.TagInfo{}},
+	} {
+		u, err := UnmarshalProto(MarshalProto(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(r, u); diff != "" {
+			t.Error("protobuf round trip:", diff)
+		}
+		u, err = UnmarshalCBOR(MarshalCBOR(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(r, u); diff != "" {
+			t.Error("CBOR round trip:", diff)
+		}
+	}
+
+	if got := hex.EncodeToString(MarshalCBOR(ruuvi.Reading{})); got != "a10001" {
+		t.Errorf("expected only the version for empty reading, got %s", got)
+	}
+	if got := MarshalProto(ruuvi.Reading{}); len(got) != 0 {
+		t.Errorf("expected empty message for empty reading, got %x", got)
+	}
+}
+
+// TestWithoutRaw checks that data is reconstructed from the measurement fields when senders leave out the raw data
+func TestWithoutRaw(t *testing.T) {
+	for name, b := range map[string]func() (ruuvi.Reading, error){
+		"protobuf": func() (ruuvi.Reading, error) {
+			// data_format 5, temperature 24.3, pressure 100044
+			return UnmarshalProto(decodeHex(t, "3005"+"41cdcccccccc4c3840"+"50cc8d06"))
+		},
+		"CBOR": func() (ruuvi.Reading, error) {
+			// {0: 1, 6: 5, 8: 24.3, 10: 100044}
+			return UnmarshalCBOR(decodeHex(t, "a4"+"0001"+"0605"+"08fb40384ccccccccccd"+"0a1a000186cc"))
+		},
+		"CBOR with integer float": func() (ruuvi.Reading, error) {
+			// {0: 1, 6: 5, 8: 24, 10: 100044}
+			return UnmarshalCBOR(decodeHex(t, "a4"+"0001"+"0605"+"0818"+"18"+"0a1a000186cc"))
+		},
+	} {
+		r, err := b()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if r.Data == nil || r.Data.DataFormat() != 5 {
+			t.Fatalf("%s: expected RAWv2 data, got %v", name, r.Data)
+		}
+		temp := 24.3
+		if name == "CBOR with integer float" {
+			temp = 24
+		}
+		if v, err := r.Data.Temperature(); err != nil || v != temp {
+			t.Errorf("%s: expected temperature %v, got %v, %v", name, temp, v, err)
+		}
+		if v, err := r.Data.Pressure(); err != nil || v != 100044 {
+			t.Errorf("%s: expected pressure 100044, got %v, %v", name, v, err)
+		}
+		if _, err := r.Data.Humidity(); !errors.Is(err, ruuvi.ErrInvalidValue) {
+			t.Errorf("%s: expected invalid humidity, got %v", name, err)
+		}
+	}
+}
+
+func TestMismatch(t *testing.T) {
+	expected := []ruuvi.Mismatch{
+		{Field: "format", Stored: "3", Decoded: "5"},
+		{Field: "temperature", Stored: "30", Decoded: "24.3"},
+		{Field: "humidity", Stored: "", Decoded: "53.49"},
+	}
+	r := reading(t, golden[0].raw)
+	msg := fromReading(r)
+	msg.dataFormat = 3
+	msg.m.Temperature = 30
+	msg.m.Valid &^= ruuvi.FieldHumidity
+
+	for name, b := range map[string]func() (ruuvi.Reading, error){
+		"protobuf": func() (ruuvi.Reading, error) { return UnmarshalProto(msg.appendProto(nil)) },
+		"CBOR":     func() (ruuvi.Reading, error) { return UnmarshalCBOR(msg.appendCBOR(nil)) },
+	} {
+		u, err := b()
+		var mismatch *ruuvi.MismatchError
+		if !errors.As(err, &mismatch) {
+			t.Fatalf("%s: expected *MismatchError, got %v", name, err)
+		}
+		if diff := cmp.Diff(expected, mismatch.Mismatches); diff != "" {
+			t.Errorf("%s: %s", name, diff)
+		}
+		if diff := cmp.Diff(r, u, compareData); diff != "" {
+			t.Errorf("%s: expected reading to be reconstructed from raw data: %s", name, diff)
+		}
+	}
+
+	// rounded values are accepted
+	msg = fromReading(r)
+	msg.m.Temperature += 1e-12
+	if _, err := UnmarshalProto(msg.appendProto(nil)); err != nil {
+		t.Error("rounded temperature:", err)
+	}
+}
+
+// TestRawOnly checks that nothing is compared when senders leave out the measurement fields
+func TestRawOnly(t *testing.T) {
+	r := reading(t, golden[0].raw)
+	msg := fromReading(r)
+	msg.dataFormat = 0
+	msg.m = ruuvi.Measurements{}
+
+	u, err := UnmarshalProto(msg.appendProto(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(r, u, compareData); diff != "" {
+		t.Error("protobuf:", diff)
+	}
+	u, err = UnmarshalCBOR(msg.appendCBOR(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(r, u, compareData); diff != "" {
+		t.Error("CBOR:", diff)
+	}
+}
+
+func TestUnknownFields(t *testing.T) {
+	r := reading(t, golden[0].raw)
+
+	// field 100 as varint, fixed32, fixed64 and bytes
+	p := append(MarshalProto(r), 0xa0, 0x06, 0x01, 0xa5, 0x06, 1, 2, 3, 4, 0xa1, 0x06, 1, 2, 3, 4, 5, 6, 7, 8, 0xa2, 0x06, 0x01, 0xff)
+	u, err := UnmarshalProto(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(r, u, compareData); diff != "" {
+		t.Error("protobuf:", diff)
+	}
+
+	// key 100 with a nested value, which must be sorted last
+	c := MarshalCBOR(r)
+	c[0]++
+	c = append(c, 0x18, 100, 0xa1, 0x01, 0x82, 0xc1, 0x00, 0x63, 'a', 'b', 'c')
+	u, err = UnmarshalCBOR(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(r, u, compareData); diff != "" {
+		t.Error("CBOR:", diff)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	r := reading(t, golden[0].raw)
+	p, c := MarshalProto(r), MarshalCBOR(r)
+
+	for name, b := range map[string][]byte{
+		"truncated":          p[:len(p)-1],
+		"truncated varint":   {0x08, 0x80},
+		"field number 0":     {0x00, 0x00},
+		"wrong wire type":    {0x09, 1, 2, 3, 4, 5, 6, 7, 8},
+		"group":              {0x0b},
+		"invalid UTF-8":      {0x12, 0x01, 0xff},
+		"MAC length":         {0x92, 0x01, 0x01, 0xff},
+		"invalid raw data":   {0x3a, 0x02, 0x05, 0x00},
+		"data format range":  {0x30, 0x80, 0x02},
+		"unsupported format": {0x30, 0x04},
+	} {
+		if _, err := UnmarshalProto(b); err == nil {
+			t.Errorf("protobuf %s: expected error", name)
+		}
+	}
+
+	for name, b := range map[string][]byte{
+		"empty":               {},
+		"truncated":           c[:len(c)-1],
+		"not a map":           {0x80},
+		"no version":          {0xa0},
+		"unsupported version": {0xa1, 0x00, 0x02},
+		"trailing data":       {0xa1, 0x00, 0x01, 0x00},
+		"indefinite length":   {0xbf, 0x00, 0x01, 0xff},
+		"text key":            {0xa2, 0x00, 0x01, 0x61, 'a', 0x00},
+		"wrong type":          {0xa2, 0x00, 0x01, 0x02, 0x01},
+		"invalid UTF-8":       {0xa2, 0x00, 0x01, 0x02, 0x61, 0xff},
+		"float not a float":   {0xa2, 0x00, 0x01, 0x08, 0xf5},
+		"pressure range":      {0xa2, 0x00, 0x01, 0x0a, 0x1b, 1, 0, 0, 0, 0, 0, 0, 0},
+		"MAC length":          {0xa2, 0x00, 0x01, 0x12, 0x41, 0xff},
+		"nested too deep":     append([]byte{0xa2, 0x00, 0x01, 0x18, 100}, bytes.Repeat([]byte{0x81}, 100)...),
+		"integer overflow":    {0xa2, 0x00, 0x01, 0x01, 0x3b, 0xff, 0, 0, 0, 0, 0, 0, 0},
+	} {
+		if _, err := UnmarshalCBOR(b); err == nil {
+			t.Errorf("CBOR %s: expected error", name)
+		}
+	}
+}
+
+func TestFloatEncoding(t *testing.T) {
+	for _, test := range []struct {
+		v        float64
+		expected string
+	}{
+		{0, "f90000"},
+		{math.Copysign(0, -1), "f98000"},
+		{1, "f93c00"},
+		{-4, "f9c400"},
+		{0.5, "f93800"},
+		{65504, "f97bff"},
+		{5.960464477539063e-8, "f90001"},
+		{0.00006103515625, "f90400"},
+		{math.Inf(1), "f97c00"},
+		{100000, "fa47c35000"},
+		{3.4028234663852886e+38, "fa7f7fffff"},
+		{24.3, "fb40384ccccccccccd"},
+		{1e300, "fb7e37e43c8800759c"},
+	} {
+		b := appendFloat(nil, test.v)
+		if got := hex.EncodeToString(b); got != test.expected {
+			t.Errorf("%v: expected %s, got %s", test.v, test.expected, got)
+		}
+		d := cborDecoder{b: b}
+		v, err := d.readFloat()
+		if err != nil || v != test.v || math.Signbit(v) != math.Signbit(test.v) {
+			t.Errorf("%v: decoded %v, %v", test.v, v, err)
+		}
+	}
+}
+
+// TestSchema checks that reading.proto agrees with the field numbers used by the encoders
+func TestSchema(t *testing.T) {
+	b, err := ioutil.ReadFile("reading.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := make(map[string]map[string]uint64)
+	var current map[string]uint64
+	field := regexp.MustCompile(`^(?:optional |repeated )?[\w<>, ]+ (\w+) = (\d+);`)
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "message ") {
+			current = make(map[string]uint64)
+			messages[strings.Fields(line)[1]] = current
+		}
+		if m := field.FindStringSubmatch(line); m != nil && current != nil {
+			num, _ := strconv.ParseUint(m[2], 10, 64)
+			current[m[1]] = num
+		}
+	}
+
+	names := map[ruuvi.Field]string{
+		ruuvi.FieldTemperature:               "temperature",
+		ruuvi.FieldHumidity:                  "humidity",
+		ruuvi.FieldPressure:                  "pressure",
+		ruuvi.FieldAccelerationX:             "acceleration_x",
+		ruuvi.FieldAccelerationY:             "acceleration_y",
+		ruuvi.FieldAccelerationZ:             "acceleration_z",
+		ruuvi.FieldBatteryVoltage:            "battery_voltage",
+		ruuvi.FieldTransmissionPower:         "tx_power",
+		ruuvi.FieldMovementCounter:           "movement_counter",
+		ruuvi.FieldMeasurementSequenceNumber: "measurement_sequence_number",
+		ruuvi.FieldMACAddress:                "mac",
+	}
+	reading := map[string]uint64{
+		"timestamp_unix_nano": fieldTimestamp,
+		"address":             fieldAddress,
+		"address_type":        fieldAddressType,
+		"rssi":                fieldRSSI,
+		"receiver":            fieldReceiver,
+		"data_format":         fieldDataFormat,
+		"raw":                 fieldRaw,
+		"tag":                 fieldTag,
+	}
+	for _, mf := range measurementFields {
+		reading[names[mf.field]] = mf.num
+	}
+	if len(measurementFields) != len(ruuvi.Fields()) {
+		t.Errorf("schema has %d measurement fields, package ruuvi %d", len(measurementFields), len(ruuvi.Fields()))
+	}
+
+	expected := map[string]map[string]uint64{
+		"Reading": reading,
+		"TagInfo": {"name": fieldTagName, "location": fieldTagLocation, "labels": fieldTagLabels},
+	}
+	if diff := cmp.Diff(expected, messages); diff != "" {
+		t.Error(diff)
+	}
+}